@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// setupBackup implements `roo-task-man backup [create|list|show|restore|prune]`:
+// incremental snapshots of the task folders and state DB with retention.
+func setupBackup(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        ifDue   bool
+        noPrune bool
+        asJSON  bool
+        yes     bool
+    )
+    fs.BoolVar(&ifDue, "if-due", false, "create: do nothing unless the newest snapshot is older than backupEvery (default 1d); for cron/launchd")
+    fs.BoolVar(&noPrune, "no-prune", false, "create: keep every snapshot instead of applying backupKeep")
+    fs.BoolVar(&asJSON, "json", false, "list/show: print JSON")
+    fs.BoolVar(&yes, "yes", false, "restore: do not ask for confirmation")
+    fs.BoolVar(&yes, "y", false, "shorthand for --yes")
+    return func(cfg config.Config, args []string) {
+        sub := "create"
+        if len(args) > 0 { sub, args = args[0], args[1:] }
+        switch sub {
+        case "create":
+            if ifDue {
+                due, err := tasks.BackupDue(cfg, backupEvery(cfg))
+                if err != nil { log.Fatalf("backup: %v", err) }
+                if !due { return }
+            }
+            backupCreate(cfg, "", !noPrune)
+        case "list", "ls":
+            backupList(cfg, asJSON)
+        case "show":
+            if len(args) != 1 { log.Fatal("backup show: exactly one <snapshot> (or @latest) is required") }
+            backupShow(cfg, findSnapshot(cfg, args[0]), asJSON)
+        case "restore":
+            if len(args) == 0 { log.Fatal("backup restore: a <snapshot> (or @latest) is required, optionally followed by task IDs") }
+            backupRestore(cfg, findSnapshot(cfg, args[0]), splitArgsCSV(args[1:]), yes)
+        case "prune":
+            dropped, freed, err := tasks.PruneSnapshots(cfg, tasks.BackupKeepRules(cfg))
+            if err != nil { log.Fatalf("backup prune: %v", err) }
+            fmt.Printf("removed %d snapshot(s), freed %s\n", len(dropped), tasks.FormatSize(freed))
+        default:
+            log.Fatalf("backup: unknown subcommand %q (want create, list, show, restore or prune)", sub)
+        }
+    }
+}
+
+// backupEvery is the configured backup interval, one day by default.
+func backupEvery(cfg config.Config) time.Duration {
+    if cfg.BackupEvery != "" {
+        if d, err := tasks.ParseAge(cfg.BackupEvery); err == nil && d > 0 { return d }
+        log.Printf("backup: ignoring invalid backupEvery %q", cfg.BackupEvery)
+    }
+    return 24 * time.Hour
+}
+
+func backupCreate(cfg config.Config, reason string, prune bool) tasks.Snapshot {
+    snap, st, err := tasks.CreateSnapshot(cfg, reason)
+    if err != nil { log.Fatalf("backup: %v", err) }
+    fmt.Printf("snapshot %s: %d task(s), %d file(s), %s (%d new file(s), %s stored) in %s\n", snap.Name, snap.TaskCount(), st.Files, tasks.FormatSize(st.Bytes), st.NewFiles, tasks.FormatSize(st.NewBytes), tasks.BackupDir(cfg))
+    if prune {
+        dropped, freed, err := tasks.PruneSnapshots(cfg, tasks.BackupKeepRules(cfg))
+        if err != nil { log.Fatalf("backup: prune: %v", err) }
+        if len(dropped) > 0 { fmt.Printf("removed %d old snapshot(s), freed %s\n", len(dropped), tasks.FormatSize(freed)) }
+    }
+    return snap
+}
+
+func findSnapshot(cfg config.Config, ref string) tasks.Snapshot {
+    list, err := tasks.ListSnapshots(cfg)
+    if err != nil { log.Fatalf("backup: %v", err) }
+    s, err := tasks.FindSnapshot(list, ref)
+    if err != nil { log.Fatal(err) }
+    return s
+}
+
+func backupList(cfg config.Config, asJSON bool) {
+    list, err := tasks.ListSnapshots(cfg)
+    if err != nil { log.Fatalf("backup: %v", err) }
+    if asJSON {
+        type row struct {
+            Name      string    `json:"name"`
+            CreatedAt time.Time `json:"createdAt"`
+            Reason    string    `json:"reason,omitempty"`
+            Tasks     int       `json:"tasks"`
+        }
+        rows := make([]row, 0, len(list))
+        for _, s := range list { rows = append(rows, row{Name: s.Name, CreatedAt: s.CreatedAt, Reason: s.Reason, Tasks: s.TaskCount()}) }
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(rows); err != nil { log.Fatal(err) }
+        return
+    }
+    if len(list) == 0 { fmt.Printf("no snapshots in %s; create one with `roo-task-man backup`\n", tasks.BackupDir(cfg)); return }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "SNAPSHOT\tCREATED\tTASKS\tSOURCES\tREASON")
+    for _, s := range list {
+        fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", s.Name, s.CreatedAt.Local().Format("2006-01-02 15:04"), s.TaskCount(), len(s.Sources), s.Reason)
+    }
+    tw.Flush()
+}
+
+func backupShow(cfg config.Config, s tasks.Snapshot, asJSON bool) {
+    if asJSON {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(s); err != nil { log.Fatal(err) }
+        return
+    }
+    fmt.Printf("snapshot %s, taken %s by roo-task-man %s\n", s.Name, s.CreatedAt.Local().Format("2006-01-02 15:04:05"), s.Version)
+    for _, src := range s.Sources {
+        db := "no state DB"
+        if len(src.DB) > 0 { db = src.StateDB }
+        fmt.Printf("\n%s (%s)\n", src.Label(), db)
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "ID\tFILES\tSIZE\tTITLE")
+        for _, t := range src.Tasks {
+            title, _, _ := tasks.CleanOneLine(t.Title, 60)
+            fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", t.ID, len(t.Files), tasks.FormatSize(t.Size()), title)
+        }
+        tw.Flush()
+    }
+}
+
+// backupRestore restores a whole snapshot, or only the tasks named by refs. The current
+// state is snapshotted first, so a restore can itself be undone.
+func backupRestore(cfg config.Config, s tasks.Snapshot, refs []string, yes bool) {
+    var picks []tasks.SnapshotPick
+    question := fmt.Sprintf("Restore all %d task(s) and the state DB from snapshot %s?", s.TaskCount(), s.Name)
+    if len(refs) > 0 {
+        var err error
+        if picks, err = s.Picks(refs); err != nil { log.Fatal(err) }
+        question = fmt.Sprintf("Restore %d task(s) from snapshot %s?", len(picks), s.Name)
+    }
+    requireEditorClosed(cfg)
+    if !yes && !confirm(question) { fmt.Println("canceled"); return }
+    restoreSnapshot(cfg, s, picks)
+}
+
+// restoreSnapshot snapshots the current state, then restores picks from s (all of s
+// when picks is empty).
+func restoreSnapshot(cfg config.Config, s tasks.Snapshot, picks []tasks.SnapshotPick) {
+    requireEditorClosed(cfg)
+    pre := backupCreate(cfg, "before restoring "+s.Name, false)
+    var err error
+    if len(picks) == 0 {
+        err = tasks.RestoreSnapshot(cfg, s)
+    } else {
+        err = tasks.RestoreSnapshotTasks(cfg, s, picks)
+    }
+    if err != nil { log.Fatalf("restore failed: %v (the state before restoring is snapshot %s)", err, pre.Name) }
+    if len(picks) == 0 {
+        fmt.Printf("restored snapshot %s; undo with: roo-task-man backup restore %s\n", s.Name, pre.Name)
+        return
+    }
+    fmt.Printf("restored %d task(s) from snapshot %s; the state before is snapshot %s\n", len(picks), s.Name, pre.Name)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/zipper"
+)
+
+// filterFlags are the task selection flags shared by export and dump.
+type filterFlags struct {
+    taskIDs   string
+    dateRange string
+    workspace string
+    query     string
+}
+
+func (f *filterFlags) register(fs *flag.FlagSet) {
+    fs.StringVar(&f.taskIDs, "taskids", "", "comma-separated task IDs, unique ID prefixes, @latest/@N or title fragments")
+    fs.StringVar(&f.dateRange, "date-range", "", "created-at range: from..to; dates YYYY-MM-DD or YYYYMMDD (inclusive)")
+    fs.StringVar(&f.workspace, "workspace", "", "keep tasks whose taskHistory workspace contains this text")
+    fs.StringVar(&f.query, "query", "", "keep tasks whose title, ID or human prompts contain this text")
+}
+
+func (f *filterFlags) filter(extraIDs []string) tasks.Filter {
+    ids := f.taskIDs
+    if len(extraIDs) > 0 { ids = strings.Join(append(splitCSV(ids), extraIDs...), ",") }
+    filter, err := buildFilter(ids, f.dateRange, f.workspace, f.query)
+    if err != nil { log.Fatalf("invalid filter: %v", err) }
+    return filter
+}
+
+func setupExport(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        ff  filterFlags
+        out string
+    )
+    ff.register(fs)
+    fs.StringVar(&out, "out", "", "zip path (default: <editor>-<plugin-id>-<ids>.zip in CWD when IDs are given)")
+    fs.StringVar(&out, "o", "", "shorthand for --out")
+    return func(cfg config.Config, args []string) {
+        ids := splitArgsCSV(args)
+        filter := ff.filter(ids)
+        if filter.IsZero() { log.Fatal("export: give task IDs or at least one filter (--taskids, --date-range, --workspace, --query)") }
+        if len(filter.IDs) > 0 { filter.IDs = resolveIDs(cfg, filter.IDs) }
+        allIDs := filter.IDs
+        if out == "" {
+            if len(allIDs) == 0 { log.Fatal("export: --out <zip-path> is required unless task IDs are given") }
+            out = defaultExportName(tasks.DisplayEditorName(cfg.CodeChannel), cfg.PluginID, allIDs)
+            if cfg.Debug { fmt.Printf("[export] no --out provided; using %s\n", out) }
+        }
+        if len(allIDs) == 1 && filter.From == nil && filter.To == nil && filter.Workspace == "" && filter.Query == "" {
+            exportSingle(cfg, allIDs[0], out)
+            return
+        }
+        exportFiltered(cfg, filter, out)
+    }
+}
+
+// exportSingle writes one task with the single-task manifest.
+func exportSingle(cfg config.Config, id, zipPath string) {
+    t := findTask(cfg, id)
+    if ws, err := tasks.TaskWorkspaces(cfg); err == nil { t.Workspace = ws[tasks.HistoryKey(t)] }
+    if err := zipper.ExportTask(t, zipPath); err != nil { log.Fatalf("export failed: %v", err) }
+    fmt.Printf("exported %s -> %s\n", t.ID, zipPath)
+}
+
+// exportFiltered writes every task matching filter into one multi-task archive.
+func exportFiltered(cfg config.Config, filter tasks.Filter, zipPath string) {
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+    var workspaces map[string]string
+    if filter.Workspace != "" {
+        workspaces, err = tasks.TaskWorkspaces(cfg)
+        if err != nil { log.Fatalf("workspace filter: %v", err) }
+    }
+    if len(filter.IDs) > 0 {
+        if filter.IDs, err = tasks.ResolveRefs(list, filter.IDs); err != nil { log.Fatal(err) }
+    }
+    selected := tasks.FilterTasks(list, filter, workspaces)
+    if len(selected) == 0 { log.Fatal("no tasks matched filters for export") }
+    tasks.AttachWorkspaces(cfg, selected)
+    if err := zipper.ExportTasks(selected, zipPath); err != nil { log.Fatalf("export failed: %v", err) }
+    fmt.Printf("exported %d tasks -> %s\n", len(selected), zipPath)
+}
+
+func setupImport(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        workspace string
+        rewrites  rewriteFlags
+    )
+    fs.StringVar(&workspace, "workspace", "", "register every task under this workspace path (default: each task's own workspace, mapped by pathMap)")
+    fs.Var(&rewrites, "rewrite", "map the exporting machine's workspace paths: from=to (repeatable; combined with pathMap, longest prefix wins)")
+    return func(cfg config.Config, args []string) {
+        if len(args) == 0 { log.Fatal("import: at least one <zip> is required") }
+        for _, zipPath := range args { importArchive(cfg, zipPath, workspace, rewrites) }
+    }
+}
+
+// importArchive extracts an archive into the storage root and registers its tasks
+// in the editor's global state DB. Unless workspace is given, each task goes to the
+// workspace recorded in the archive, mapped by rewrites and then the config's pathMap.
+func importArchive(cfg config.Config, zipPath, workspace string, rewrites []tasks.PathRewrite) {
+    requireEditorClosed(cfg)
+    destRoot, err := tasks.ResolveStorageRoot(cfg)
+    if err != nil { log.Fatalf("resolve storage root: %v", err) }
+    manifest, err := zipper.ReadManifest(zipPath)
+    if err != nil { log.Fatalf("read manifest: %v", err) }
+    ids := make([]string, 0, len(manifest))
+    for _, m := range manifest { ids = append(ids, m.ID) }
+    if cfg.Debug {
+        fmt.Printf("[import] manifest IDs: %v\n", ids)
+        fmt.Printf("[import] destination root: %s\n", destRoot)
+    }
+    // enable zipper debug if requested
+    zipper.EnableDebug(cfg.Debug)
+    if err := zipper.ImportAny(zipPath, destRoot); err != nil { log.Fatalf("import failed: %v", err) }
+    fmt.Printf("imported %s into %s\n", zipPath, destRoot)
+    // Tasks without a mapped or existing workspace fall back to the current directory
+    cwd, err := os.Getwd()
+    if err != nil && workspace == "" {
+        if cfg.Debug { fmt.Printf("[import] could not resolve CWD for workspace: %v\n", err) }
+        cwd = ""
+    }
+    rules := append(append([]tasks.PathRewrite{}, rewrites...), tasks.PathRewrites(cfg)...)
+    mapped := map[string]tasks.ImportWorkspace{}
+    for _, m := range manifest { mapped[m.ID] = tasks.MapImportWorkspace(m.ID, m.Workspace, workspace, cwd, rules) }
+    // Register into global state DB
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { log.Fatalf("post-import load tasks: %v", err) }
+    byID := map[string]tasks.Task{}
+    for _, t := range list {
+        if _, ok := byID[t.ID]; !ok { byID[t.ID] = t }
+    }
+    var selected []tasks.Task
+    var placed []tasks.ImportWorkspace
+    for _, id := range ids {
+        t, ok := byID[id]
+        if !ok { continue }
+        w := mapped[id]
+        if w.Path == "" {
+            log.Printf("warning: no workspace for %s; not registered", id)
+            continue
+        }
+        t.Workspace = w.Path
+        selected = append(selected, t)
+        placed = append(placed, w)
+    }
+    if len(selected) == 0 {
+        log.Printf("warning: no imported tasks found for registration")
+        return
+    }
+    if err := tasks.RegisterImportedTasks(cfg, workspace, selected); err != nil {
+        log.Fatalf("register in global state failed: %v", err)
+    }
+    // Integrity check: verify inserted IDs present in primary and backup DBs
+    primary, backup, err := tasks.VerifyRegistration(cfg, ids)
+    if err != nil {
+        log.Printf("integrity check failed: %v", err)
+    }
+    // summarize
+    pOK, bOK := 0, 0
+    missingP, missingB := []string{}, []string{}
+    for _, id := range ids {
+        if primary != nil && primary[id] { pOK++ } else { missingP = append(missingP, id) }
+        if backup != nil && backup[id] { bOK++ } else { missingB = append(missingB, id) }
+    }
+    if workspace != "" {
+        fmt.Printf("registered %d tasks into global state for workspace %s\n", len(selected), workspace)
+    } else {
+        fmt.Printf("registered %d tasks into global state:\n", len(selected))
+        printImportWorkspaces(placed)
+    }
+    if cfg.Debug {
+        fmt.Printf("integrity: primary %d/%d ok\n", pOK, len(ids))
+        fmt.Printf("integrity: backup  %d/%d ok\n", bOK, len(ids))
+        if len(missingP) > 0 { fmt.Printf("[integrity] primary missing: %v\n", missingP) }
+        if len(missingB) > 0 { fmt.Printf("[integrity] backup missing: %v\n", missingB) }
+    }
+}
+
+// printImportWorkspaces lists where each imported task was registered and which rule put it there.
+func printImportWorkspaces(placed []tasks.ImportWorkspace) {
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    for _, w := range placed {
+        var why string
+        switch w.Reason {
+        case "rule":
+            why = fmt.Sprintf("%s => %s", w.Rule.From, w.Rule.To)
+        case "original":
+            why = "unchanged, exists here"
+        case "cwd":
+            if w.Original == "" { why = "no workspace in archive, current directory" } else { why = "no rule matched, current directory" }
+        }
+        orig := w.Original
+        if orig == "" { orig = "-" }
+        fmt.Fprintf(tw, "  %s\t%s\t-> %s\t(%s)\n", w.ID, orig, w.Path, why)
+    }
+    tw.Flush()
+}
+
+func setupDelete(fs *flag.FlagSet) func(config.Config, []string) {
+    var yes, permanent bool
+    fs.BoolVar(&yes, "yes", false, "do not ask for confirmation")
+    fs.BoolVar(&yes, "y", false, "shorthand for --yes")
+    fs.BoolVar(&permanent, "permanent", false, "delete for good instead of moving to the trash")
+    return func(cfg config.Config, args []string) {
+        ids := splitArgsCSV(args)
+        if len(ids) == 0 { log.Fatal("delete: at least one <task-id> is required") }
+        selected := resolveTasks(cfg, ids)
+        requireEditorClosed(cfg)
+        if !yes {
+            for _, t := range selected {
+                title, _, _ := tasks.CleanOneLine(t.Title, 80)
+                fmt.Printf("  %s  %s\n", t.ID, title)
+            }
+            question := fmt.Sprintf("Move %d task(s) to the trash?", len(selected))
+            if permanent { question = fmt.Sprintf("Delete %d task(s) permanently?", len(selected)) }
+            if !confirm(question) { fmt.Println("canceled"); return }
+        }
+        if permanent {
+            if err := tasks.PurgeTasks(cfg, selected); err != nil { log.Fatalf("delete: %v", err) }
+            for _, t := range selected { fmt.Printf("deleted %s\n", t.ID) }
+            return
+        }
+        entries, err := tasks.TrashTasks(cfg, selected)
+        for _, e := range entries { fmt.Printf("trashed %s\n", e.ID) }
+        if err != nil { log.Fatalf("delete: %v", err) }
+        if len(entries) > 0 { fmt.Printf("undo with: roo-task-man trash restore %s\n", strings.Join(trashIDs(entries), " ")) }
+    }
+}
+
+// confirm asks a y/N question on the terminal. Without a terminal it answers no.
+func confirm(question string) bool {
+    if !term.IsTerminal(int(os.Stdin.Fd())) {
+        fmt.Fprintf(os.Stderr, "%s refusing without a terminal; pass --yes\n", question)
+        return false
+    }
+    fmt.Printf("%s y/N ", question)
+    line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+    ans := strings.ToLower(strings.TrimSpace(line))
+    return ans == "y" || ans == "yes"
+}
+
+func setupDump(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        ff       filterFlags
+        tmplPath string
+        all      bool
+    )
+    ff.register(fs)
+    fs.StringVar(&tmplPath, "template", "", "Go text/template file used to lay out the dump")
+    fs.BoolVar(&all, "all", false, "include AI responses and tool calls, not only human prompts")
+    return func(cfg config.Config, args []string) {
+        if len(args) != 1 { log.Fatal("dump: exactly one <file.md> is required") }
+        dumpMarkdown(cfg, args[0], tasks.DumpOptions{Filter: ff.filter(nil), TemplatePath: tmplPath, IncludeAll: all})
+    }
+}
+
+func dumpMarkdown(cfg config.Config, path string, opts tasks.DumpOptions) {
+    // one-line progress indicator updated in place
+    progress := func(cur, total int) {
+        // \r keeps it on a single terminal line
+        fmt.Printf("\rDumping %d/%d…", cur, total)
+    }
+    if err := tasks.DumpMarkdownWithOptions(cfg, path, opts, progress); err != nil {
+        log.Fatalf("dump failed: %v", err)
+    }
+    fmt.Printf("\nDump complete -> %s\n", path)
+}
+
+// findTask loads tasks and resolves ref (ID, unique prefix, @latest/@N or title
+// fragment), exiting with the candidates listed when it is ambiguous.
+func findTask(cfg config.Config, ref string) tasks.Task {
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+    t, err := tasks.ResolveRef(list, ref)
+    if err != nil { log.Fatal(err) }
+    return t
+}
+
+// resolveIDs turns task references into full IDs, exiting on the first unresolved one.
+func resolveIDs(cfg config.Config, refs []string) []string {
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+    ids, err := tasks.ResolveRefs(list, refs)
+    if err != nil { log.Fatal(err) }
+    return ids
+}
+
+// resolveTasks loads the tasks once and resolves refs against them, dropping repeats
+// (`delete a a`, or a prefix and the full ID of the same task).
+func resolveTasks(cfg config.Config, refs []string) []tasks.Task {
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+    ids, err := tasks.ResolveRefs(list, refs)
+    if err != nil { log.Fatal(err) }
+    byID := make(map[string]tasks.Task, len(list))
+    for _, t := range list {
+        if _, ok := byID[t.ID]; !ok { byID[t.ID] = t }
+    }
+    out := make([]tasks.Task, 0, len(ids))
+    for _, id := range ids { out = append(out, byID[id]) }
+    return out
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/zipper"
+)
+
+// readHistory returns the taskHistory entries of pluginID in the state DB at path, by id.
+func readHistory(t *testing.T, path, pluginID string) (map[string]map[string]any, int) {
+    t.Helper()
+    db, err := sql.Open("sqlite", path)
+    if err != nil { t.Fatal(err) }
+    defer db.Close()
+    var raw []byte
+    if err := db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&raw); err != nil { t.Fatalf("%s: %v", path, err) }
+    var doc struct{ TaskHistory []map[string]any `json:"taskHistory"` }
+    if err := json.Unmarshal(raw, &doc); err != nil { t.Fatal(err) }
+    out := map[string]map[string]any{}
+    for _, e := range doc.TaskHistory { out[e["id"].(string)] = e }
+    return out, len(doc.TaskHistory)
+}
+
+func TestImportArchiveRegistersEachWorkspace(t *testing.T) {
+    // two tasks exported on another machine, each from its own workspace
+    src := t.TempDir()
+    here := t.TempDir() // a workspace path that exists on this machine
+    var exported []tasks.Task
+    for i, ws := range []string{"/remote/proj", here} {
+        id := []string{"t1", "t2"}[i]
+        dir := filepath.Join(src, id)
+        if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+        ui := `[{"ts":1,"type":"say","say":"text","text":"prompt ` + id + `","images":[]},` +
+            `{"ts":2,"type":"say","say":"api_req_started","text":"{\"tokenIn\":100,\"tokenOut\":20,\"costs\":0.5}"}]`
+        if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(ui), 0o644); err != nil { t.Fatal(err) }
+        exported = append(exported, tasks.Task{ID: id, Title: "prompt " + id, Summary: "prompt " + id, Path: dir, CreatedAt: time.Now(), Workspace: ws})
+    }
+    zipPath := filepath.Join(t.TempDir(), "two.zip")
+    if err := zipper.ExportTasks(exported, zipPath); err != nil { t.Fatal(err) }
+
+    // the importing editor already has one task in its history
+    udd := t.TempDir()
+    gs := filepath.Join(udd, "User", "globalStorage")
+    if err := os.MkdirAll(filepath.Join(gs, "pub.ext", "tasks"), 0o755); err != nil { t.Fatal(err) }
+    for _, p := range []string{"state.vscdb", "state.vscdb.backup"} {
+        db, err := sql.Open("sqlite", filepath.Join(gs, p))
+        if err != nil { t.Fatal(err) }
+        if _, err := db.Exec("CREATE TABLE ItemTable (key TEXT PRIMARY KEY, value BLOB)"); err != nil { t.Fatal(err) }
+        if _, err := db.Exec("INSERT INTO ItemTable VALUES ('pub.ext', ?)", `{"taskHistory":[{"id":"old","workspace":"/w"}]}`); err != nil { t.Fatal(err) }
+        db.Close()
+    }
+    cfg := config.Default()
+    cfg.PluginID, cfg.CodeChannel, cfg.UserDataDir = "pub.ext", "Custom", udd
+    cfg.NoCache, cfg.Force = true, true
+
+    rules := []tasks.PathRewrite{{From: "/remote", To: "/local"}}
+    for round := 1; round <= 2; round++ { // importing again must not add entries
+        importArchive(cfg, zipPath, "", rules)
+        for _, p := range []string{"state.vscdb", "state.vscdb.backup"} {
+            hist, n := readHistory(t, filepath.Join(gs, p), "pub.ext")
+            if n != 3 { t.Fatalf("round %d, %s: %d entries, want 3", round, p, n) }
+            want := map[string]string{"old": "/w", "t1": "/local/proj", "t2": here}
+            for id, ws := range want {
+                if got, _ := hist[id]["workspace"].(string); got != ws { t.Errorf("round %d, %s: %s workspace %q, want %q", round, p, id, got, ws) }
+            }
+            for _, id := range []string{"t1", "t2"} {
+                e := hist[id]
+                if e["tokensIn"] != float64(100) || e["tokensOut"] != float64(20) || e["totalCost"] != 0.5 {
+                    t.Errorf("round %d, %s: %s stats %v/%v/%v, want the task's 100/20/0.5", round, p, id, e["tokensIn"], e["tokensOut"], e["totalCost"])
+                }
+            }
+        }
+    }
+}
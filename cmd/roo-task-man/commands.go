@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/version"
+)
+
+// command is one roo-task-man subcommand.
+type command struct {
+    name    string
+    args    string // positional synopsis shown in help
+    summary string
+    idArgs  bool   // positional arguments are task IDs (used for shell completion)
+    // setup registers command-specific flags on fs and returns the function that runs
+    // the command once fs has been parsed.
+    setup func(fs *flag.FlagSet) func(cfg config.Config, args []string)
+}
+
+var commands []command
+
+func init() {
+    commands = []command{
+        {name: "list", args: "[expr]", summary: "List tasks, filtered with a query expression", setup: setupList},
+        {name: "show", args: "<task-id>", summary: "Print one task", idArgs: true, setup: setupShow},
+        {name: "tail", args: "[task-id|@latest]", summary: "Follow a running task's messages as they are written", idArgs: true, setup: setupTail},
+        {name: "export", args: "[task-id...]", summary: "Export tasks to a zip archive", idArgs: true, setup: setupExport},
+        {name: "import", args: "<zip>...", summary: "Import archives and register them in the editor history", setup: setupImport},
+        {name: "delete", args: "<task-id>...", summary: "Move tasks to the trash and drop them from the editor history", idArgs: true, setup: setupDelete},
+        {name: "prune", summary: "Delete (or archive) tasks matched by the retention rules of the config", setup: setupPrune},
+        {name: "trash", args: "list|restore|empty [id...]", summary: "List, restore or empty deleted tasks", setup: setupTrash},
+        {name: "du", args: "[expr]", summary: "Show each task's size split into conversation, images, checkpoints and other files", setup: setupDu},
+        {name: "compact", args: "[task-id...]", summary: "Move embedded images out of task JSON and gc checkpoint repositories", idArgs: true, setup: setupCompact},
+        {name: "migrate", args: "[task-id...]", summary: "Copy tasks to another editor or extension and register them there", idArgs: true, setup: setupMigrate},
+        {name: "sync", args: "[task-id...]", summary: "Push and pull tasks through a directory shared between machines", idArgs: true, setup: setupSync},
+        {name: "dump", args: "<file.md>", summary: "Dump tasks and prompts to Markdown", setup: setupDump},
+        {name: "backup", args: "[create|list|show|restore|prune] [snapshot] [id...]", summary: "Snapshot task folders and the state DB incrementally, with retention", setup: setupBackup},
+        {name: "state", args: "[list|show|export|import] [key...]", summary: "Browse, export and import the extension's keys in state.vscdb (modes, API profiles, settings)", setup: setupState},
+        {name: "restore", summary: "Restore state.vscdb backups or snapshot tasks (interactive)", setup: setupRestore},
+        {name: "inspect", args: "<zip>", summary: "Open the TUI on the contents of an archive", setup: setupInspect},
+        {name: "sources", summary: "List installed editors and the task-holding extensions in each", setup: setupSources},
+        {name: "tui", summary: "Open the interactive task browser (default)", setup: setupTUI},
+        {name: "completion", args: "bash|zsh|fish", summary: "Print a shell completion script", setup: setupCompletion},
+        {name: "version", summary: "Print version", setup: setupVersion},
+        {name: "help", args: "[command]", summary: "Show help for a command", setup: setupHelp},
+    }
+}
+
+func findCommand(name string) *command {
+    for i := range commands {
+        if commands[i].name == name { return &commands[i] }
+    }
+    return nil
+}
+
+// flagSet builds the command's flag set: global flags plus the command's own.
+func (c *command) flagSet() (*flag.FlagSet, *globalFlags, func(config.Config, []string)) {
+    fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+    g := &globalFlags{}
+    g.register(fs)
+    run := c.setup(fs)
+    fs.Usage = func() { c.printHelp(fs.Output(), fs) }
+    return fs, g, run
+}
+
+func (c *command) run(args []string) {
+    fs, g, run := c.flagSet()
+    pos := parseInterspersed(fs, args)
+    cfg := g.config()
+    run(cfg, pos)
+    tasks.SaveMetaCache(cfg)
+}
+
+// parseInterspersed parses fs allowing flags after positional arguments
+// (e.g. `show <id> --raw`). Everything after "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+    var pos []string
+    for {
+        _ = fs.Parse(args)
+        rest := fs.Args()
+        if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+            return append(pos, rest...)
+        }
+        if len(rest) == 0 { return pos }
+        pos = append(pos, rest[0])
+        args = rest[1:]
+    }
+}
+
+func (c *command) printHelp(w io.Writer, fs *flag.FlagSet) {
+    fmt.Fprintf(w, "Usage: roo-task-man %s [flags]", c.name)
+    if c.args != "" { fmt.Fprintf(w, " %s", c.args) }
+    fmt.Fprintf(w, "\n\n%s\n", c.summary)
+    globals := globalFlagNames()
+    own := subsetFlags(fs, func(name string) bool { return !globals[name] })
+    if hasFlags(own) {
+        fmt.Fprintf(w, "\nFlags:\n")
+        own.SetOutput(w)
+        own.PrintDefaults()
+    }
+    fmt.Fprintf(w, "\nGlobal flags:\n")
+    gl := subsetFlags(fs, func(name string) bool { return globals[name] })
+    gl.SetOutput(w)
+    gl.PrintDefaults()
+}
+
+func globalFlagNames() map[string]bool {
+    fs := flag.NewFlagSet("globals", flag.ContinueOnError)
+    (&globalFlags{}).register(fs)
+    out := map[string]bool{}
+    fs.VisitAll(func(f *flag.Flag) { out[f.Name] = true })
+    return out
+}
+
+func subsetFlags(fs *flag.FlagSet, keep func(string) bool) *flag.FlagSet {
+    out := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+    fs.VisitAll(func(f *flag.Flag) {
+        if keep(f.Name) { out.Var(f.Value, f.Name, f.Usage) }
+    })
+    return out
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+    n := 0
+    fs.VisitAll(func(*flag.Flag) { n++ })
+    return n > 0
+}
+
+// printUsage prints the top-level help: commands plus a pointer to legacy flags.
+func printUsage(w io.Writer) {
+    fmt.Fprintf(w, "Usage: roo-task-man <command> [flags] [args]\n\nCommands:\n")
+    for _, c := range commands {
+        fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+    }
+    fmt.Fprintf(w, "\nRun `roo-task-man help <command>` for command flags.\n")
+    fmt.Fprintf(w, "Without a command, the legacy flags below are accepted (--export, --import, --dump, --restore, --inspect).\n\n")
+}
+
+func setupVersion(fs *flag.FlagSet) func(config.Config, []string) {
+    return func(config.Config, []string) { fmt.Printf("Version: %s\n", version.String()) }
+}
+
+func setupHelp(fs *flag.FlagSet) func(config.Config, []string) {
+    return func(_ config.Config, args []string) {
+        if len(args) == 0 {
+            printUsage(os.Stdout)
+            return
+        }
+        c := findCommand(args[0])
+        if c == nil {
+            fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+            printUsage(os.Stderr)
+            os.Exit(2)
+        }
+        cfs, _, _ := c.flagSet()
+        c.printHelp(os.Stdout, cfs)
+    }
+}
+
+// splitArgsCSV flattens positional arguments that may themselves be comma-separated.
+func splitArgsCSV(args []string) []string {
+    return splitCSV(strings.Join(args, ","))
+}
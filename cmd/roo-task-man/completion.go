@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"roocode-task-man/internal/config"
+)
+
+// completionFlag describes one flag for completion scripts.
+type completionFlag struct {
+    name  string
+    usage string
+    bool  bool
+}
+
+func commandFlags(c *command) []completionFlag {
+    fs, _, _ := c.flagSet()
+    var out []completionFlag
+    fs.VisitAll(func(f *flag.Flag) {
+        bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+        out = append(out, completionFlag{name: f.Name, usage: f.Usage, bool: ok && bf.IsBoolFlag()})
+    })
+    return out
+}
+
+func setupCompletion(fs *flag.FlagSet) func(config.Config, []string) {
+    return func(_ config.Config, args []string) {
+        if len(args) != 1 { log.Fatal("completion: one of bash, zsh or fish is required") }
+        switch args[0] {
+        case "bash":
+            writeBashCompletion(os.Stdout)
+        case "zsh":
+            writeZshCompletion(os.Stdout)
+        case "fish":
+            writeFishCompletion(os.Stdout)
+        default:
+            log.Fatalf("completion: unsupported shell %q (bash, zsh, fish)", args[0])
+        }
+    }
+}
+
+// idsCommand lists task IDs for dynamic completion of task arguments.
+const idsCommand = "roo-task-man list --format ids 2>/dev/null"
+
+func writeBashCompletion(w io.Writer) {
+    names := make([]string, 0, len(commands))
+    for _, c := range commands { names = append(names, c.name) }
+    fmt.Fprintf(w, "# bash completion for roo-task-man\n# source <(roo-task-man completion bash)\n")
+    fmt.Fprintf(w, "_roo_task_man() {\n")
+    fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" flags=\"\"\n")
+    fmt.Fprintf(w, "    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+    fmt.Fprintf(w, "        COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n        return\n    fi\n", strings.Join(names, " "))
+    fmt.Fprintf(w, "    case \"${COMP_WORDS[1]}\" in\n")
+    for i := range commands {
+        c := &commands[i]
+        flags := []string{}
+        for _, f := range commandFlags(c) { flags = append(flags, "--"+f.name) }
+        fmt.Fprintf(w, "        %s) flags=\"%s\" ;;\n", c.name, strings.Join(flags, " "))
+    }
+    fmt.Fprintf(w, "    esac\n")
+    fmt.Fprintf(w, "    if [[ \"$cur\" == -* ]]; then\n        COMPREPLY=( $(compgen -W \"$flags\" -- \"$cur\") )\n        return\n    fi\n")
+    fmt.Fprintf(w, "    case \"${COMP_WORDS[1]}\" in\n")
+    fmt.Fprintf(w, "        %s) COMPREPLY=( $(compgen -W \"$(%s)\" -- \"$cur\") ) ;;\n", strings.Join(idCommandNames(), "|"), idsCommand)
+    fmt.Fprintf(w, "        help) COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") ) ;;\n", strings.Join(names, " "))
+    fmt.Fprintf(w, "        completion) COMPREPLY=( $(compgen -W \"bash zsh fish\" -- \"$cur\") ) ;;\n")
+    fmt.Fprintf(w, "        *) COMPREPLY=( $(compgen -f -- \"$cur\") ) ;;\n")
+    fmt.Fprintf(w, "    esac\n}\ncomplete -F _roo_task_man roo-task-man\n")
+}
+
+func writeZshCompletion(w io.Writer) {
+    fmt.Fprintf(w, "#compdef roo-task-man\n# roo-task-man completion zsh > \"${fpath[1]}/_roo-task-man\"\n\n")
+    fmt.Fprintf(w, "_roo_task_man() {\n    local -a cmds\n    cmds=(\n")
+    for _, c := range commands {
+        fmt.Fprintf(w, "        '%s:%s'\n", c.name, zshEscape(c.summary))
+    }
+    fmt.Fprintf(w, "    )\n    if (( CURRENT == 2 )); then\n        _describe 'command' cmds\n        return\n    fi\n")
+    fmt.Fprintf(w, "    words=(\"${words[@]:1}\")\n    (( CURRENT-- ))\n")
+    fmt.Fprintf(w, "    case $words[1] in\n")
+    for i := range commands {
+        c := &commands[i]
+        fmt.Fprintf(w, "        %s)\n            _arguments \\\n", c.name)
+        for _, f := range commandFlags(c) {
+            if f.bool {
+                fmt.Fprintf(w, "                '--%s[%s]' \\\n", f.name, zshEscape(f.usage))
+            } else {
+                fmt.Fprintf(w, "                '--%s=[%s]:value:' \\\n", f.name, zshEscape(f.usage))
+            }
+        }
+        switch {
+        case c.idArgs:
+            fmt.Fprintf(w, "                '*:task id:(${(f)\"$(%s)\"})'\n", idsCommand)
+        case c.name == "help":
+            fmt.Fprintf(w, "                '1:command:(%s)'\n", strings.Join(commandNames(), " "))
+        case c.name == "completion":
+            fmt.Fprintf(w, "                '1:shell:(bash zsh fish)'\n")
+        default:
+            fmt.Fprintf(w, "                '*:file:_files'\n")
+        }
+        fmt.Fprintf(w, "            ;;\n")
+    }
+    fmt.Fprintf(w, "    esac\n}\n\ncompdef _roo_task_man roo-task-man\n")
+}
+
+func writeFishCompletion(w io.Writer) {
+    fmt.Fprintf(w, "# roo-task-man completion fish > ~/.config/fish/completions/roo-task-man.fish\n")
+    fmt.Fprintf(w, "complete -c roo-task-man -f\n")
+    for _, c := range commands {
+        fmt.Fprintf(w, "complete -c roo-task-man -n '__fish_use_subcommand' -a %s -d '%s'\n", c.name, fishEscape(c.summary))
+    }
+    for i := range commands {
+        c := &commands[i]
+        cond := fmt.Sprintf("__fish_seen_subcommand_from %s", c.name)
+        for _, f := range commandFlags(c) {
+            req := " -r"
+            if f.bool { req = "" }
+            fmt.Fprintf(w, "complete -c roo-task-man -n '%s' -l %s%s -d '%s'\n", cond, f.name, req, fishEscape(f.usage))
+        }
+        switch {
+        case c.idArgs:
+            fmt.Fprintf(w, "complete -c roo-task-man -n '%s' -a '(%s)'\n", cond, idsCommand)
+        case c.name == "help":
+            fmt.Fprintf(w, "complete -c roo-task-man -n '%s' -a '%s'\n", cond, strings.Join(commandNames(), " "))
+        case c.name == "completion":
+            fmt.Fprintf(w, "complete -c roo-task-man -n '%s' -a 'bash zsh fish'\n", cond)
+        case c.args != "":
+            fmt.Fprintf(w, "complete -c roo-task-man -n '%s' -F\n", cond)
+        }
+    }
+}
+
+func commandNames() []string {
+    out := make([]string, 0, len(commands))
+    for _, c := range commands { out = append(out, c.name) }
+    return out
+}
+
+func idCommandNames() []string {
+    out := []string{}
+    for _, c := range commands { if c.idArgs { out = append(out, c.name) } }
+    return out
+}
+
+// zshEscape makes text safe inside a single-quoted _arguments/_describe spec.
+func zshEscape(s string) string {
+    r := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]", ":", "\\:")
+    return r.Replace(s)
+}
+
+func fishEscape(s string) string {
+    return strings.ReplaceAll(s, "'", "\\'")
+}
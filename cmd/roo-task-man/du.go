@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// duRecord is the JSON shape of one `du` row.
+type duRecord struct {
+    ID     string `json:"id"`
+    Title  string `json:"title"`
+    Source string `json:"source,omitempty"`
+    Total  int64  `json:"total"`
+    tasks.DiskUsage
+}
+
+// setupDu implements `roo-task-man du`: each task's size split into conversation JSON,
+// embedded images, checkpoints and other files.
+func setupDu(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        where    string
+        sortSpec string
+        limit    int
+        asJSON   bool
+    )
+    fs.StringVar(&where, "where", "", "query expression selecting the tasks (see `list`)")
+    fs.StringVar(&sortSpec, "sort", "-size", "comma-separated sort fields, e.g. -images_size or -checkpoints_size")
+    fs.IntVar(&limit, "limit", 0, "print at most N tasks (0 = all)")
+    fs.BoolVar(&asJSON, "json", false, "print JSON")
+    return func(cfg config.Config, args []string) {
+        if len(args) > 0 && where == "" { where = strings.Join(args, " ") }
+        rows := selectRows(cfg, where)
+        if err := tasks.SortRows(rows, sortSpec); err != nil { log.Fatalf("invalid --sort: %v", err) }
+        if limit > 0 && len(rows) > limit { rows = rows[:limit] }
+        if asJSON {
+            recs := make([]duRecord, 0, len(rows))
+            for _, r := range rows {
+                u := r.Usage()
+                recs = append(recs, duRecord{ID: r.ID, Title: r.Title, Source: r.Source, Total: u.Total(), DiskUsage: u})
+            }
+            enc := json.NewEncoder(os.Stdout)
+            enc.SetIndent("", "  ")
+            if err := enc.Encode(recs); err != nil { log.Fatal(err) }
+            return
+        }
+        withSource := tasks.MultiSource(cfg)
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        if withSource { fmt.Fprint(tw, "SOURCE\t") }
+        fmt.Fprintln(tw, "ID\tTOTAL\tCONVERSATION\tIMAGES\tCHECKPOINTS\tOTHER\tTITLE")
+        var sum tasks.DiskUsage
+        for _, r := range rows {
+            u := r.Usage()
+            sum.Conversation += u.Conversation
+            sum.Images += u.Images
+            sum.Checkpoints += u.Checkpoints
+            sum.Other += u.Other
+            title, _, _ := tasks.CleanOneLine(r.Title, 50)
+            if withSource { fmt.Fprintf(tw, "%s\t", r.Source) }
+            fmt.Fprintf(tw, "%s\t%s\n", strings.Join(usageCells(r.ID, u), "\t"), title)
+        }
+        if withSource { fmt.Fprint(tw, "\t") }
+        fmt.Fprintf(tw, "%s\t\n", strings.Join(usageCells("TOTAL", sum), "\t"))
+        tw.Flush()
+    }
+}
+
+func usageCells(label string, u tasks.DiskUsage) []string {
+    return []string{label, tasks.FormatSize(u.Total()), tasks.FormatSize(u.Conversation), tasks.FormatSize(u.Images), tasks.FormatSize(u.Checkpoints), tasks.FormatSize(u.Other)}
+}
+
+// selectRows loads the tasks matching a query expression as rows.
+func selectRows(cfg config.Config, where string) []*tasks.Row {
+    q, err := tasks.ParseQuery(where)
+    if err != nil { log.Fatalf("invalid query: %v", err) }
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+    hist, err := tasks.HistoryIndex(cfg)
+    if err != nil && cfg.Debug { log.Printf("[du] taskHistory unavailable (workspace/mode empty): %v", err) }
+    rows := []*tasks.Row{}
+    for _, r := range tasks.NewRows(list, hist) {
+        if q.Match(r) { rows = append(rows, r) }
+    }
+    return rows
+}
+
+// setupCompact implements `roo-task-man compact`: move embedded images out of the
+// conversation JSON and garbage collect checkpoint repositories.
+func setupCompact(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        where  string
+        drop   bool
+        noGC   bool
+        dryRun bool
+        yes    bool
+    )
+    fs.StringVar(&where, "where", "", "compact the tasks matching this query instead of listing IDs")
+    fs.BoolVar(&drop, "drop-images", false, "discard embedded images instead of extracting them to compacted-images/")
+    fs.BoolVar(&noGC, "no-gc", false, "do not run git gc on checkpoint repositories")
+    fs.BoolVar(&dryRun, "dry-run", false, "only report what would be compacted")
+    fs.BoolVar(&dryRun, "n", false, "shorthand for --dry-run")
+    fs.BoolVar(&yes, "yes", false, "do not ask for confirmation")
+    fs.BoolVar(&yes, "y", false, "shorthand for --yes")
+    return func(cfg config.Config, args []string) {
+        refs := splitArgsCSV(args)
+        if len(refs) > 0 && where != "" { log.Fatal("compact: pass task IDs or --where, not both") }
+        var targets []tasks.Task
+        if len(refs) > 0 {
+            targets = resolveTasks(cfg, refs)
+        } else {
+            for _, r := range selectRows(cfg, where) { targets = append(targets, r.Task) }
+        }
+        if len(targets) == 0 { fmt.Println("no tasks matched"); return }
+        // The extension rewrites the conversation files of a task it has open.
+        if !dryRun { requireEditorClosed(cfg) }
+        if !dryRun && !yes {
+            what := "extract embedded images to compacted-images/"
+            if drop { what = "DROP embedded images" }
+            if !confirm(fmt.Sprintf("Compact %d task(s) (%s)?", len(targets), what)) { fmt.Println("canceled"); return }
+        }
+        opts := tasks.CompactOptions{DropImages: drop, NoGC: noGC, DryRun: dryRun}
+        var before, after, embedded int64
+        for _, t := range targets {
+            res, err := tasks.CompactTask(t, opts)
+            if err != nil { fmt.Fprintf(os.Stderr, "%s: %v\n", t.ID, err); continue }
+            before += res.Before
+            after += res.After
+            embedded += res.ImageBytes
+            for _, s := range res.Skipped { fmt.Fprintf(os.Stderr, "%s: skipped %s\n", t.ID, s) }
+            if res.Images == 0 && res.Repos == 0 { continue }
+            if dryRun {
+                fmt.Printf("%s: %d embedded image(s) (%s), %d checkpoint repo(s)\n", t.ID, res.Images, tasks.FormatSize(res.ImageBytes), res.Repos)
+                continue
+            }
+            fmt.Printf("%s: %s -> %s (%d image(s), %d new file(s), %d checkpoint repo(s) gc'd)\n", t.ID, tasks.FormatSize(res.Before), tasks.FormatSize(res.After), res.Images, res.Files, res.Repos)
+        }
+        if dryRun {
+            fmt.Printf("\n%d task(s), %s of embedded images would leave the conversation files; checkpoint savings depend on git gc\n", len(targets), tasks.FormatSize(embedded))
+            return
+        }
+        freed := "nothing freed"
+        if before > after { freed = "freed " + tasks.FormatSize(before-after) }
+        fmt.Printf("\n%d task(s): %s -> %s, %s\n", len(targets), tasks.FormatSize(before), tasks.FormatSize(after), freed)
+    }
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// globalFlags are the config/editor/plugin/data-dir options shared by every mode.
+type globalFlags struct {
+    cfgPath    string
+    pluginID   string
+    codeChan   string
+    editor     string
+    dataDir    string
+    userData   string
+    remoteHome string
+    hooksDir   string
+    exportDir  string
+    allSrc     bool
+    source     string
+    noCache    bool
+    debug      bool
+    force      bool
+    wait       bool
+}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+    fs.StringVar(&g.cfgPath, "config", filepath.Join(config.UserHome(), ".config", "roo-code-man.json"), "config file path")
+    fs.StringVar(&g.pluginID, "plugin-id", "", "VS Code extension plugin ID (overrides config)")
+    fs.StringVar(&g.codeChan, "code-channel", "", "Editor channel/name: Code | Insiders | VSCodium | Cursor | Windsurf | Trae | vscode-server | cursor-server | … | Custom | <AppDir>")
+    fs.StringVar(&g.editor, "editor", "", "Alias of --code-channel")
+    fs.StringVar(&g.dataDir, "data-dir", "", "override the plugin's globalStorage directory (state.vscdb is found when it sits in <User>/globalStorage/<plugin>)")
+    fs.StringVar(&g.userData, "user-data-dir", "", "editor user data dir, as passed to the editor's --user-data-dir or a portable install's data/ folder (task root and state DB derive from it)")
+    fs.StringVar(&g.remoteHome, "remote-home", "", "home directory holding .vscode-server/.cursor-server (e.g. a mounted remote home; default: local home)")
+    fs.StringVar(&g.hooksDir, "hooks-dir", "", "directory containing JS hook files")
+    fs.StringVar(&g.exportDir, "export-dir", "", "default export directory for TUI exports")
+    fs.BoolVar(&g.allSrc, "all-sources", false, "load tasks from every detected editor and Roo-compatible plugin")
+    fs.StringVar(&g.source, "source", "", "with all sources, keep those whose Editor:plugin-id contains this text (implies --all-sources)")
+    fs.BoolVar(&g.noCache, "no-cache", false, "re-read every task instead of using the metadata cache")
+    fs.BoolVar(&g.debug, "debug", false, "print debug info (paths, counts)")
+    fs.BoolVar(&g.force, "force", false, "write the editor's state DB even when the editor looks like it is running")
+    fs.BoolVar(&g.wait, "wait", false, "when the editor is running, wait for it to exit before writing its state DB")
+}
+
+// requireEditorClosed fails while cfg's editor is running (or, with --wait, polls until it
+// exits) before its state DB or task folders are written. --force skips the check.
+func requireEditorClosed(cfg config.Config) {
+    err := tasks.CheckEditorClosed(cfg)
+    if err == nil { return }
+    var running *tasks.EditorRunningError
+    if !cfg.WaitEditor || !errors.As(err, &running) { log.Fatalf("%v; --wait waits for it to exit", err) }
+    fmt.Fprintf(os.Stderr, "%s; waiting for %s to exit (Ctrl+C to cancel)...\n", running.Status, running.Status.Editor)
+    for tasks.CheckEditorClosed(cfg) != nil { time.Sleep(2 * time.Second) }
+}
+
+// config loads the config file and merges the command-line overrides.
+func (g *globalFlags) config() config.Config {
+    cfg := config.Default()
+    if err := config.Load(g.cfgPath, &cfg); err != nil && !os.IsNotExist(err) {
+        log.Printf("warning: failed to load config: %v", err)
+    }
+    // Merge overrides
+    if g.pluginID != "" {
+        cfg.PluginID = g.pluginID
+    }
+    if g.codeChan != "" {
+        cfg.CodeChannel = g.codeChan
+    }
+    if g.editor != "" { // alias honors last-specified
+        cfg.CodeChannel = g.editor
+    }
+    if g.dataDir != "" {
+        cfg.DataDir = g.dataDir
+    }
+    if g.userData != "" {
+        cfg.UserDataDir = g.userData
+    }
+    if g.remoteHome != "" {
+        cfg.RemoteHome = g.remoteHome
+    }
+    if g.hooksDir != "" {
+        cfg.HooksDir = g.hooksDir
+    }
+    if g.exportDir != "" {
+        cfg.ExportDir = g.exportDir
+    }
+    if g.allSrc {
+        cfg.AllSources = true
+    }
+    if g.source != "" {
+        cfg.Source = g.source
+    }
+    if g.noCache {
+        cfg.NoCache = true
+    }
+    if g.debug {
+        cfg.Debug = true
+    }
+    cfg.Force = g.force
+    cfg.WaitEditor = g.wait
+    return cfg
+}
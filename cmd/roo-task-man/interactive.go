@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/tui"
+	"roocode-task-man/internal/zipper"
+)
+
+func setupRestore(fs *flag.FlagSet) func(config.Config, []string) {
+    return func(cfg config.Config, _ []string) { restoreInteractive(cfg) }
+}
+
+func restoreInteractive(cfg config.Config) {
+    requireEditorClosed(cfg)
+    infos, dir, err := tasks.ListBackups(cfg)
+    snaps, serr := tasks.ListSnapshots(cfg)
+    if err != nil && len(snaps) == 0 { log.Fatalf("list backups: %v", err) }
+    if serr != nil && cfg.Debug { log.Printf("[restore] snapshots: %v", serr) }
+    if len(infos) == 0 && len(snaps) == 0 { fmt.Println("no backups found"); return }
+    rm := tui.NewRestore(cfg, infos, snaps, dir)
+    p := tea.NewProgram(rm)
+    res, err := p.Run()
+    if err != nil { log.Fatalf("restore TUI error: %v", err) }
+    if snap, picks := res.(tui.RestoreModel).SelectedSnapshot(); snap != nil {
+        restoreSnapshot(cfg, *snap, picks)
+        return
+    }
+    if suffix, ids := res.(tui.RestoreModel).SelectedEntries(); len(ids) > 0 {
+        if err := tasks.RestoreBackupEntries(cfg, suffix, ids); err != nil { log.Fatalf("restore failed: %v", err) }
+        fmt.Printf("merged %d taskHistory entries back from backup %s: %s\n", len(ids), suffix, strings.Join(ids, ", "))
+        return
+    }
+    sel := res.(tui.RestoreModel).Selected()
+    if sel == "" { fmt.Println("restore canceled"); return }
+    if err := tasks.RestoreFromBackup(cfg, sel, cfg.Debug); err != nil {
+        log.Fatalf("restore failed: %v", err)
+    }
+    fmt.Printf("restored state DBs from suffix %s\n", sel)
+}
+
+func setupInspect(fs *flag.FlagSet) func(config.Config, []string) {
+    return func(cfg config.Config, args []string) {
+        if len(args) != 1 { log.Fatal("inspect: exactly one <zip> is required") }
+        runTUI(cfg, args[0])
+    }
+}
+
+func setupTUI(fs *flag.FlagSet) func(config.Config, []string) {
+    return func(cfg config.Config, _ []string) { runTUI(cfg, "") }
+}
+
+// runTUI opens the task browser, optionally on the extracted contents of inspectZip.
+// Without a terminal it prints a plain id/title list instead.
+func runTUI(cfg config.Config, inspectZip string) {
+    // Inspect zip mode: extract to temp and point DataDir there
+    var cleanup func()
+    if inspectZip != "" {
+        tmp, err := os.MkdirTemp("", "roo-task-inspect-*")
+        if err != nil { log.Fatalf("mktemp: %v", err) }
+        if err := zipper.ImportAny(inspectZip, tmp); err != nil { log.Fatalf("inspect import failed: %v", err) }
+        cleanup = func() { _ = os.RemoveAll(tmp) }
+        cfg.DataDir = tmp
+        cfg.CodeChannel = "Custom"
+        cfg.BackupEvery = "" // nothing worth snapshotting
+    }
+
+    if !(term.IsTerminal(int(os.Stdin.Fd())) || term.IsTerminal(int(os.Stdout.Fd()))) {
+        list, err := tasks.LoadTasks(cfg)
+        if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+        fmt.Printf("%d tasks\n", len(list))
+        for _, t := range list { fmt.Printf("%s\t%s\n", t.ID, t.Title) }
+        if cleanup != nil { cleanup() }
+        return
+    }
+    if inspectZip == "" && !tasks.MultiSource(cfg) { cfg = pickSourceIfEmpty(cfg) }
+    model := tui.New(cfg)
+    p := tea.NewProgram(model)
+    if _, err := p.Run(); err != nil {
+        log.Fatalf("tui error: %v", err)
+    }
+    if cleanup != nil { cleanup() }
+}
+
+// pickSourceIfEmpty offers a source picker when the configured editor/plugin has no
+// tasks but other detected sources do. It returns cfg unchanged when there is nothing
+// to pick or the picker is dismissed.
+func pickSourceIfEmpty(cfg config.Config) config.Config {
+    if list, err := tasks.LoadTasks(cfg); err == nil && len(list) > 0 { return cfg }
+    eds, err := tasks.ScanEditors(cfg)
+    if err != nil { return cfg }
+    var found []tasks.SourceInfo
+    for _, e := range eds {
+        for _, s := range e.Sources { if s.TaskDirs > 0 { found = append(found, s) } }
+    }
+    if len(found) == 0 { return cfg }
+    current := tasks.ConfiguredLabel(cfg)
+    res, err := tea.NewProgram(tui.NewSourcePicker(current, found)).Run()
+    if err != nil { log.Fatalf("source picker error: %v", err) }
+    src, all, ok := res.(tui.SourcePickerModel).Selected()
+    switch {
+    case !ok:
+        return cfg
+    case all:
+        cfg.AllSources = true
+        return cfg
+    }
+    return src.Config(cfg)
+}
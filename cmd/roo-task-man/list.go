@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// listRecord is the JSON/NDJSON shape of one listed task.
+type listRecord struct {
+    ID        string    `json:"id"`
+    Title     string    `json:"title"`
+    CreatedAt time.Time `json:"createdAt"`
+    Path      string    `json:"path"`
+    Workspace string    `json:"workspace,omitempty"`
+    Mode      string    `json:"mode,omitempty"`
+    Source    string    `json:"source,omitempty"`
+    TokensIn  int       `json:"tokensIn"`
+    TokensOut int       `json:"tokensOut"`
+    Cost      float64   `json:"cost"`
+    Size      int64     `json:"size"`
+    Messages  int       `json:"messages"`
+}
+
+// setupList implements `roo-task-man list`: a non-interactive, scriptable task listing.
+func setupList(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        where    string
+        sortSpec string
+        format   string
+        tmplText string
+        limit    int
+        noHeader bool
+    )
+    fs.StringVar(&where, "where", "", "query expression, e.g. 'cost>5 and created>=2025-12-01' (fields: "+strings.Join(tasks.QueryFieldNames(), ", ")+")")
+    fs.StringVar(&sortSpec, "sort", "", "comma-separated sort fields; prefix with - for descending (default: -created)")
+    fs.StringVar(&format, "format", "table", "output format: table | json | ndjson | tsv | ids | template")
+    fs.StringVar(&tmplText, "template", "", "Go text/template applied to each task (implies --format template)")
+    fs.IntVar(&limit, "limit", 0, "print at most N tasks (0 = all)")
+    fs.BoolVar(&noHeader, "no-header", false, "omit the header row for table/tsv")
+    return func(cfg config.Config, args []string) {
+        if len(args) > 0 && where == "" { where = strings.Join(args, " ") }
+        if tmplText != "" { format = "template" }
+
+        q, err := tasks.ParseQuery(where)
+        if err != nil { log.Fatalf("invalid --where: %v", err) }
+        list, err := tasks.LoadTasks(cfg)
+        if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+        hist, err := tasks.HistoryIndex(cfg)
+        if err != nil && cfg.Debug { log.Printf("[list] taskHistory unavailable (workspace/mode empty): %v", err) }
+
+        rows := []*tasks.Row{}
+        for _, r := range tasks.NewRows(list, hist) {
+            if q.Match(r) { rows = append(rows, r) }
+        }
+        if err := tasks.SortRows(rows, sortSpec); err != nil { log.Fatalf("invalid --sort: %v", err) }
+        if limit > 0 && len(rows) > limit { rows = rows[:limit] }
+        if err := writeRows(os.Stdout, rows, format, tmplText, !noHeader, tasks.MultiSource(cfg)); err != nil { log.Fatalf("list: %v", err) }
+    }
+}
+
+// writeRows prints rows in format; withSource adds a source column to table and tsv.
+func writeRows(w io.Writer, rows []*tasks.Row, format, tmplText string, header, withSource bool) error {
+    switch format {
+    case "ids":
+        for _, r := range rows { fmt.Fprintln(w, r.ID) }
+    case "json":
+        recs := make([]listRecord, 0, len(rows))
+        for _, r := range rows { recs = append(recs, toRecord(r)) }
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        return enc.Encode(recs)
+    case "ndjson":
+        enc := json.NewEncoder(w)
+        for _, r := range rows {
+            if err := enc.Encode(toRecord(r)); err != nil { return err }
+        }
+    case "tsv":
+        if header {
+            if withSource { fmt.Fprint(w, "source\t") }
+            fmt.Fprintln(w, "id\tcreated\tcost\tmode\tworkspace\ttitle")
+        }
+        for _, r := range rows {
+            title, _, _ := tasks.CleanOneLine(r.Title, 0)
+            if withSource { fmt.Fprintf(w, "%s\t", r.Source) }
+            fmt.Fprintf(w, "%s\t%s\t%.4f\t%s\t%s\t%s\n", r.ID, r.CreatedAt.Local().Format(time.RFC3339), r.Stats().TotalCost, r.Mode, r.Workspace, title)
+        }
+    case "table":
+        tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+        if header {
+            if withSource { fmt.Fprint(tw, "SOURCE\t") }
+            fmt.Fprintln(tw, "ID\tCREATED\tCOST\tMODE\tWORKSPACE\tTITLE")
+        }
+        for _, r := range rows {
+            title, _, _ := tasks.CleanOneLine(r.Title, 60)
+            if withSource { fmt.Fprintf(tw, "%s\t", r.Source) }
+            fmt.Fprintf(tw, "%s\t%s\t$%.2f\t%s\t%s\t%s\n", r.ID, r.CreatedAt.Local().Format("2006-01-02 15:04"), r.Stats().TotalCost, r.Mode, r.Workspace, title)
+        }
+        return tw.Flush()
+    case "template":
+        if tmplText == "" { return fmt.Errorf("--format template requires --template") }
+        if !strings.HasSuffix(tmplText, "\n") { tmplText += "\n" }
+        tmpl, err := template.New("list").Parse(tmplText)
+        if err != nil { return fmt.Errorf("parse template: %w", err) }
+        for _, r := range rows {
+            if err := tmpl.Execute(w, r); err != nil { return err }
+        }
+    default:
+        return fmt.Errorf("unknown format %q", format)
+    }
+    return nil
+}
+
+func toRecord(r *tasks.Row) listRecord {
+    st := r.Stats()
+    return listRecord{
+        ID: r.ID, Title: r.Title, CreatedAt: r.CreatedAt, Path: r.Path,
+        Workspace: r.Workspace, Mode: r.Mode, Source: r.Source,
+        TokensIn: st.TokensIn, TokensOut: st.TokensOut, Cost: st.TotalCost, Size: st.SizeBytes,
+        Messages: r.Messages(),
+    }
+}
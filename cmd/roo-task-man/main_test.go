@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLegacyMode(t *testing.T) {
+    cases := map[string]string{
+        "":                                          "tui",
+        "--inspect a.zip":                           "tui",
+        "--version --export a:b.zip":                "version",
+        "--restore --dump out.md":                   "restore",
+        "--dump out.md --taskids a":                 "dump",
+        "--export abc:out.zip":                      "export-single",
+        "--export abc:out.zip --workspace /w":       "export-single",
+        "--export out.zip --workspace /w":           "export",
+        "--export out.zip --query login":            "export",
+        "--taskids a,b":                             "export",
+        "--date-range 2025-01-01..2025-02-01":       "export",
+        "--import in.zip":                           "import",
+        "--import in.zip --workspace /w":            "import",
+        "--config c.json --editor Cursor --import x": "import",
+    }
+    for args, want := range cases {
+        var l legacyFlags
+        fs := flag.NewFlagSet("legacy", flag.ContinueOnError)
+        fs.SetOutput(io.Discard)
+        l.register(fs)
+        if err := fs.Parse(strings.Fields(args)); err != nil { t.Errorf("%q: %v", args, err); continue }
+        if got := l.mode(); got != want { t.Errorf("%q: got %s want %s", args, got, want) }
+    }
+}
+
+func TestCommandFlags(t *testing.T) {
+    for _, c := range commands {
+        if findCommand(c.name) == nil { t.Fatalf("%s: not found", c.name) }
+        // registering a flag twice (e.g. a command flag shadowing a global one) panics here
+        fs, _, run := c.flagSet()
+        if run == nil { t.Fatalf("%s: no run function", c.name) }
+        var b bytes.Buffer
+        c.printHelp(&b, fs)
+        if !strings.HasPrefix(b.String(), "Usage: roo-task-man "+c.name) || !strings.Contains(b.String(), "-config") {
+            t.Errorf("%s: help is missing usage or global flags:\n%s", c.name, b.String())
+        }
+    }
+    if findCommand("bogus") != nil { t.Fatalf("found an unknown command") }
+}
+
+func TestParseInterspersed(t *testing.T) {
+    cases := []struct {
+        args string
+        want string // positional args, then the --raw and --role values
+    }{
+        {"abc", "abc|false|"},
+        {"abc --raw", "abc|true|"},
+        {"--raw abc --role user def", "abc,def|true|user"},
+        {"abc -- --raw", "abc,--raw|false|"},
+        {"--role=ai -- -x", "-x|false|ai"},
+    }
+    for _, tc := range cases {
+        fs := flag.NewFlagSet("t", flag.ContinueOnError)
+        raw := fs.Bool("raw", false, "")
+        role := fs.String("role", "", "")
+        pos := parseInterspersed(fs, strings.Fields(tc.args))
+        got := strings.Join(pos, ",") + "|" + map[bool]string{true: "true", false: "false"}[*raw] + "|" + *role
+        if got != tc.want { t.Errorf("%q: got %q want %q", tc.args, got, tc.want) }
+    }
+}
+
+func TestParseExportArg(t *testing.T) {
+    id, zip, err := parseExportArg("abc:out/x.zip")
+    if err != nil || id != "abc" || zip != "out/x.zip" { t.Fatalf("got %q %q %v", id, zip, err) }
+    if _, _, err := parseExportArg("out.zip"); err == nil { t.Fatalf("expected an error without a colon") }
+    if got := strings.Join(splitArgsCSV([]string{"a, b", "", "c"}), "|"); got != "a|b|c" { t.Fatalf("splitArgsCSV: %q", got) }
+}
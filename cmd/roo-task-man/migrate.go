@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// rewriteFlags collects repeatable --rewrite from=to rules.
+type rewriteFlags []tasks.PathRewrite
+
+func (r *rewriteFlags) String() string {
+    parts := make([]string, 0, len(*r))
+    for _, rw := range *r { parts = append(parts, rw.From+"="+rw.To) }
+    return strings.Join(parts, ",")
+}
+
+func (r *rewriteFlags) Set(s string) error {
+    rw, err := tasks.ParsePathRewrite(s)
+    if err != nil { return err }
+    *r = append(*r, rw)
+    return nil
+}
+
+// setupMigrate implements `roo-task-man migrate`: copy tasks between editors and
+// extension forks and register them in the target editor's history.
+func setupMigrate(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        ff        filterFlags
+        from, to  string
+        rewrites  rewriteFlags
+        overwrite bool
+        dryRun    bool
+    )
+    ff.register(fs)
+    fs.StringVar(&from, "from", "", "source Editor:plugin-id (plugin defaults to --plugin-id), e.g. Cursor:kilocode.kilo-code")
+    fs.StringVar(&to, "to", "", "target Editor:plugin-id, e.g. Code:RooVeterinaryInc.roo-cline")
+    fs.Var(&rewrites, "rewrite", "rewrite workspace paths: from=to (repeatable; longest prefix wins)")
+    fs.BoolVar(&overwrite, "overwrite", false, "replace tasks that already exist in the target")
+    fs.BoolVar(&dryRun, "dry-run", false, "show what would be copied without writing anything")
+    return func(cfg config.Config, args []string) {
+        if from == "" || to == "" { log.Fatal("migrate: --from and --to are required") }
+        src, err := tasks.ParseSource(from, cfg)
+        if err != nil { log.Fatalf("--from: %v", err) }
+        dst, err := tasks.ParseSource(to, cfg)
+        if err != nil { log.Fatalf("--to: %v", err) }
+        filter := ff.filter(splitArgsCSV(args))
+        if filter.IsZero() { log.Fatal("migrate: give task IDs or at least one filter (--taskids, --date-range, --workspace, --query)") }
+
+        if !dryRun { requireEditorClosed(dst.Config(cfg)) }
+        results, err := tasks.MigrateTasks(tasks.MigrateOptions{
+            From: src, To: dst, Filter: filter, Rewrites: rewrites,
+            Overwrite: overwrite, DryRun: dryRun, Config: cfg,
+        })
+        copied := 0
+        for _, r := range results {
+            if r.Skipped != "" { fmt.Printf("skipped %s: %s\n", r.ID, r.Skipped); continue }
+            copied++
+            ws := r.Workspace
+            if ws == "" { ws = "(no workspace)" }
+            fmt.Printf("%s %s -> %s  workspace %s\n", verb(dryRun, "would copy", "copied"), r.ID, r.Dest, ws)
+        }
+        if err != nil { log.Fatalf("migrate failed: %v", err) }
+        fmt.Printf("%s %d task(s) from %s to %s\n", verb(dryRun, "would migrate", "migrated"), copied, src.Label(), dst.Label())
+    }
+}
+
+func verb(dryRun bool, would, did string) string {
+    if dryRun { return would }
+    return did
+}
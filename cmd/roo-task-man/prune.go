@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/zipper"
+)
+
+// setupPrune implements `roo-task-man prune`: delete the tasks matched by the "prune"
+// rules of the config, archiving them first where a rule (or --archive-to) asks for it.
+func setupPrune(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        dryRun    bool
+        yes       bool
+        permanent bool
+        archiveTo string
+    )
+    fs.BoolVar(&dryRun, "dry-run", false, "only print what would be pruned")
+    fs.BoolVar(&dryRun, "n", false, "shorthand for --dry-run")
+    fs.BoolVar(&yes, "yes", false, "do not ask for confirmation")
+    fs.BoolVar(&yes, "y", false, "shorthand for --yes")
+    fs.BoolVar(&permanent, "permanent", false, "delete for good instead of moving to the trash")
+    fs.StringVar(&archiveTo, "archive-to", "", "export every pruned task to <dir>/<id>.zip before deleting it (default for archive rules: archiveDir from the config)")
+    return func(cfg config.Config, args []string) {
+        if len(args) > 0 { log.Fatal("prune: takes no arguments; rules come from the \"prune\" list of the config") }
+        if len(cfg.Prune) == 0 { log.Fatal("prune: no rules; add a \"prune\" list to the config (see README)") }
+        list, err := tasks.LoadTasks(cfg)
+        if err != nil { log.Fatalf("failed to load tasks: %v", err) }
+        // Without taskHistory favorites are not protected and every task falls into one
+        // keepPerWorkspace bucket, so only prune on an explicit --yes.
+        hist, histErr := tasks.HistoryIndex(cfg)
+        if histErr != nil {
+            fmt.Fprintf(os.Stderr, "warning: taskHistory unavailable (%v): favorites are not protected and keepPerWorkspace sees a single workspace\n", histErr)
+        }
+        cands, err := tasks.PlanPrune(tasks.NewRows(list, hist), cfg.Prune)
+        if err != nil { log.Fatalf("prune: %v", err) }
+        if len(cands) == 0 { fmt.Println("nothing to prune"); return }
+
+        dir := archiveTo
+        if dir == "" { dir = cfg.ArchiveDir }
+        archiveAll := archiveTo != ""
+        needArchive := false
+        for i := range cands {
+            cands[i].Archive = cands[i].Archive || archiveAll
+            needArchive = needArchive || cands[i].Archive
+        }
+        action := "trash"
+        if permanent { action = "delete" }
+        printPrunePlan(cands, action, tasks.MultiSource(cfg))
+        if dryRun { return }
+        if histErr != nil && !yes { log.Fatal("prune: refusing without taskHistory; check the plan above and pass --yes to prune anyway") }
+        if needArchive && dir == "" { log.Fatal("prune: a rule asks for an archive; pass --archive-to <dir> or set archiveDir in the config") }
+        requireEditorClosed(cfg)
+        if !yes && !confirm(fmt.Sprintf("Prune %d task(s)?", len(cands))) { fmt.Println("canceled"); return }
+
+        var doomed []tasks.Task
+        var freed int64
+        for _, c := range cands {
+            if c.Archive {
+                t := c.Task
+                t.Workspace = c.Workspace
+                zipPath, err := archiveTask(t, dir)
+                if err != nil {
+                    fmt.Fprintf(os.Stderr, "skipping %s: archive failed: %v\n", c.ID, err)
+                    continue
+                }
+                fmt.Printf("archived %s -> %s\n", c.ID, zipPath)
+            }
+            doomed = append(doomed, c.Task)
+            freed += c.Stats().SizeBytes
+        }
+        if permanent {
+            if err := tasks.PurgeTasks(cfg, doomed); err != nil { log.Fatalf("prune: %v", err) }
+            fmt.Printf("deleted %d task(s), freed %s\n", len(doomed), tasks.FormatSize(freed))
+            return
+        }
+        entries, err := tasks.TrashTasks(cfg, doomed)
+        if err != nil { log.Fatalf("prune: %v", err) }
+        fmt.Printf("moved %d task(s) (%s) to the trash; `roo-task-man trash empty` frees the space now\n", len(entries), tasks.FormatSize(freed))
+    }
+}
+
+// printPrunePlan prints the dry-run table and totals.
+func printPrunePlan(cands []tasks.PruneCandidate, action string, withSource bool) {
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    if withSource { fmt.Fprint(tw, "SOURCE\t") }
+    fmt.Fprintln(tw, "ID\tCREATED\tCOST\tMSGS\tSIZE\tWORKSPACE\tACTION\tRULES")
+    var total int64
+    archived := 0
+    for _, c := range cands {
+        st := c.Stats()
+        total += st.SizeBytes
+        act := action
+        if c.Archive { act = "archive+" + action; archived++ }
+        if withSource { fmt.Fprintf(tw, "%s\t", c.Source) }
+        fmt.Fprintf(tw, "%s\t%s\t$%.2f\t%d\t%s\t%s\t%s\t%s\n", c.ID, c.CreatedAt.Local().Format("2006-01-02"), st.TotalCost, c.Messages(), tasks.FormatSize(st.SizeBytes), c.Workspace, act, strings.Join(c.Rules, "; "))
+    }
+    tw.Flush()
+    fmt.Printf("\n%d task(s), %s", len(cands), tasks.FormatSize(total))
+    if archived > 0 { fmt.Printf(", %d archived first", archived) }
+    fmt.Println()
+}
+
+// archiveTask exports t to <dir>/<id>.zip, refusing to overwrite an existing archive.
+func archiveTask(t tasks.Task, dir string) (string, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil { return "", err }
+    zipPath := filepath.Join(dir, t.ID+".zip")
+    if _, err := os.Stat(zipPath); err == nil { return "", fmt.Errorf("%s already exists", zipPath) }
+    if err := zipper.ExportTask(t, zipPath); err != nil {
+        os.Remove(zipPath)
+        return "", err
+    }
+    return zipPath, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/glamour"
+	"golang.org/x/term"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/hooks"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/tui"
+)
+
+func setupShow(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        raw     bool
+        noPager bool
+        role    string
+        since   string
+        until   string
+        last    int
+    )
+    fs.BoolVar(&raw, "raw", false, "print plain Markdown instead of rendering it")
+    fs.BoolVar(&noPager, "no-pager", false, "never pipe output through $PAGER")
+    fs.StringVar(&role, "role", "", "only show history entries from: user | ai")
+    fs.StringVar(&since, "since", "", "only show entries at or after: YYYY-MM-DD, 'YYYY-MM-DD HH:MM', RFC3339, or an age like 2h/3d")
+    fs.StringVar(&until, "until", "", "only show entries at or before (same formats as --since)")
+    fs.IntVar(&last, "last", 0, "only show the last N history entries (after --role/--since/--until)")
+    return func(cfg config.Config, args []string) {
+        if len(args) != 1 { log.Fatal("show: exactly one <task-id> is required") }
+        if last < 0 { log.Fatalf("show: --last must not be negative, got %d", last) }
+        opts := tui.DetailOptions{Role: role, Last: last}
+        if role != "" && role != "user" && role != "ai" { log.Fatalf("show: --role must be user or ai, got %q", role) }
+        var err error
+        if since != "" {
+            if opts.Since, err = parseTimeArg(since, false); err != nil { log.Fatalf("show: --since: %v", err) }
+        }
+        if until != "" {
+            if opts.Until, err = parseTimeArg(until, true); err != nil { log.Fatalf("show: --until: %v", err) }
+        }
+        t := findTask(cfg, args[0])
+        hooks.EnableDebug(cfg.Debug)
+        env, _ := hooks.LoadDir(cfg.HooksDir)
+        out := tui.RenderDetailMarkdown(t, env, opts, cfg.Debug)
+
+        tty := term.IsTerminal(int(os.Stdout.Fd()))
+        if !raw {
+            width := 100
+            if tty {
+                if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 { width = w }
+            }
+            style := glamour.WithAutoStyle()
+            if !tty { style = glamour.WithStandardStyle("notty") }
+            if r, err := glamour.NewTermRenderer(style, glamour.WithWordWrap(width)); err == nil {
+                if s, err2 := r.Render(out); err2 == nil { out = s }
+            }
+        }
+        if tty && !noPager {
+            if _, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && strings.Count(out, "\n") >= h {
+                if page(out) == nil { return }
+            }
+        }
+        fmt.Print(out)
+    }
+}
+
+// page pipes s through $PAGER (default "less -R").
+func page(s string) error {
+    pager := os.Getenv("PAGER")
+    if pager == "" { pager = "less -R" }
+    parts := strings.Fields(pager)
+    cmd := exec.Command(parts[0], parts[1:]...)
+    cmd.Stdin = strings.NewReader(s)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    return cmd.Run()
+}
+
+// parseTimeArg parses an absolute time (date, date + HH:MM, RFC3339) or an age
+// relative to now (90m, 2h, 3d, 1w). A bare date used as an upper bound means the
+// end of that day.
+func parseTimeArg(s string, endOfDay bool) (time.Time, error) {
+    s = strings.TrimSpace(s)
+    if t, err := time.Parse(time.RFC3339, s); err == nil { return t, nil }
+    if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil { return t, nil }
+    if d, err := tasks.ParseDay(s); err == nil {
+        if endOfDay { return d.Add(24*time.Hour - time.Millisecond), nil }
+        return d, nil
+    }
+    if d, err := tasks.ParseAge(s); err == nil { return time.Now().Add(-d), nil }
+    return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
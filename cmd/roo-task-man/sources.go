@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// setupSources implements `roo-task-man sources`: report installed editors and the
+// Roo-compatible extensions found in each, so --editor/--plugin-id need no guessing.
+func setupSources(fs *flag.FlagSet) func(config.Config, []string) {
+    var asJSON bool
+    fs.BoolVar(&asJSON, "json", false, "print the scan as JSON")
+    return func(cfg config.Config, _ []string) {
+        eds, err := tasks.ScanEditors(cfg)
+        if err != nil { log.Fatalf("scan editors: %v", err) }
+        if asJSON {
+            enc := json.NewEncoder(os.Stdout)
+            enc.SetIndent("", "  ")
+            if err := enc.Encode(eds); err != nil { log.Fatal(err) }
+            return
+        }
+        if len(eds) == 0 { fmt.Println("no known editors found"); return }
+        current := tasks.ConfiguredLabel(cfg)
+        for _, e := range eds {
+            fmt.Printf("%s  %s\n", e.Editor, e.Dir)
+            if e.StateDB != "" {
+                fmt.Printf("  state DB: %s (%s)\n", e.StateDB, tasks.FormatSize(e.StateDBSize))
+            } else {
+                fmt.Printf("  state DB: none\n")
+            }
+            if len(e.Sources) == 0 { fmt.Printf("  no Roo-compatible extensions\n\n"); continue }
+            tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+            fmt.Fprintln(tw, "  \tPLUGIN\tTASKS\tHISTORY\tPATH")
+            for _, s := range e.Sources {
+                mark := ""
+                if s.Label() == current { mark = "*" }
+                path := s.Root
+                if !s.HasStorage { path = "(taskHistory only, no storage folder)" }
+                fmt.Fprintf(tw, "  %s\t%s\t%d\t%d\t%s\n", mark, s.PluginID, s.TaskDirs, s.HistoryEntries, path)
+            }
+            tw.Flush()
+            fmt.Println()
+        }
+        fmt.Println("* = configured default. Use with: --editor <Editor> --plugin-id <PLUGIN>, or --all-sources.")
+    }
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+	"roocode-task-man/internal/tui"
+)
+
+// setupState implements `roo-task-man state [list|show|export|import]`: browse the
+// extension's keys in state.vscdb (settings, API profiles, custom modes, …) and copy
+// chosen keys between machines.
+func setupState(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        asJSON bool
+        reveal bool
+        out    string
+        dryRun bool
+        yes    bool
+    )
+    fs.BoolVar(&asJSON, "json", false, "list: print JSON")
+    fs.BoolVar(&reveal, "reveal", false, "show/export: do not mask API keys, tokens and passwords")
+    fs.StringVar(&out, "out", "", "export: file to write (default <editor>-<plugin>-state-<time>.json in the export dir)")
+    fs.StringVar(&out, "o", "", "shorthand for --out")
+    fs.BoolVar(&dryRun, "dry-run", false, "import: only print what would change")
+    fs.BoolVar(&dryRun, "n", false, "shorthand for --dry-run")
+    fs.BoolVar(&yes, "yes", false, "import: do not ask for confirmation")
+    fs.BoolVar(&yes, "y", false, "shorthand for --yes")
+    return func(cfg config.Config, args []string) {
+        if len(args) == 0 {
+            if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+                stateInteractive(cfg)
+                return
+            }
+            args = []string{"list"}
+        }
+        sub, args := args[0], args[1:]
+        switch sub {
+        case "list", "ls":
+            stateList(cfg, asJSON)
+        case "show":
+            if len(args) == 0 { log.Fatal("state show: at least one <key> is required (see `state list`)") }
+            stateShow(cfg, args, reveal)
+        case "export":
+            stateExport(cfg, splitArgsCSV(args), out, reveal)
+        case "import":
+            if len(args) == 0 { log.Fatal("state import: an export <file> is required, optionally followed by keys") }
+            stateImport(cfg, args[0], splitArgsCSV(args[1:]), dryRun, yes)
+        default:
+            log.Fatalf("state: unknown subcommand %q (want list, show, export or import)", sub)
+        }
+    }
+}
+
+func stateList(cfg config.Config, asJSON bool) {
+    keys, err := tasks.ListStateKeys(cfg)
+    if err != nil { log.Fatalf("state: %v", err) }
+    if asJSON {
+        type row struct {
+            Name   string `json:"name"`
+            Row    string `json:"row"`
+            Kind   string `json:"kind"`
+            Size   int    `json:"size"`
+            Secret bool   `json:"secret,omitempty"`
+        }
+        rows := make([]row, 0, len(keys))
+        for _, k := range keys { rows = append(rows, row{Name: k.Name, Row: k.Row, Kind: k.Kind, Size: k.Size, Secret: k.Secret}) }
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(rows); err != nil { log.Fatal(err) }
+        return
+    }
+    if len(keys) == 0 { fmt.Printf("no state for %s in %s\n", cfg.PluginID, tasks.DisplayEditorName(cfg.CodeChannel)); return }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "KEY\tKIND\tSIZE\tSUMMARY")
+    for _, k := range keys {
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k.Name, k.Kind, tasks.FormatSize(int64(k.Size)), tui.StateSummary(k))
+    }
+    tw.Flush()
+}
+
+func stateShow(cfg config.Config, names []string, reveal bool) {
+    keys, err := tasks.ListStateKeys(cfg)
+    if err != nil { log.Fatalf("state: %v", err) }
+    for i, name := range names {
+        k, err := tasks.FindStateKey(keys, name)
+        if err != nil { log.Fatalf("state show: %v", err) }
+        if len(names) > 1 {
+            if i > 0 { fmt.Println() }
+            fmt.Printf("== %s\n", k.Name)
+        }
+        if k.Secret { fmt.Println("(encrypted by the editor's secret storage)"); continue }
+        v := k.Value
+        if !reveal { v, _ = tasks.MaskSecrets(v) }
+        fmt.Println(tasks.PrettyJSON(v))
+    }
+}
+
+func stateExport(cfg config.Config, names []string, out string, reveal bool) {
+    exp, err := tasks.ExportStateKeys(cfg, names, reveal)
+    if err != nil { log.Fatalf("state export: %v", err) }
+    if out == "" { out = tui.StateExportPath(cfg) }
+    if err := tasks.WriteStateExport(out, exp); err != nil { log.Fatalf("state export: %v", err) }
+    fmt.Printf("exported %d keys to %s\n", len(exp.Keys), out)
+    if exp.Masked > 0 { fmt.Printf("%d secret values were masked; importing keeps the target's own values for them (use --reveal to include them)\n", exp.Masked) }
+}
+
+func stateImport(cfg config.Config, path string, names []string, dryRun, yes bool) {
+    exp, err := tasks.ReadStateExport(path)
+    if err != nil { log.Fatalf("state import: %v", err) }
+    if exp.PluginID != cfg.PluginID { fmt.Printf("note: %s was exported from %s, importing into %s\n", path, exp.PluginID, cfg.PluginID) }
+    plan, err := tasks.ImportStateKeys(cfg, exp, names, true)
+    if err != nil { log.Fatalf("state import: %v", err) }
+    n := printStatePlan(plan)
+    if dryRun || n == 0 { return }
+    requireEditorClosed(cfg)
+    if !yes && !confirm(fmt.Sprintf("Write %d keys to %s's state DB?", n, tasks.DisplayEditorName(cfg.CodeChannel))) { fmt.Println("import canceled"); return }
+    if _, err := tasks.ImportStateKeys(cfg, exp, names, false); err != nil { log.Fatalf("state import: %v", err) }
+    fmt.Printf("imported %d keys (the previous state DB was backed up; see `restore`)\n", n)
+}
+
+// printStatePlan prints what an import does to each key and returns how many change.
+func printStatePlan(plan []tasks.StateChange) int {
+    n := 0
+    for _, c := range plan {
+        fmt.Printf("  %-8s %s\n", c.Kind, c.Name)
+        if c.Kind != "same" { n++ }
+    }
+    if n == 0 { fmt.Println("nothing to import: every key already has the exported value") }
+    return n
+}
+
+func stateInteractive(cfg config.Config) {
+    keys, err := tasks.ListStateKeys(cfg)
+    if err != nil { log.Fatalf("state: %v", err) }
+    if len(keys) == 0 { fmt.Printf("no state for %s in %s\n", cfg.PluginID, tasks.DisplayEditorName(cfg.CodeChannel)); return }
+    if _, err := tea.NewProgram(tui.NewState(cfg, keys), tea.WithAltScreen()).Run(); err != nil { log.Fatalf("state TUI error: %v", err) }
+}
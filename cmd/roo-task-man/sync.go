@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/syncer"
+	"roocode-task-man/internal/tasks"
+)
+
+// setupSync implements `roo-task-man sync`: push and pull tasks through a directory
+// shared between machines.
+func setupSync(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        remote   string
+        push     bool
+        pull     bool
+        prefer   string
+        register bool
+        rewrites rewriteFlags
+        dryRun   bool
+    )
+    fs.StringVar(&remote, "remote", "", "shared directory to sync with (default: syncRemote from the config)")
+    fs.BoolVar(&push, "push", false, "only send local changes")
+    fs.BoolVar(&pull, "pull", false, "only fetch remote changes")
+    fs.StringVar(&prefer, "prefer", "", "settle tasks changed on both sides: local, remote or newer (default: report them)")
+    fs.BoolVar(&register, "register", false, "add pulled tasks to the editor's taskHistory")
+    fs.Var(&rewrites, "rewrite", "with --register, map the other machine's workspace paths: from=to (repeatable; combined with pathMap, longest prefix wins)")
+    fs.BoolVar(&dryRun, "dry-run", false, "show what would be transferred without changing anything")
+    fs.BoolVar(&dryRun, "n", false, "shorthand for --dry-run")
+    return func(cfg config.Config, args []string) {
+        if remote == "" { remote = cfg.SyncRemote }
+        if remote == "" { log.Fatal("sync: --remote <dir> is required (or set syncRemote in the config)") }
+        switch prefer {
+        case "", "local", "remote", "newer":
+        default:
+            log.Fatalf("sync: invalid --prefer %q (want local, remote or newer)", prefer)
+        }
+        // Pulling replaces task folders the extension may have open.
+        if (pull || !push) && !dryRun { requireEditorClosed(cfg) }
+        results, err := syncer.Sync(cfg, syncer.Options{
+            Remote: remote, Push: push, Pull: pull, Refs: splitArgsCSV(args), Prefer: prefer,
+            Register: register, Rewrites: append(rewrites, tasks.PathRewrites(cfg)...), DryRun: dryRun,
+        })
+        printSyncResults(results, dryRun)
+        if err != nil { log.Fatalf("sync: %v", err) }
+    }
+}
+
+func printSyncResults(results []syncer.Result, dryRun bool) {
+    count := map[string]int{}
+    var bytes int64
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    for _, r := range results {
+        count[r.Action]++
+        bytes += r.Size
+        if r.Action == "same" { continue }
+        title, _, _ := tasks.CleanOneLine(r.Title, 50)
+        line := fmt.Sprintf("%s\t%s\t%s", r.Action, r.ID, title)
+        if r.Workspace != "" { line += "\tworkspace " + r.Workspace }
+        if r.Note != "" { line += "\t" + r.Note }
+        fmt.Fprintln(tw, line)
+    }
+    tw.Flush()
+    fmt.Printf("%s %d, %s %d, %d conflict(s), %d skipped, %d up to date",
+        verb(dryRun, "would push", "pushed"), count["push"], verb(dryRun, "would pull", "pulled"), count["pull"],
+        count["conflict"], count["skip"], count["same"])
+    if bytes > 0 { fmt.Printf("; %s transferred", tasks.FormatSize(bytes)) }
+    fmt.Println()
+}
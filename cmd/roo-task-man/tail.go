@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/fsnotify/fsnotify"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// tailStyles colour the kind column of `tail`; lipgloss drops colour when stdout is not a terminal.
+var tailStyles = map[string]lipgloss.Style{
+    "user":       lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true),
+    "api_req":    lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+    "tool":       lipgloss.NewStyle().Foreground(lipgloss.Color("6")),
+    "command":    lipgloss.NewStyle().Foreground(lipgloss.Color("5")),
+    "error":      lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true),
+    "completion": lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true),
+    "question":   lipgloss.NewStyle().Foreground(lipgloss.Color("13")),
+    "other":      lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+}
+
+// setupTail implements `roo-task-man tail [task-id|@latest]`: follow ui_messages.json of a
+// running task and print each message once Roo has finished writing it.
+func setupTail(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        asJSON bool
+        all    bool
+        lines  int
+    )
+    fs.BoolVar(&asJSON, "json", false, "print events as NDJSON")
+    fs.BoolVar(&all, "all", false, "also print reasoning, checkpoints, command output and other bookkeeping messages")
+    fs.IntVar(&lines, "n", 10, "number of existing messages to print first (negative: all)")
+    return func(cfg config.Config, args []string) {
+        if len(args) > 1 { log.Fatal("tail: at most one <task-id> is allowed") }
+        ref := "@latest"
+        if len(args) == 1 { ref = args[0] }
+        t := findTask(cfg, ref)
+        tl := tasks.NewTailer(t)
+        emit := func(evs []tasks.TailEvent) {
+            for _, ev := range evs {
+                if ev.Kind == "other" && !all { continue }
+                if asJSON {
+                    if err := json.NewEncoder(os.Stdout).Encode(ev); err != nil { log.Fatal(err) }
+                    continue
+                }
+                fmt.Println(formatTailEvent(ev))
+            }
+        }
+
+        evs, err := tl.Poll()
+        if err != nil && cfg.Debug { log.Printf("[tail] %v", err) }
+        if !all {
+            kept := evs[:0]
+            for _, ev := range evs { if ev.Kind != "other" { kept = append(kept, ev) } }
+            evs = kept
+        }
+        if lines >= 0 && len(evs) > lines { evs = evs[len(evs)-lines:] }
+        title, _, _ := tasks.CleanOneLine(t.Title, 60)
+        fmt.Fprintf(os.Stderr, "following %s (%s), Ctrl+C to stop\n", t.ID, title)
+        emit(evs)
+
+        // Roo replaces the file on every write, so watch the directory; the ticker also
+        // covers filesystems without change notifications (SSHFS, some container mounts).
+        dirty := true
+        var events <-chan fsnotify.Event
+        if w, err := fsnotify.NewWatcher(); err == nil {
+            defer w.Close()
+            if err := w.Add(t.Path); err == nil {
+                events = w.Events
+            } else if cfg.Debug {
+                log.Printf("[tail] watch %s: %v; polling", t.Path, err)
+            }
+        }
+        fast := time.NewTicker(250 * time.Millisecond)
+        defer fast.Stop()
+        polls := 0
+        for {
+            select {
+            case ev, ok := <-events:
+                if !ok { events = nil; continue }
+                if filepath.Base(ev.Name) == "ui_messages.json" || ev.Has(fsnotify.Remove) { dirty = true }
+            case <-fast.C:
+                polls++
+                if !dirty && polls%8 != 0 { continue }
+                dirty = false
+                if _, err := os.Stat(t.Path); err != nil {
+                    fmt.Fprintf(os.Stderr, "task folder %s is gone\n", t.Path)
+                    return
+                }
+                evs, err := tl.Poll()
+                if err != nil {
+                    // most likely caught mid-write; the next change or tick retries
+                    if cfg.Debug { log.Printf("[tail] %v", err) }
+                    continue
+                }
+                emit(evs)
+            }
+        }
+    }
+}
+
+// formatTailEvent renders one event as "HH:MM:SS kind  text".
+func formatTailEvent(ev tasks.TailEvent) string {
+    kind := ev.Kind
+    text := ev.Text
+    switch ev.Kind {
+    case "api_req":
+        text = fmt.Sprintf("$%.4f (total $%.4f)  in %d / out %d", ev.Cost, ev.TotalCost, ev.TokensIn, ev.TokensOut)
+    case "tool":
+        text = ev.Tool + " " + ev.Text
+    case "other":
+        kind = ev.Name
+    }
+    st, ok := tailStyles[ev.Kind]
+    if !ok { st = lipgloss.NewStyle() }
+    at := ""
+    if !ev.At.IsZero() { at = ev.At.Local().Format("15:04:05") + " " }
+    text, _, _ = tasks.CleanOneLine(text, 160)
+    return at + st.Render(fmt.Sprintf("%-10s", kind)) + " " + text
+}
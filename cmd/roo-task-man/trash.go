@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"roocode-task-man/internal/config"
+	"roocode-task-man/internal/tasks"
+)
+
+// setupTrash implements `roo-task-man trash list|restore|empty`: manage the tasks
+// `delete` (and the TUI's x) moved to the trash.
+func setupTrash(fs *flag.FlagSet) func(config.Config, []string) {
+    var (
+        asJSON    bool
+        yes       bool
+        olderThan string
+    )
+    fs.BoolVar(&asJSON, "json", false, "list: print entries as JSON")
+    fs.BoolVar(&yes, "yes", false, "empty: do not ask for confirmation")
+    fs.BoolVar(&yes, "y", false, "shorthand for --yes")
+    fs.StringVar(&olderThan, "older-than", "", "empty: only purge entries deleted longer ago than this (e.g. 7d, 2w, 36h)")
+    return func(cfg config.Config, args []string) {
+        sub := "list"
+        if len(args) > 0 { sub, args = args[0], args[1:] }
+        switch sub {
+        case "list", "ls":
+            trashList(cfg, asJSON)
+        case "restore":
+            trashRestore(cfg, splitArgsCSV(args))
+        case "empty":
+            var age time.Duration
+            if olderThan != "" {
+                var err error
+                if age, err = tasks.ParseAge(olderThan); err != nil || age <= 0 { log.Fatalf("trash: invalid --older-than %q", olderThan) }
+            }
+            trashEmpty(cfg, age, olderThan, yes)
+        default:
+            log.Fatalf("trash: unknown subcommand %q (want list, restore or empty)", sub)
+        }
+    }
+}
+
+func trashList(cfg config.Config, asJSON bool) {
+    list, err := tasks.ListTrash(cfg)
+    if err != nil { log.Fatalf("trash: %v", err) }
+    if asJSON {
+        type row struct {
+            Name string `json:"name"`
+            tasks.TrashEntry
+        }
+        rows := make([]row, 0, len(list))
+        for _, e := range list { rows = append(rows, row{Name: e.Name, TrashEntry: e}) }
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(rows); err != nil { log.Fatal(err) }
+        return
+    }
+    if len(list) == 0 { fmt.Printf("the trash (%s) is empty\n", tasks.TrashDir(cfg)); return }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "DELETED\tID\tSIZE\tSOURCE\tTITLE")
+    for _, e := range list {
+        title, _, _ := tasks.CleanOneLine(e.Title, 60)
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.DeletedAt.Local().Format("2006-01-02 15:04"), e.ID, tasks.FormatSize(e.Size), e.Source.Label(), title)
+    }
+    tw.Flush()
+    if keep := tasks.TrashRetention(cfg); keep > 0 {
+        fmt.Printf("\n%d task(s) in %s; entries are purged %d days after deletion\n", len(list), tasks.TrashDir(cfg), int(keep.Hours()/24))
+    }
+}
+
+func trashRestore(cfg config.Config, refs []string) {
+    if len(refs) == 0 { log.Fatal("trash restore: at least one <task-id> (or @latest) is required") }
+    list, err := tasks.ListTrash(cfg)
+    if err != nil { log.Fatalf("trash: %v", err) }
+    entries, err := tasks.FindTrash(list, refs)
+    if err != nil { log.Fatal(err) }
+    requireEditorClosed(cfg)
+    for _, e := range entries {
+        if err := tasks.RestoreTrash(cfg, e); err != nil { log.Fatalf("restore %s: %v", e.ID, err) }
+        fmt.Printf("restored %s -> %s\n", e.ID, e.OrigPath)
+    }
+}
+
+func trashEmpty(cfg config.Config, olderThan time.Duration, label string, yes bool) {
+    if !yes {
+        question := "Permanently delete everything in the trash?"
+        if olderThan > 0 { question = fmt.Sprintf("Permanently delete trashed tasks older than %s?", label) }
+        if !confirm(question) { fmt.Println("canceled"); return }
+    }
+    purged, err := tasks.EmptyTrash(cfg, olderThan)
+    if err != nil { log.Fatalf("trash empty: %v", err) }
+    fmt.Printf("purged %d task(s)\n", len(purged))
+}
+
+// trashIDs lists the task IDs of trash entries.
+func trashIDs(entries []tasks.TrashEntry) []string {
+    out := make([]string, 0, len(entries))
+    for _, e := range entries { out = append(out, e.ID) }
+    return out
+}
@@ -8,6 +8,7 @@ require (
 	github.com/charmbracelet/glamour v0.7.0
 	github.com/charmbracelet/lipgloss v0.9.1
 	github.com/dop251/goja v0.0.0-20251121114222-56b1242a5f86
+	github.com/fsnotify/fsnotify v1.7.0
 	golang.org/x/term v0.13.0
 	modernc.org/sqlite v1.31.0
 )
@@ -15,6 +15,50 @@ type Config struct {
     HooksDir   string `json:"hooksDir"`
     ExportDir  string `json:"exportDir"`    // default export destination directory
     Debug      bool   `json:"debug"`
+    UserDataDir string `json:"userDataDir"` // editor user data dir (--user-data-dir or portable data/); holds User/globalStorage
+    RemoteHome string `json:"remoteHome"` // home directory holding .vscode-server & co. (default: local home)
+    AllSources bool   `json:"allSources"` // aggregate tasks from every detected editor/plugin
+    Source     string `json:"source"`     // in all-sources mode, keep sources whose Editor:pluginID contains this text
+    NoCache    bool   `json:"noCache"`    // neither read nor write the task metadata cache
+    TrashDir   string `json:"trashDir"`   // where deleted tasks are kept (default ~/.config/roo-code-man/trash)
+    TrashRetentionDays int `json:"trashRetentionDays"` // purge trashed tasks after this many days (0: 30, negative: never)
+    Prune      []PruneRule `json:"prune"`  // rules for `roo-task-man prune`; a task matching any of them is pruned
+    ArchiveDir string `json:"archiveDir"` // where prune exports tasks before deleting them (--archive-to)
+    BackupDir  string `json:"backupDir"`  // where `backup` keeps snapshots (default ~/.config/roo-code-man/backups)
+    BackupKeep *BackupKeep `json:"backupKeep"` // snapshot retention (default: 7 daily, 4 weekly, 12 monthly)
+    BackupEvery string `json:"backupEvery"` // snapshot on TUI start (and `backup --if-due`) when the newest is older than this, e.g. "1d"
+    StateBackupKeep int `json:"stateBackupKeep"` // state.vscdb.bak-* files kept when pruning them from the restore screen (default 10)
+    SyncRemote string `json:"syncRemote"` // directory `sync` pushes to and pulls from when --remote is not given
+    PathMap    []PathMapping `json:"pathMap"` // workspace paths of other machines and where they are here; longest From wins
+
+    // Set from the command line only.
+    Force      bool `json:"-"` // write the state DB even though the editor looks like it is running
+    WaitEditor bool `json:"-"` // wait for the editor to exit instead of refusing to write its state DB
+}
+
+// BackupKeep says which snapshots `backup` keeps: the newest Last ones plus the newest
+// snapshot of each of the last Daily days, Weekly weeks and Monthly months that have one.
+type BackupKeep struct {
+    Last    int `json:"last,omitempty"`
+    Daily   int `json:"daily,omitempty"`
+    Weekly  int `json:"weekly,omitempty"`
+    Monthly int `json:"monthly,omitempty"`
+}
+
+// PathMapping maps a workspace path prefix of another machine to this one, e.g.
+// /Users/alice/src to /home/bob/code.
+type PathMapping struct {
+    From string `json:"from"`
+    To   string `json:"to"`
+}
+
+// PruneRule selects tasks to prune. Its conditions are combined with "and"; a rule with
+// only KeepPerWorkspace matches every task beyond the newest N of its workspace.
+type PruneRule struct {
+    Name             string `json:"name,omitempty"`
+    Where            string `json:"where,omitempty"`            // query expression, as for `list --where`
+    KeepPerWorkspace int    `json:"keepPerWorkspace,omitempty"` // spare the newest N matching tasks of each workspace
+    Archive          bool   `json:"archive,omitempty"`          // export the task before deleting it
 }
 
 func Default() Config {
@@ -0,0 +1,509 @@
+// Package syncer keeps the tasks of one editor/extension in step with a shared directory
+// (a mounted drive, a Syncthing folder, a git checkout) that other machines sync with too.
+//
+// The directory holds one archive per task, tasks/<id>.zip as written by zipper, next to
+// tasks/<id>.json describing it (RemoteTask). Each machine remembers, per remote, the
+// content hash every task had when it was last synced, which tells a task changed on
+// one side from a conflict: a task changed on both sides since then.
+package syncer
+
+import (
+    "archive/zip"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "roocode-task-man/internal/config"
+    "roocode-task-man/internal/tasks"
+    "roocode-task-man/internal/zipper"
+)
+
+// RemoteTask is tasks/<id>.json in the remote directory.
+type RemoteTask struct {
+    ID        string         `json:"id"`
+    Title     string         `json:"title"`
+    CreatedAt time.Time      `json:"createdAt"`
+    Modified  time.Time      `json:"modified"`  // newest file of the task when it was pushed
+    Hash      string         `json:"hash"`      // content hash of the task's files, see hashTask
+    Size      int64          `json:"size"`      // archive size
+    PushedAt  time.Time      `json:"pushedAt"`
+    PushedBy  string         `json:"pushedBy"`  // host name
+    PluginID  string         `json:"pluginId"`
+    Workspace string         `json:"workspace,omitempty"`
+    History   map[string]any `json:"history,omitempty"` // taskHistory entry on the pushing machine
+}
+
+// Options configures Sync.
+type Options struct {
+    Remote   string
+    Push     bool     // send local changes; with Pull false, nothing is pulled
+    Pull     bool     // fetch remote changes; with Push false, nothing is pushed
+    Refs     []string // limit to these tasks (IDs or unique prefixes); empty for all
+    Prefer   string   // settles conflicts: "local", "remote" or "newer"; empty leaves them
+    Register bool     // add pulled tasks to the editor's taskHistory
+    Rewrites []tasks.PathRewrite // map the pushing machine's workspaces to local ones
+    DryRun   bool
+    StateDir string // where the last-synced hashes are kept; default ~/.config/roo-code-man/sync
+}
+
+// Result reports what Sync did, or would do, with one task. Action is one of "push",
+// "pull", "conflict" (left alone), "skip" (see Note) or "same" (already in sync).
+type Result struct {
+    ID        string
+    Title     string
+    Action    string
+    Note      string
+    Size      int64  // bytes transferred
+    Workspace string // for registered pulls, the workspace it was registered under
+}
+
+// syncState is what one machine knows about one remote.
+type syncState struct {
+    Remote string                `json:"remote"`
+    Source string                `json:"source"`
+    Tasks  map[string]syncedTask `json:"tasks"`
+}
+
+// syncedTask is a task as it was on both sides after its last sync. Files, Size and
+// Modified describe the local folder then, so an unchanged folder is not hashed again.
+type syncedTask struct {
+    Hash     string    `json:"hash"`
+    Files    int       `json:"files"`
+    Size     int64     `json:"size"`
+    Modified time.Time `json:"modified"`
+}
+
+// localTask is a task folder on this machine.
+type localTask struct {
+    task tasks.Task
+    syncedTask // the folder now
+}
+
+// DefaultStateDir is where Sync keeps its per-remote state when Options.StateDir is empty.
+func DefaultStateDir() string { return filepath.Join(config.UserHome(), ".config", "roo-code-man", "sync") }
+
+// Sync pushes and pulls the tasks of cfg's source to and from opts.Remote.
+func Sync(cfg config.Config, opts Options) ([]Result, error) {
+    if tasks.MultiSource(cfg) { return nil, errors.New("sync works on one source; pick it with --editor and --plugin-id") }
+    if !opts.Push && !opts.Pull { opts.Push, opts.Pull = true, true }
+    remote, err := filepath.Abs(opts.Remote)
+    if err != nil { return nil, err }
+    if fi, err := os.Stat(remote); err != nil || !fi.IsDir() { return nil, fmt.Errorf("remote directory %s does not exist", opts.Remote) }
+    remoteTasks := filepath.Join(remote, "tasks")
+    root, err := tasks.ResolveStorageRoot(cfg)
+    if err != nil { return nil, err }
+    label := tasks.ConfiguredLabel(cfg)
+    stateDir := opts.StateDir
+    if stateDir == "" { stateDir = DefaultStateDir() }
+    statePath := filepath.Join(stateDir, stateName(remote, label))
+    st := readState(statePath)
+    st.Remote, st.Source = remote, label
+
+    if opts.Pull && !opts.DryRun {
+        // Pulling replaces task folders the running extension may rewrite, and tasks pulled
+        // but left unregistered would look in sync next time: check up front.
+        if err := tasks.CheckEditorClosed(cfg); err != nil { return nil, err }
+    }
+    list, err := tasks.LoadTasks(cfg)
+    if err != nil { return nil, err }
+    hist, err := tasks.HistoryIndex(cfg)
+    if err != nil && cfg.Debug { log.Printf("[sync] taskHistory unavailable: %v", err) }
+    remotes, err := readRemote(remoteTasks)
+    if err != nil { return nil, err }
+    wanted, err := matchRefs(list, remotes, opts.Refs)
+    if err != nil { return nil, err }
+
+    locals := map[string]*localTask{}
+    for _, t := range list {
+        if wanted != nil && !wanted[t.ID] { continue }
+        lt, err := scanLocal(t, st.Tasks[t.ID])
+        if err != nil { return nil, fmt.Errorf("task %s: %w", t.ID, err) }
+        locals[t.ID] = lt
+    }
+    ids := map[string]bool{}
+    for id := range locals { ids[id] = true }
+    for id := range remotes {
+        if wanted == nil || wanted[id] { ids[id] = true }
+    }
+    order := make([]string, 0, len(ids))
+    for id := range ids { order = append(order, id) }
+    sort.Strings(order)
+
+    host, _ := os.Hostname()
+    s := &syncer{cfg: cfg, opts: opts, root: root, remoteTasks: remoteTasks, stateDir: stateDir, host: host, hist: hist, st: &st}
+    var results []Result
+    var pulled []Result
+    for _, id := range order {
+        r, err := s.syncTask(id, locals[id], remotes[id])
+        if err != nil {
+            r = Result{ID: id, Action: "skip", Note: err.Error()}
+            if lt := locals[id]; lt != nil { r.Title = lt.task.Title } else if rt := remotes[id]; rt != nil { r.Title = rt.Title }
+        }
+        if r.Action == "" { continue } // a direction that was not asked for
+        if r.Action == "pull" && !opts.DryRun { pulled = append(pulled, r) }
+        results = append(results, r)
+    }
+    if !opts.DryRun {
+        if err := writeState(statePath, st); err != nil { return results, err }
+    }
+    if opts.Register && len(pulled) > 0 {
+        ws, err := s.register(pulled, remotes)
+        for i := range results {
+            if w, ok := ws[results[i].ID]; ok { results[i].Workspace = w }
+        }
+        if err != nil { return results, fmt.Errorf("register pulled tasks: %w", err) }
+    } else if opts.Register && opts.DryRun {
+        for i, r := range results {
+            if r.Action == "pull" { results[i].Workspace = s.workspaceFor(r.ID, remotes[r.ID]) }
+        }
+    }
+    return results, nil
+}
+
+type syncer struct {
+    cfg         config.Config
+    opts        Options
+    root        string
+    remoteTasks string
+    stateDir    string
+    host        string
+    hist        map[string]map[string]any
+    st          *syncState
+}
+
+// syncTask decides what to do with one task and does it.
+func (s *syncer) syncTask(id string, lt *localTask, rt *RemoteTask) (Result, error) {
+    r := Result{ID: id}
+    if lt != nil { r.Title = lt.task.Title } else { r.Title = rt.Title }
+    base := s.st.Tasks[id].Hash
+    switch {
+    case rt == nil && base != "":
+        return Result{ID: id, Title: r.Title, Action: "skip", Note: "removed from the remote since the last sync"}, nil
+    case rt == nil:
+        return s.push(r, lt, nil, "")
+    case lt == nil && base != "":
+        return Result{ID: id, Title: r.Title, Action: "skip", Note: "deleted here since the last sync"}, nil
+    case lt == nil:
+        return s.pull(r, nil, rt, "")
+    case lt.Hash == rt.Hash:
+        if !s.opts.DryRun { s.st.Tasks[id] = lt.syncedTask }
+        r.Action = "same"
+        return r, nil
+    case rt.Hash == base:
+        return s.push(r, lt, rt, "")
+    case lt.Hash == base:
+        return s.pull(r, lt, rt, "")
+    }
+    // Changed on both sides (or first sync of a task both sides have, with different contents).
+    prefer := s.opts.Prefer
+    if prefer == "newer" {
+        prefer = "remote"
+        if lt.Modified.After(rt.Modified) { prefer = "local" }
+    }
+    what := fmt.Sprintf("changed here and on %s", orUnknown(rt.PushedBy))
+    switch prefer {
+    case "local":
+        return s.push(r, lt, rt, what+"; kept the local copy")
+    case "remote":
+        return s.pull(r, lt, rt, what+"; took the remote copy")
+    }
+    r.Action, r.Note = "conflict", what+" (use --prefer local, remote or newer)"
+    return r, nil
+}
+
+func orUnknown(s string) string {
+    if s == "" { return "another machine" }
+    return s
+}
+
+// push writes the local task to the remote. A remote copy it replaces in a conflict is
+// kept under conflicts/ in the remote directory.
+func (s *syncer) push(r Result, lt *localTask, old *RemoteTask, note string) (Result, error) {
+    if !s.opts.Push { return Result{}, nil }
+    r.Action, r.Note = "push", note
+    if s.opts.DryRun { return r, nil }
+    if err := os.MkdirAll(s.remoteTasks, 0o755); err != nil { return r, err }
+    zipPath := filepath.Join(s.remoteTasks, r.ID+".zip")
+    if old != nil && note != "" {
+        keep := filepath.Join(filepath.Dir(s.remoteTasks), "conflicts", fmt.Sprintf("%s-%s-%s.zip", r.ID, time.Now().Format("20060102-150405"), safeName(old.PushedBy)))
+        if err := os.MkdirAll(filepath.Dir(keep), 0o755); err != nil { return r, err }
+        if err := copyFile(zipPath, keep); err != nil { return r, fmt.Errorf("keep the remote copy: %w", err) }
+        r.Note += ", the remote one is in " + keep
+    }
+    tmp := filepath.Join(s.remoteTasks, "."+r.ID+".zip.tmp")
+    defer os.Remove(tmp)
+    t := lt.task
+    if e, ok := s.hist[r.ID]; ok { t.Workspace = tasks.HistoryWorkspace(e) }
+    if err := zipper.ExportTask(t, tmp); err != nil { return r, err }
+    // The folder may change while it is archived: describe what the archive holds, which
+    // is what a pull extracts and checks against the hash.
+    hash, err := hashArchive(tmp, r.ID)
+    if err != nil { return r, err }
+    if hash != lt.Hash {
+        now, err := scanLocal(lt.task, syncedTask{})
+        if err != nil { return r, err }
+        lt = now
+        // The folder moved on after it was archived: remember the archived hash with a file
+        // count no scan matches, so the next sync re-hashes the folder and pushes again.
+        if now.Hash != hash { lt.Hash, lt.Files = hash, -1 }
+    }
+    meta := RemoteTask{
+        ID: r.ID, Title: lt.task.Title, CreatedAt: lt.task.CreatedAt, Modified: lt.Modified, Hash: hash,
+        Size: fileSize(tmp), PushedAt: time.Now(), PushedBy: s.host, PluginID: s.cfg.PluginID,
+    }
+    if e, ok := s.hist[r.ID]; ok { meta.History, meta.Workspace = e, t.Workspace }
+    if err := os.Rename(tmp, zipPath); err != nil { return r, err }
+    if err := writeJSON(filepath.Join(s.remoteTasks, r.ID+".json"), meta); err != nil { return r, err }
+    r.Size = meta.Size
+    s.st.Tasks[r.ID] = lt.syncedTask
+    return r, nil
+}
+
+// pull replaces the local task with the remote one. A local copy it replaces in a
+// conflict is exported to conflicts/ in the sync state directory first.
+func (s *syncer) pull(r Result, lt *localTask, rt *RemoteTask, note string) (Result, error) {
+    if !s.opts.Pull { return Result{}, nil }
+    r.Action, r.Note, r.Title = "pull", note, rt.Title
+    zipPath := filepath.Join(s.remoteTasks, r.ID+".zip")
+    if fileSize(zipPath) < 0 { return r, fmt.Errorf("%s is missing (still being copied?)", filepath.Base(zipPath)) }
+    if s.opts.DryRun { return r, nil }
+    dest := filepath.Join(s.root, "tasks", r.ID)
+    if lt != nil { dest = lt.task.Path }
+    if lt != nil && note != "" {
+        keep := filepath.Join(s.stateDir, "conflicts", fmt.Sprintf("%s-%s.zip", r.ID, time.Now().Format("20060102-150405")))
+        if err := zipper.ExportTask(lt.task, keep); err != nil { return r, fmt.Errorf("keep the local copy: %w", err) }
+        r.Note += ", the local one is in " + keep
+    }
+    if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil { return r, err }
+    tmp, err := os.MkdirTemp(filepath.Dir(dest), ".sync-")
+    if err != nil { return r, err }
+    defer os.RemoveAll(tmp)
+    if err := zipper.ImportAny(zipPath, tmp); err != nil { return r, err }
+    got := filepath.Join(tmp, r.ID)
+    now, err := scanLocal(tasks.Task{ID: r.ID, Path: got}, syncedTask{})
+    if err != nil { return r, err }
+    if now.Hash != rt.Hash { return r, fmt.Errorf("%s does not match %s.json (still being copied?)", filepath.Base(zipPath), r.ID) }
+    if err := os.RemoveAll(dest); err != nil { return r, err }
+    if err := os.Rename(got, dest); err != nil { return r, err }
+    now, err = scanLocal(tasks.Task{ID: r.ID, Path: dest}, syncedTask{})
+    if err != nil { return r, err }
+    r.Size = rt.Size
+    s.st.Tasks[r.ID] = now.syncedTask
+    return r, nil
+}
+
+// workspaceFor is the workspace a pulled task is registered under: the one it already
+// has here, else the pushing machine's, rewritten by the path mapping.
+func (s *syncer) workspaceFor(id string, rt *RemoteTask) string {
+    if e, ok := s.hist[id]; ok {
+        if ws := tasks.HistoryWorkspace(e); ws != "" { return ws }
+    }
+    if rt == nil { return "" }
+    return tasks.RewritePath(rt.Workspace, s.opts.Rewrites)
+}
+
+// register adds the pulled tasks to taskHistory and returns their workspaces.
+func (s *syncer) register(pulled []Result, remotes map[string]*RemoteTask) (map[string]string, error) {
+    list, err := tasks.LoadTasks(s.cfg)
+    if err != nil { return nil, err }
+    byID := map[string]tasks.Task{}
+    for _, t := range list { byID[t.ID] = t }
+    ws := map[string]string{}
+    var entries []map[string]any
+    for _, r := range pulled {
+        rt := remotes[r.ID]
+        w := s.workspaceFor(r.ID, rt)
+        src, from := rt.History, rt.PluginID
+        if src == nil {
+            t, ok := byID[r.ID]
+            if !ok { continue }
+            src, from = tasks.HistoryEntryFromTask(t), s.cfg.PluginID
+        }
+        entries = append(entries, tasks.TranslateHistoryEntry(src, from, s.cfg.PluginID, w))
+        ws[r.ID] = w
+    }
+    return ws, tasks.RegisterHistoryEntries(s.cfg, "sync from "+s.opts.Remote, entries)
+}
+
+// matchRefs resolves task references against local tasks, then remote IDs (exact or
+// unique prefix). It returns nil when refs is empty.
+func matchRefs(list []tasks.Task, remotes map[string]*RemoteTask, refs []string) (map[string]bool, error) {
+    if len(refs) == 0 { return nil, nil }
+    out := map[string]bool{}
+    for _, ref := range refs {
+        if t, err := tasks.ResolveRef(list, ref); err == nil { out[t.ID] = true; continue }
+        var found []string
+        for id := range remotes {
+            if id == ref { found = []string{id}; break }
+            if strings.HasPrefix(id, ref) { found = append(found, id) }
+        }
+        switch len(found) {
+        case 0:
+            return nil, fmt.Errorf("no task %q here or in the remote", ref)
+        case 1:
+            out[found[0]] = true
+        default:
+            return nil, fmt.Errorf("%q matches %d remote tasks", ref, len(found))
+        }
+    }
+    return out, nil
+}
+
+// scanLocal describes a task folder. When its files, size and newest mtime match prev,
+// prev's hash is reused instead of reading the files.
+func scanLocal(t tasks.Task, prev syncedTask) (*localTask, error) {
+    lt := &localTask{task: t}
+    var files []string
+    err := filepath.WalkDir(t.Path, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            if os.IsNotExist(err) { return nil }
+            return err
+        }
+        if !d.Type().IsRegular() { return nil }
+        fi, err := d.Info()
+        if err != nil { return nil }
+        lt.Files++
+        lt.Size += fi.Size()
+        if fi.ModTime().After(lt.Modified) { lt.Modified = fi.ModTime() }
+        files = append(files, p)
+        return nil
+    })
+    if err != nil { return nil, err }
+    lt.Modified = lt.Modified.UTC().Truncate(time.Millisecond)
+    if prev.Hash != "" && prev.Files == lt.Files && prev.Size == lt.Size && prev.Modified.Equal(lt.Modified) {
+        lt.Hash = prev.Hash
+        return lt, nil
+    }
+    lt.Hash, err = hashTask(t.Path, files)
+    return lt, err
+}
+
+// hashTask hashes the paths (relative to dir) and contents of files. It does not depend
+// on modification times, which archives do not keep.
+func hashTask(dir string, files []string) (string, error) {
+    rels := make([]string, 0, len(files))
+    for _, p := range files {
+        rel, err := filepath.Rel(dir, p)
+        if err != nil { return "", err }
+        rels = append(rels, filepath.ToSlash(rel))
+    }
+    return hashFiles(rels, func(rel string) (io.ReadCloser, error) { return os.Open(filepath.Join(dir, filepath.FromSlash(rel))) })
+}
+
+// hashArchive hashes the files of task id in the archive at zipPath the way hashTask
+// hashes a folder, skipping what a pull does not extract (the manifest, symlinks).
+func hashArchive(zipPath, id string) (string, error) {
+    zr, err := zip.OpenReader(zipPath)
+    if err != nil { return "", err }
+    defer zr.Close()
+    byRel := map[string]*zip.File{}
+    for _, f := range zr.File {
+        if f.FileInfo().IsDir() || f.FileInfo().Mode()&os.ModeSymlink != 0 { continue }
+        rel := strings.TrimLeft(f.Name, "/\\")
+        if !strings.HasPrefix(rel, id+"/") { continue }
+        byRel[strings.TrimPrefix(rel, id+"/")] = f
+    }
+    rels := make([]string, 0, len(byRel))
+    for rel := range byRel { rels = append(rels, rel) }
+    return hashFiles(rels, func(rel string) (io.ReadCloser, error) { return byRel[rel].Open() })
+}
+
+// hashFiles hashes the sorted relative paths and the contents open returns for them.
+func hashFiles(rels []string, open func(rel string) (io.ReadCloser, error)) (string, error) {
+    sort.Strings(rels)
+    h := sha256.New()
+    for _, rel := range rels {
+        f, err := open(rel)
+        if err != nil { return "", err }
+        fh := sha256.New()
+        _, err = io.Copy(fh, f)
+        f.Close()
+        if err != nil { return "", err }
+        fmt.Fprintf(h, "%s\x00%x\n", rel, fh.Sum(nil))
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readRemote reads the task descriptions in the remote tasks directory.
+func readRemote(dir string) (map[string]*RemoteTask, error) {
+    out := map[string]*RemoteTask{}
+    es, err := os.ReadDir(dir)
+    if os.IsNotExist(err) { return out, nil }
+    if err != nil { return nil, err }
+    for _, e := range es {
+        name := e.Name()
+        if e.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" { continue }
+        b, err := os.ReadFile(filepath.Join(dir, name))
+        if err != nil { return nil, err }
+        var rt RemoteTask
+        if err := json.Unmarshal(b, &rt); err != nil || rt.ID == "" || rt.ID+".json" != name {
+            log.Printf("sync: ignoring %s: not a task description", name)
+            continue
+        }
+        out[rt.ID] = &rt
+    }
+    return out, nil
+}
+
+// stateName names the state file of one remote and source.
+func stateName(remote, label string) string {
+    sum := sha256.Sum256([]byte(remote + "\x00" + label))
+    return safeName(filepath.Base(remote)) + "-" + hex.EncodeToString(sum[:6]) + ".json"
+}
+
+func readState(path string) syncState {
+    var st syncState
+    if b, err := os.ReadFile(path); err == nil { _ = json.Unmarshal(b, &st) }
+    if st.Tasks == nil { st.Tasks = map[string]syncedTask{} }
+    return st
+}
+
+func writeState(path string, st syncState) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    return writeJSON(path, st)
+}
+
+// writeJSON writes v to path through a temp file, so readers never see half of it.
+func writeJSON(path string, v any) error {
+    b, err := json.MarshalIndent(v, "", "  ")
+    if err != nil { return err }
+    tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+    if err := os.WriteFile(tmp, b, 0o644); err != nil { return err }
+    return os.Rename(tmp, path)
+}
+
+func copyFile(src, dst string) error {
+    in, err := os.Open(src)
+    if err != nil { return err }
+    defer in.Close()
+    out, err := os.Create(dst)
+    if err != nil { return err }
+    if _, err := io.Copy(out, in); err != nil { out.Close(); return err }
+    return out.Close()
+}
+
+func fileSize(p string) int64 {
+    fi, err := os.Stat(p)
+    if err != nil { return -1 }
+    return fi.Size()
+}
+
+// safeName keeps letters, digits, dots and dashes of s for use in file names.
+func safeName(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        if r == '.' || r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' { b.WriteRune(r) } else { b.WriteRune('_') }
+    }
+    if b.Len() == 0 { return "unknown" }
+    return b.String()
+}
@@ -0,0 +1,132 @@
+package syncer
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "roocode-task-man/internal/config"
+    "roocode-task-man/internal/tasks"
+)
+
+// machine is one side of a sync: a storage root with a state DB.
+type machine struct {
+    cfg   config.Config
+    root  string
+    state string // sync state directory
+}
+
+func newMachine(t *testing.T, history string) machine {
+    t.Helper()
+    user := t.TempDir()
+    gs := filepath.Join(user, "User", "globalStorage")
+    root := filepath.Join(gs, "pub.ext")
+    if err := os.MkdirAll(filepath.Join(root, "tasks"), 0o755); err != nil { t.Fatal(err) }
+    db, err := sql.Open("sqlite", filepath.Join(gs, "state.vscdb"))
+    if err != nil { t.Fatal(err) }
+    defer db.Close()
+    if _, err := db.Exec("CREATE TABLE ItemTable (key TEXT PRIMARY KEY, value BLOB)"); err != nil { t.Fatal(err) }
+    if _, err := db.Exec("INSERT INTO ItemTable VALUES('pub.ext', ?)", `{"taskHistory":[`+history+`]}`); err != nil { t.Fatal(err) }
+    return machine{cfg: config.Config{CodeChannel: "Custom", PluginID: "pub.ext", DataDir: root, NoCache: true}, root: root, state: filepath.Join(user, "sync")}
+}
+
+func (m machine) write(t *testing.T, id, text string) {
+    t.Helper()
+    dir := filepath.Join(m.root, "tasks", id)
+    if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(`[{"ts":1,"text":"`+text+`","images":[]}]`), 0o644); err != nil { t.Fatal(err) }
+    // Later writes must look newer even on file systems with coarse timestamps.
+    future := time.Now().Add(time.Duration(len(text)) * time.Second)
+    os.Chtimes(filepath.Join(dir, "ui_messages.json"), future, future)
+}
+
+func (m machine) read(t *testing.T, id string) string {
+    t.Helper()
+    b, err := os.ReadFile(filepath.Join(m.root, "tasks", id, "ui_messages.json"))
+    if err != nil { return "" }
+    return string(b)
+}
+
+func (m machine) sync(t *testing.T, remote string, opts Options) string {
+    t.Helper()
+    opts.Remote, opts.StateDir = remote, m.state
+    res, err := Sync(m.cfg, opts)
+    if err != nil { t.Fatal(err) }
+    var out []string
+    for _, r := range res {
+        if r.Action != "same" { out = append(out, r.Action+":"+r.ID) }
+    }
+    return strings.Join(out, " ")
+}
+
+func TestSync(t *testing.T) {
+    remote := t.TempDir()
+    a := newMachine(t, `{"id":"t1","ts":1,"task":"one","workspace":"/Users/alice/src/proj","mode":"code"}`)
+    b := newMachine(t, "")
+    a.write(t, "t1", "one")
+    a.write(t, "t2", "two")
+
+    if got := a.sync(t, remote, Options{}); got != "push:t1 push:t2" { t.Fatalf("first push: %q", got) }
+    if got := a.sync(t, remote, Options{}); got != "" { t.Fatalf("nothing changed, got %q", got) }
+
+    // B pulls both and registers them, mapping A's workspace.
+    rw := []tasks.PathRewrite{{From: "/Users/alice/src", To: "/home/bob/code"}}
+    if got := b.sync(t, remote, Options{Pull: true, Register: true, Rewrites: rw, DryRun: true}); got != "pull:t1 pull:t2" { t.Fatalf("dry run: %q", got) }
+    if b.read(t, "t1") != "" { t.Fatal("dry run pulled") }
+    if got := b.sync(t, remote, Options{Register: true, Rewrites: rw}); got != "pull:t1 pull:t2" { t.Fatalf("pull: %q", got) }
+    if b.read(t, "t1") != a.read(t, "t1") { t.Fatal("pulled task differs") }
+    hist, err := tasks.HistoryIndex(b.cfg)
+    if err != nil { t.Fatal(err) }
+    if ws := tasks.HistoryWorkspace(hist["t1"]); ws != "/home/bob/code/proj" { t.Fatalf("t1 workspace %q", ws) }
+    if _, ok := hist["t2"]; !ok { t.Fatal("t2 not registered") }
+    if got := b.sync(t, remote, Options{}); got != "" { t.Fatalf("after pull, got %q", got) }
+
+    // A change on one side travels to the other.
+    b.write(t, "t1", "one, continued")
+    if got := a.sync(t, remote, Options{}); got != "" { t.Fatalf("A before B pushed: %q", got) }
+    if got := b.sync(t, remote, Options{Pull: true}); got != "" { t.Fatalf("pull only: %q", got) }
+    if got := b.sync(t, remote, Options{}); got != "push:t1" { t.Fatalf("B push: %q", got) }
+    if got := a.sync(t, remote, Options{}); got != "pull:t1" { t.Fatalf("A pull: %q", got) }
+    if !strings.Contains(a.read(t, "t1"), "continued") { t.Fatal("A did not get B's change") }
+
+    // Changed on both sides: a conflict until a side is preferred.
+    a.write(t, "t2", "two from A")
+    b.write(t, "t2", "two from B, later")
+    if got := a.sync(t, remote, Options{}); got != "push:t2" { t.Fatalf("A push: %q", got) }
+    if got := b.sync(t, remote, Options{}); got != "conflict:t2" { t.Fatalf("B conflict: %q", got) }
+    if got := b.sync(t, remote, Options{Prefer: "newer"}); got != "push:t2" { t.Fatalf("B newer: %q", got) }
+    kept, _ := filepath.Glob(filepath.Join(remote, "conflicts", "t2-*.zip"))
+    if len(kept) != 1 { t.Fatalf("remote copy not kept: %v", kept) }
+    if got := a.sync(t, remote, Options{}); got != "pull:t2" || !strings.Contains(a.read(t, "t2"), "from B") { t.Fatalf("A after conflict: %q %s", got, a.read(t, "t2")) }
+
+    // Deleting a task on one side does not delete it elsewhere, nor bring it back.
+    if err := os.RemoveAll(filepath.Join(a.root, "tasks", "t1")); err != nil { t.Fatal(err) }
+    if got := a.sync(t, remote, Options{}); got != "skip:t1" { t.Fatalf("deleted here: %q", got) }
+    if a.read(t, "t1") != "" { t.Fatal("deleted task came back") }
+
+    res, err := Sync(a.cfg, Options{Remote: remote, StateDir: a.state, Refs: []string{"nope"}})
+    if err == nil { t.Fatalf("unknown ref: %v", res) }
+    if got := fmt.Sprint(b.sync(t, remote, Options{Refs: []string{"t2"}})); got != "" { t.Fatalf("refs: %q", got) }
+}
+
+func TestHashArchiveMatchesFolder(t *testing.T) {
+    m := newMachine(t, `{"id":"t1","ts":1,"task":"one","workspace":"/w"}`)
+    m.write(t, "t1", "hello")
+    dir := filepath.Join(m.root, "tasks", "t1")
+    if err := os.MkdirAll(filepath.Join(dir, "checkpoints"), 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(dir, "checkpoints", "c"), []byte("x"), 0o644); err != nil { t.Fatal(err) }
+    lt, err := scanLocal(tasks.Task{ID: "t1", Path: dir}, syncedTask{})
+    if err != nil { t.Fatal(err) }
+
+    remote := t.TempDir()
+    if got := m.sync(t, remote, Options{Push: true}); got != "push:t1" { t.Fatalf("push: %s", got) }
+    zipPath := filepath.Join(remote, "tasks", "t1.zip")
+    hash, err := hashArchive(zipPath, "t1")
+    if err != nil || hash != lt.Hash { t.Fatalf("archive hash %s (%v), folder hash %s", hash, err, lt.Hash) }
+    rts, err := readRemote(filepath.Join(remote, "tasks"))
+    if err != nil || rts["t1"] == nil || rts["t1"].Hash != hash { t.Fatalf("remote description: %+v %v", rts["t1"], err) }
+}
@@ -0,0 +1,531 @@
+package tasks
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "roocode-task-man/internal/config"
+    "roocode-task-man/internal/version"
+)
+
+// DefaultBackupKeep is the snapshot retention used when the config has no backupKeep.
+var DefaultBackupKeep = config.BackupKeep{Last: 1, Daily: 7, Weekly: 4, Monthly: 12}
+
+// Snapshot is one `backup` run: the task folders and state DB files of every source it
+// covered. File contents live in the content-addressed objects/ store of the backup
+// directory, so unchanged files cost nothing in later snapshots. It is stored as
+// snapshots/<Name>.json.
+type Snapshot struct {
+    Name      string           `json:"-"`
+    CreatedAt time.Time        `json:"createdAt"`
+    Version   string           `json:"version"` // roo-task-man version that took it
+    Reason    string           `json:"reason,omitempty"`
+    Sources   []SnapshotSource `json:"sources"`
+}
+
+// SnapshotSource is what a snapshot holds for one source.
+type SnapshotSource struct {
+    Source
+    StateDB string         `json:"stateDb,omitempty"` // path of state.vscdb when the snapshot was taken
+    DB      []SnapshotFile `json:"db,omitempty"`      // state.vscdb and state.vscdb.backup, by base name
+    Tasks   []SnapshotTask `json:"tasks"`
+}
+
+// SnapshotTask is one task folder; Dir is relative to the source root.
+type SnapshotTask struct {
+    ID        string         `json:"id"`
+    Title     string         `json:"title,omitempty"`
+    CreatedAt time.Time      `json:"createdAt,omitempty"` // zero in snapshots taken before it was recorded
+    Dir       string         `json:"dir"`
+    Files     []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is one file of a snapshot; Path is relative to its task folder (or the
+// base name of a state DB file).
+type SnapshotFile struct {
+    Path    string    `json:"path"`
+    Hash    string    `json:"hash"` // sha256 of the content, the object's name
+    Size    int64     `json:"size"`
+    ModTime time.Time `json:"mtime"`
+}
+
+// Size sums the task's file sizes.
+func (t SnapshotTask) Size() int64 {
+    var n int64
+    for _, f := range t.Files { n += f.Size }
+    return n
+}
+
+// TaskCount is the number of task folders in the snapshot.
+func (s Snapshot) TaskCount() int {
+    n := 0
+    for _, src := range s.Sources { n += len(src.Tasks) }
+    return n
+}
+
+// SnapshotStats reports what CreateSnapshot stored.
+type SnapshotStats struct {
+    Files    int
+    Bytes    int64 // total size of the snapshot's files
+    NewFiles int   // files whose content was not in the store yet
+    NewBytes int64
+}
+
+// BackupDir is where snapshots are kept: cfg.BackupDir, or ~/.config/roo-code-man/backups.
+func BackupDir(cfg config.Config) string {
+    if cfg.BackupDir != "" { return cfg.BackupDir }
+    return filepath.Join(config.UserHome(), ".config", "roo-code-man", "backups")
+}
+
+// BackupKeepRules is the configured snapshot retention, or DefaultBackupKeep.
+func BackupKeepRules(cfg config.Config) config.BackupKeep {
+    if cfg.BackupKeep != nil { return *cfg.BackupKeep }
+    return DefaultBackupKeep
+}
+
+func objectPath(dir, hash string) string { return filepath.Join(dir, "objects", hash[:2], hash[2:]) }
+
+func snapshotPath(dir, name string) string { return filepath.Join(dir, "snapshots", name+".json") }
+
+// lockBackupDir keeps two backups (say cron and the TUI) from running at once. A lock
+// older than an hour is considered stale.
+func lockBackupDir(dir string) (func(), error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil { return nil, err }
+    p := filepath.Join(dir, "lock")
+    if fi, err := os.Stat(p); err == nil && time.Since(fi.ModTime()) > time.Hour { os.Remove(p) }
+    f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+    if err != nil {
+        if os.IsExist(err) { return nil, fmt.Errorf("another backup is running (remove %s if not)", p) }
+        return nil, err
+    }
+    fmt.Fprintf(f, "%d\n", os.Getpid())
+    f.Close()
+    return func() { os.Remove(p) }, nil
+}
+
+// CreateSnapshot backs up every selected source: its task folders and its state DB
+// (state.vscdb and .backup, copied with VACUUM INTO so that writes still in the
+// write-ahead log are included). Task files whose size and mtime match the previous
+// snapshot are not read again.
+func CreateSnapshot(cfg config.Config, reason string) (Snapshot, SnapshotStats, error) {
+    var st SnapshotStats
+    dir := BackupDir(cfg)
+    unlock, err := lockBackupDir(dir)
+    if err != nil { return Snapshot{}, st, err }
+    defer unlock()
+
+    srcs, err := selectedSources(cfg)
+    if err != nil { return Snapshot{}, st, err }
+    if len(srcs) == 0 { return Snapshot{}, st, errors.New("no task sources") }
+    list, err := LoadTasks(cfg)
+    if err != nil { return Snapshot{}, st, err }
+    bySource, err := taskSources(cfg, list)
+    if err != nil && len(list) > 0 { return Snapshot{}, st, err }
+
+    prev := map[string]SnapshotFile{} // absolute path -> file in the newest snapshot
+    if snaps, _ := ListSnapshots(cfg); len(snaps) > 0 {
+        for _, s := range snaps[0].Sources {
+            for _, t := range s.Tasks {
+                for _, f := range t.Files { prev[filepath.Join(s.Root, t.Dir, f.Path)] = f }
+            }
+            for _, f := range s.DB { prev[filepath.Join(filepath.Dir(s.StateDB), f.Path)] = f }
+        }
+    }
+    store := func(p string) (SnapshotFile, error) {
+        fi, err := os.Stat(p)
+        if err != nil { return SnapshotFile{}, err }
+        f := SnapshotFile{Size: fi.Size(), ModTime: fi.ModTime()}
+        st.Files++
+        st.Bytes += f.Size
+        if old, ok := prev[p]; ok && old.Size == f.Size && old.ModTime.Equal(f.ModTime) && fileSize(objectPath(dir, old.Hash)) == f.Size {
+            f.Hash = old.Hash
+            return f, nil
+        }
+        hash, added, err := storeObject(dir, p)
+        if err != nil { return SnapshotFile{}, err }
+        f.Hash = hash
+        if added { st.NewFiles++; st.NewBytes += f.Size }
+        return f, nil
+    }
+    // storeDB stores a consistent copy of a database; its mtime says nothing about
+    // writes still in the write-ahead log, so it is always copied.
+    storeDB := func(p string) (SnapshotFile, error) {
+        fi, err := os.Stat(p)
+        if err != nil { return SnapshotFile{}, err }
+        if err := os.MkdirAll(filepath.Join(dir, "objects"), 0o755); err != nil { return SnapshotFile{}, err }
+        tmp := filepath.Join(dir, "objects", fmt.Sprintf(".db-%d", time.Now().UnixNano()))
+        defer os.Remove(tmp)
+        if err := copySQLite(p, tmp); err != nil { return SnapshotFile{}, err }
+        f := SnapshotFile{Size: fileSize(tmp), ModTime: fi.ModTime()}
+        hash, added, err := storeObject(dir, tmp)
+        if err != nil { return SnapshotFile{}, err }
+        f.Hash = hash
+        st.Files++
+        st.Bytes += f.Size
+        if added { st.NewFiles++; st.NewBytes += f.Size }
+        return f, nil
+    }
+
+    snap := Snapshot{CreatedAt: time.Now(), Version: version.String(), Reason: reason}
+    for _, s := range srcs {
+        ss := SnapshotSource{Source: s}
+        if dbPath, err := detectStateDBPath(s.stateConfig(cfg)); err == nil {
+            ss.StateDB = dbPath
+            for _, p := range []string{dbPath, dbPath + ".backup"} {
+                if fileSize(p) < 0 { continue }
+                f, err := storeDB(p)
+                if err != nil { return Snapshot{}, st, fmt.Errorf("%s: %w", p, err) }
+                f.Path = filepath.Base(p)
+                ss.DB = append(ss.DB, f)
+            }
+        } else if cfg.Debug {
+            log.Printf("[backup] %s: %v", s.Label(), err)
+        }
+        for _, t := range list {
+            if bySource[HistoryKey(t)].Label() != s.Label() { continue }
+            rel, err := filepath.Rel(s.Root, t.Path)
+            if err != nil { continue }
+            task := SnapshotTask{ID: t.ID, Title: t.Title, CreatedAt: t.CreatedAt, Dir: filepath.ToSlash(rel)}
+            err = filepath.WalkDir(t.Path, func(p string, d fs.DirEntry, err error) error {
+                if err != nil {
+                    if os.IsNotExist(err) { return nil } // removed while we walk
+                    return err
+                }
+                if !d.Type().IsRegular() { return nil }
+                f, err := store(p)
+                if os.IsNotExist(err) { return nil }
+                if err != nil { return err }
+                r, _ := filepath.Rel(t.Path, p)
+                f.Path = filepath.ToSlash(r)
+                task.Files = append(task.Files, f)
+                return nil
+            })
+            if err != nil { return Snapshot{}, st, fmt.Errorf("task %s: %w", t.ID, err) }
+            ss.Tasks = append(ss.Tasks, task)
+        }
+        snap.Sources = append(snap.Sources, ss)
+    }
+    if err := writeSnapshot(dir, &snap); err != nil { return Snapshot{}, st, err }
+    return snap, st, nil
+}
+
+// storeObject copies the file at p into the object store under its sha256 and reports
+// whether the content was new.
+func storeObject(dir, p string) (string, bool, error) {
+    in, err := os.Open(p)
+    if err != nil { return "", false, err }
+    defer in.Close()
+    tmpDir := filepath.Join(dir, "objects")
+    if err := os.MkdirAll(tmpDir, 0o755); err != nil { return "", false, err }
+    tmp, err := os.CreateTemp(tmpDir, ".tmp-*")
+    if err != nil { return "", false, err }
+    defer os.Remove(tmp.Name())
+    h := sha256.New()
+    if _, err := io.Copy(io.MultiWriter(tmp, h), in); err != nil { tmp.Close(); return "", false, err }
+    if err := tmp.Close(); err != nil { return "", false, err }
+    hash := hex.EncodeToString(h.Sum(nil))
+    dst := objectPath(dir, hash)
+    if _, err := os.Stat(dst); err == nil { return hash, false, nil }
+    if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil { return "", false, err }
+    if err := os.Chmod(tmp.Name(), 0o600); err != nil { return "", false, err }
+    if err := os.Rename(tmp.Name(), dst); err != nil { return "", false, err }
+    return hash, true, nil
+}
+
+// writeSnapshot names snap after its creation time and writes its manifest.
+func writeSnapshot(dir string, snap *Snapshot) error {
+    if err := os.MkdirAll(filepath.Join(dir, "snapshots"), 0o755); err != nil { return err }
+    base := snap.CreatedAt.Format("20060102-150405")
+    snap.Name = base
+    for n := 2; fileSize(snapshotPath(dir, snap.Name)) >= 0; n++ {
+        snap.Name = fmt.Sprintf("%s-%d", base, n)
+    }
+    b, err := json.Marshal(snap)
+    if err != nil { return err }
+    p := snapshotPath(dir, snap.Name)
+    if err := os.WriteFile(p+".tmp", b, 0o600); err != nil { return err }
+    return os.Rename(p+".tmp", p)
+}
+
+// ListSnapshots returns the snapshots in the backup directory, newest first.
+func ListSnapshots(cfg config.Config) ([]Snapshot, error) {
+    dir := filepath.Join(BackupDir(cfg), "snapshots")
+    entries, err := os.ReadDir(dir)
+    if os.IsNotExist(err) { return nil, nil }
+    if err != nil { return nil, err }
+    var out []Snapshot
+    for _, e := range entries {
+        name, ok := strings.CutSuffix(e.Name(), ".json")
+        if !ok || !e.Type().IsRegular() { continue }
+        b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+        if err != nil { continue }
+        var s Snapshot
+        if err := json.Unmarshal(b, &s); err != nil {
+            if cfg.Debug { log.Printf("[backup] %s: %v", e.Name(), err) }
+            continue
+        }
+        s.Name = name
+        out = append(out, s)
+    }
+    sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+    return out, nil
+}
+
+// FindSnapshot resolves a snapshot name, a unique name prefix (e.g. a date such as
+// 20260301) or @latest.
+func FindSnapshot(list []Snapshot, ref string) (Snapshot, error) {
+    if len(list) == 0 { return Snapshot{}, errors.New("there are no snapshots") }
+    if ref == "@latest" { return list[0], nil }
+    var matches []Snapshot
+    for _, s := range list {
+        if s.Name == ref { return s, nil }
+        if strings.HasPrefix(s.Name, ref) { matches = append(matches, s) }
+    }
+    switch len(matches) {
+    case 0:
+        return Snapshot{}, fmt.Errorf("no snapshot matches %q", ref)
+    case 1:
+        return matches[0], nil
+    }
+    names := make([]string, len(matches))
+    for i, s := range matches { names[i] = s.Name }
+    return Snapshot{}, fmt.Errorf("%q matches several snapshots: %s", ref, strings.Join(names, ", "))
+}
+
+// BackupDue reports whether there is no snapshot yet or the newest is at least every old.
+func BackupDue(cfg config.Config, every time.Duration) (bool, error) {
+    list, err := ListSnapshots(cfg)
+    if err != nil { return false, err }
+    return len(list) == 0 || time.Since(list[0].CreatedAt) >= every, nil
+}
+
+// KeepSnapshots splits list (newest first) into the snapshots keep retains and the rest.
+// The newest snapshot is always kept.
+func KeepSnapshots(list []Snapshot, keep config.BackupKeep) (kept, dropped []Snapshot) {
+    retain := map[int]bool{0: true}
+    bucket := func(n int, key func(time.Time) string) {
+        seen := map[string]bool{}
+        for i, s := range list {
+            if len(seen) >= n { break }
+            k := key(s.CreatedAt.Local())
+            if seen[k] { continue }
+            seen[k] = true
+            retain[i] = true
+        }
+    }
+    for i := 0; i < keep.Last && i < len(list); i++ { retain[i] = true }
+    bucket(keep.Daily, func(t time.Time) string { return t.Format("2006-01-02") })
+    bucket(keep.Weekly, func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-%02d", y, w) })
+    bucket(keep.Monthly, func(t time.Time) string { return t.Format("2006-01") })
+    for i, s := range list {
+        if retain[i] { kept = append(kept, s) } else { dropped = append(dropped, s) }
+    }
+    return kept, dropped
+}
+
+// PruneSnapshots deletes the snapshots the retention rules drop, then the objects no
+// remaining snapshot references, and returns the dropped snapshots and the bytes freed.
+func PruneSnapshots(cfg config.Config, keep config.BackupKeep) ([]Snapshot, int64, error) {
+    dir := BackupDir(cfg)
+    unlock, err := lockBackupDir(dir)
+    if err != nil { return nil, 0, err }
+    defer unlock()
+    list, err := ListSnapshots(cfg)
+    if err != nil { return nil, 0, err }
+    kept, dropped := KeepSnapshots(list, keep)
+    for _, s := range dropped {
+        if err := os.Remove(snapshotPath(dir, s.Name)); err != nil { return nil, 0, err }
+    }
+    freed, err := gcObjects(dir, kept)
+    return dropped, freed, err
+}
+
+// gcObjects removes the objects none of snaps references.
+func gcObjects(dir string, snaps []Snapshot) (int64, error) {
+    used := map[string]bool{}
+    for _, s := range snaps {
+        for _, src := range s.Sources {
+            for _, f := range src.DB { used[f.Hash] = true }
+            for _, t := range src.Tasks {
+                for _, f := range t.Files { used[f.Hash] = true }
+            }
+        }
+    }
+    var freed int64
+    err := filepath.WalkDir(filepath.Join(dir, "objects"), func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            if os.IsNotExist(err) { return nil }
+            return err
+        }
+        if d.IsDir() { return nil }
+        hash := filepath.Base(filepath.Dir(p)) + d.Name()
+        if used[hash] { return nil }
+        if info, err := d.Info(); err == nil { freed += info.Size() }
+        return os.Remove(p)
+    })
+    return freed, err
+}
+
+// SnapshotPick names one task of a snapshot: its source label and ID.
+type SnapshotPick struct {
+    Source string
+    ID     string
+}
+
+// RestoreSnapshotTasks puts the picked task folders back exactly as they were in snap
+// (files added since are removed) and merges their taskHistory entries from the
+// snapshot's state DB into the current state DB and .backup, backing both up first.
+func RestoreSnapshotTasks(cfg config.Config, snap Snapshot, picks []SnapshotPick) error {
+    if err := checkSnapshotEditors(cfg, snap); err != nil { return err }
+    dir := BackupDir(cfg)
+    want := map[SnapshotPick]bool{}
+    for _, p := range picks { want[p] = true }
+    found := 0
+    for _, src := range snap.Sources {
+        var ids []string
+        for _, t := range src.Tasks {
+            if !want[SnapshotPick{Source: src.Label(), ID: t.ID}] { continue }
+            found++
+            if err := restoreSnapshotTask(dir, src, t); err != nil { return fmt.Errorf("restore %s: %w", t.ID, err) }
+            ids = append(ids, t.ID)
+        }
+        if len(ids) == 0 { continue }
+        if err := restoreSnapshotHistory(cfg, dir, src, ids); err != nil { return fmt.Errorf("%s: %w", src.Label(), err) }
+    }
+    if found < len(want) { return fmt.Errorf("restored %d of %d task(s); the others are not in snapshot %s", found, len(want), snap.Name) }
+    return nil
+}
+
+// RestoreSnapshot restores everything snap holds: every task folder and the state DB
+// files themselves (the current ones are backed up with a .bak-<time> suffix first, and
+// the snapshot's copies verified before they replace them).
+// Tasks created after the snapshot are left alone but, with the state DB restored, are
+// no longer in the editor's history.
+func RestoreSnapshot(cfg config.Config, snap Snapshot) error {
+    if err := checkSnapshotEditors(cfg, snap); err != nil { return err }
+    dir := BackupDir(cfg)
+    suffixes := map[string]string{} // per state DB directory, shared by state.vscdb and its .backup
+    tmp, err := os.MkdirTemp("", "roo-task-man-restore-")
+    if err != nil { return err }
+    defer os.RemoveAll(tmp)
+    done := map[string]bool{} // sources of one editor share its state DB
+    for _, src := range snap.Sources {
+        for _, t := range src.Tasks {
+            if err := restoreSnapshotTask(dir, src, t); err != nil { return fmt.Errorf("restore %s: %w", t.ID, err) }
+        }
+        for _, f := range src.DB {
+            dst := filepath.Join(filepath.Dir(src.StateDB), f.Path)
+            if done[dst] { continue }
+            done[dst] = true
+            if fileSize(dst) >= 0 {
+                d := filepath.Dir(dst)
+                if suffixes[d] == "" { suffixes[d] = backupSuffix(filepath.Join(d, "state.vscdb")) }
+                if err := backupStateDB(dst, suffixes[d], "restore snapshot "+snap.Name, nil); err != nil { return fmt.Errorf("back up %s: %w", dst, err) }
+            }
+            old := filepath.Join(tmp, f.Path)
+            if err := restoreObject(dir, f, old); err != nil { return fmt.Errorf("restore %s: %w", dst, err) }
+            if err := replaceSQLite(old, dst); err != nil { return fmt.Errorf("restore %s: %w", dst, err) }
+        }
+    }
+    return nil
+}
+
+// checkSnapshotEditors refuses to restore while an editor whose state DB snap holds is
+// running (see CheckEditorClosed).
+func checkSnapshotEditors(cfg config.Config, snap Snapshot) error {
+    for _, src := range snap.Sources {
+        if len(src.DB) == 0 { continue }
+        if err := CheckEditorClosed(src.stateConfig(cfg)); err != nil { return err }
+    }
+    return nil
+}
+
+// restoreSnapshotTask makes the task folder match t.
+func restoreSnapshotTask(dir string, src SnapshotSource, t SnapshotTask) error {
+    taskDir := filepath.Join(src.Root, filepath.FromSlash(t.Dir))
+    keep := map[string]bool{}
+    for _, f := range t.Files {
+        dst := filepath.Join(taskDir, filepath.FromSlash(f.Path))
+        keep[dst] = true
+        if fi, err := os.Stat(dst); err == nil && fi.Size() == f.Size && fi.ModTime().Equal(f.ModTime) { continue }
+        if err := restoreObject(dir, f, dst); err != nil { return err }
+    }
+    return filepath.WalkDir(taskDir, func(p string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() || keep[p] { return nil }
+        return os.Remove(p)
+    })
+}
+
+// restoreObject writes f's content to dst atomically and restores its mtime.
+func restoreObject(dir string, f SnapshotFile, dst string) error {
+    src := objectPath(dir, f.Hash)
+    if fileSize(src) != f.Size { return fmt.Errorf("object %s for %s is missing or damaged", f.Hash, f.Path) }
+    if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil { return err }
+    if err := copyFile(src, dst); err != nil { return err }
+    return os.Chtimes(dst, f.ModTime, f.ModTime)
+}
+
+// restoreSnapshotHistory merges the taskHistory entries of ids from the snapshot's copy
+// of src's state DB into the current one.
+func restoreSnapshotHistory(cfg config.Config, dir string, src SnapshotSource, ids []string) error {
+    var db *SnapshotFile
+    for i := range src.DB {
+        if src.DB[i].Path == "state.vscdb" { db = &src.DB[i] }
+    }
+    if db == nil { return nil } // the snapshot has no state DB for this source
+    tmp, err := os.MkdirTemp("", "roo-task-man-restore-")
+    if err != nil { return err }
+    defer os.RemoveAll(tmp)
+    old := filepath.Join(tmp, "state.vscdb")
+    if err := restoreObject(dir, *db, old); err != nil { return err }
+    hist, err := readTaskHistoryFromDB(old, src.PluginID)
+    if err != nil { return err }
+    wanted := map[string]bool{}
+    for _, id := range ids { wanted[id] = true }
+    var entries []map[string]any
+    for _, h := range hist {
+        if id, _ := h["id"].(string); wanted[id] { entries = append(entries, h) }
+    }
+    if len(entries) == 0 { return nil }
+    dbPath, err := detectStateDBPath(src.stateConfig(cfg))
+    if err != nil { return err }
+    dbs := existingStateDBs(dbPath)
+    if err := backupStateDBs(dbs, "restore tasks from snapshot", ids); err != nil { return err }
+    for _, p := range dbs {
+        if err := mergeHistoryEntries(p, src.PluginID, entries); err != nil { return fmt.Errorf("register in %s: %w", p, err) }
+    }
+    return nil
+}
+
+// Picks resolves task references against the snapshot's tasks the way ResolveRef does
+// (full IDs, unique prefixes, @latest/@N, title fragments). A reference matching several
+// tasks, or an ID held by several sources, yields an *AmbiguousError.
+func (s Snapshot) Picks(refs []string) ([]SnapshotPick, error) {
+    var list []Task
+    for _, src := range s.Sources {
+        for _, t := range src.Tasks { list = append(list, Task{ID: t.ID, Title: t.Title, CreatedAt: t.CreatedAt, Source: src.Label()}) }
+    }
+    var out []SnapshotPick
+    for _, ref := range refs {
+        t, err := ResolveRef(list, ref)
+        if err != nil { return nil, fmt.Errorf("snapshot %s: %w", s.Name, err) }
+        var same []Task
+        for _, c := range list {
+            if c.ID == t.ID { same = append(same, c) }
+        }
+        if len(same) > 1 { return nil, fmt.Errorf("snapshot %s: %w", s.Name, &AmbiguousError{Ref: ref, Candidates: same}) }
+        out = append(out, SnapshotPick{Source: t.Source, ID: t.ID})
+    }
+    return out, nil
+}
@@ -0,0 +1,235 @@
+package tasks
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "strings"
+
+    "roocode-task-man/internal/config"
+)
+
+// HistoryChange is a taskHistory entry that differs between a state DB backup and the
+// current DB. Kind says what happened since the backup was taken:
+//   - "added": the entry is only in the current DB
+//   - "removed": the entry is only in the backup
+//   - "changed": both have it, with different Fields
+type HistoryChange struct {
+    ID        string
+    Kind      string
+    Task      string
+    Fields    []string // changed top-level fields, sorted
+    Workspace [2]string // backup and current workspace, when they differ
+    Folder    bool      // the task folder exists
+    Entry     map[string]any // the backup's entry; nil for "added"
+}
+
+// Restorable reports whether the backup holds an entry to merge back.
+func (c HistoryChange) Restorable() bool { return c.Entry != nil }
+
+// KeyChange is an ItemTable key whose value differs between a backup and the current DB.
+// For the plugin's own key only the values besides taskHistory are compared.
+type KeyChange struct {
+    Key     string
+    Kind    string // "added", "removed" or "changed", as for HistoryChange
+    Backup  int    // value sizes in bytes
+    Current int
+}
+
+// BackupDiff compares a state.vscdb backup with the current state.vscdb.
+type BackupDiff struct {
+    History []HistoryChange // ordered removed, changed, added, then by ID
+    Keys    []KeyChange     // ordered by key
+}
+
+// Counts returns the number of history entries removed, changed and added since the backup.
+func (d BackupDiff) Counts() (removed, changed, added int) {
+    for _, c := range d.History {
+        switch c.Kind {
+        case "removed":
+            removed++
+        case "changed":
+            changed++
+        case "added":
+            added++
+        }
+    }
+    return
+}
+
+// DiffBackup compares the backup b of cfg's state DB with the current one.
+func DiffBackup(cfg config.Config, b BackupInfo) (BackupDiff, error) {
+    var d BackupDiff
+    dbPath, err := detectStateDBPath(cfg)
+    if err != nil { return d, err }
+    old, err := readItemTable(b.Path)
+    if err != nil { return d, fmt.Errorf("read backup: %w", err) }
+    cur, err := readItemTable(dbPath)
+    if err != nil { return d, fmt.Errorf("read %s: %w", dbPath, err) }
+
+    oldHist, oldRest := splitPluginValue(old[cfg.PluginID])
+    curHist, curRest := splitPluginValue(cur[cfg.PluginID])
+    root, _ := ResolveStorageRoot(cfg)
+    folder := func(id string) bool { return root != "" && isDir(filepath.Join(root, "tasks", id)) }
+    for id, o := range oldHist {
+        c, ok := curHist[id]
+        ch := HistoryChange{ID: id, Task: historyTask(o), Folder: folder(id), Entry: o}
+        switch {
+        case !ok:
+            ch.Kind = "removed"
+        case !reflect.DeepEqual(o, c):
+            ch.Kind = "changed"
+            for k := range o {
+                if !reflect.DeepEqual(o[k], c[k]) { ch.Fields = append(ch.Fields, k) }
+            }
+            for k := range c {
+                if _, ok := o[k]; !ok { ch.Fields = append(ch.Fields, k) }
+            }
+            sort.Strings(ch.Fields)
+            if ow, cw := HistoryWorkspace(o), HistoryWorkspace(c); ow != cw { ch.Workspace = [2]string{ow, cw} }
+        default:
+            continue
+        }
+        d.History = append(d.History, ch)
+    }
+    for id, c := range curHist {
+        if _, ok := oldHist[id]; ok { continue }
+        d.History = append(d.History, HistoryChange{ID: id, Kind: "added", Task: historyTask(c), Folder: folder(id)})
+    }
+    order := map[string]int{"removed": 0, "changed": 1, "added": 2}
+    sort.Slice(d.History, func(i, j int) bool {
+        a, b := d.History[i], d.History[j]
+        if a.Kind != b.Kind { return order[a.Kind] < order[b.Kind] }
+        return a.ID < b.ID
+    })
+
+    old[cfg.PluginID], cur[cfg.PluginID] = oldRest, curRest
+    for k, o := range old {
+        c, ok := cur[k]
+        switch {
+        case !ok:
+            d.Keys = append(d.Keys, KeyChange{Key: k, Kind: "removed", Backup: len(o)})
+        case string(o) != string(c):
+            d.Keys = append(d.Keys, KeyChange{Key: k, Kind: "changed", Backup: len(o), Current: len(c)})
+        }
+    }
+    for k, c := range cur {
+        if _, ok := old[k]; !ok { d.Keys = append(d.Keys, KeyChange{Key: k, Kind: "added", Current: len(c)}) }
+    }
+    sort.Slice(d.Keys, func(i, j int) bool { return d.Keys[i].Key < d.Keys[j].Key })
+    return d, nil
+}
+
+// readItemTable reads every key and value of a state DB.
+func readItemTable(path string) (map[string][]byte, error) {
+    if _, err := os.Stat(path); err != nil { return nil, err }
+    db, err := sql.Open("sqlite", path)
+    if err != nil { return nil, err }
+    defer db.Close()
+    rows, err := db.Query("SELECT key, value FROM ItemTable")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[string][]byte{}
+    for rows.Next() {
+        var k string
+        var v []byte
+        if err := rows.Scan(&k, &v); err != nil { return nil, err }
+        out[k] = v
+    }
+    return out, rows.Err()
+}
+
+// splitPluginValue splits the plugin's ItemTable value into its taskHistory, keyed by
+// ID, and the rest of the value re-encoded (nil when there is nothing else).
+func splitPluginValue(raw []byte) (map[string]map[string]any, []byte) {
+    hist := map[string]map[string]any{}
+    if raw == nil { return hist, nil }
+    var doc map[string]any
+    if json.Unmarshal(raw, &doc) != nil { return hist, raw }
+    arr, _ := doc["taskHistory"].([]any)
+    for _, it := range arr {
+        if m, ok := it.(map[string]any); ok {
+            if id, _ := m["id"].(string); id != "" { hist[id] = m }
+        }
+    }
+    delete(doc, "taskHistory")
+    if len(doc) == 0 { return hist, nil }
+    rest, _ := json.Marshal(doc) // map keys are sorted, so equal values encode equally
+    return hist, rest
+}
+
+func historyTask(e map[string]any) string {
+    s, _ := e["task"].(string)
+    return s
+}
+
+// RestoreBackupEntries merges the taskHistory entries of ids from the backup with the
+// given suffix back into the current state DB and its .backup (both backed up first),
+// leaving every other entry and key alone.
+func RestoreBackupEntries(cfg config.Config, suffix string, ids []string) error {
+    dir, err := detectStateDBDir(cfg)
+    if err != nil { return err }
+    bak := filepath.Join(dir, "state.vscdb.bak-"+suffix)
+    hist, err := readTaskHistoryFromDB(bak, cfg.PluginID)
+    if err != nil { return fmt.Errorf("read backup: %w", err) }
+    wanted := map[string]bool{}
+    for _, id := range ids { wanted[id] = true }
+    var entries []map[string]any
+    for _, h := range hist {
+        if id, _ := h["id"].(string); wanted[id] { entries = append(entries, h); delete(wanted, id) }
+    }
+    if len(wanted) > 0 {
+        missing := make([]string, 0, len(wanted))
+        for id := range wanted { missing = append(missing, id) }
+        sort.Strings(missing)
+        return fmt.Errorf("not in backup %s: %s", suffix, strings.Join(missing, ", "))
+    }
+    if len(entries) == 0 { return nil }
+    if err := CheckEditorClosed(cfg); err != nil { return err }
+    dbs := existingStateDBs(filepath.Join(dir, "state.vscdb"))
+    if err := backupStateDBs(dbs, "restore entries from .bak-"+suffix, ids); err != nil { return err }
+    for _, p := range dbs {
+        if err := mergeHistoryEntries(p, cfg.PluginID, entries); err != nil { return fmt.Errorf("register in %s: %w", p, err) }
+    }
+    return nil
+}
+
+// DeleteBackup removes the backup with b's suffix: state.vscdb.bak-<suffix>, the paired
+// state.vscdb.backup.bak-<suffix> and their metadata files.
+func DeleteBackup(b BackupInfo) error {
+    dir := filepath.Dir(b.Path)
+    for _, name := range []string{"state.vscdb.bak-", "state.vscdb.backup.bak-"} {
+        p := filepath.Join(dir, name+b.Suffix)
+        for _, f := range []string{p, p + ".json"} {
+            if err := os.Remove(f); err != nil && !os.IsNotExist(err) { return err }
+        }
+    }
+    return nil
+}
+
+// DefaultStateBackupKeep is how many state DB backups PruneBackups keeps by default.
+const DefaultStateBackupKeep = 10
+
+// StateBackupKeep is the configured number of state DB backups to keep.
+func StateBackupKeep(cfg config.Config) int {
+    if cfg.StateBackupKeep > 0 { return cfg.StateBackupKeep }
+    return DefaultStateBackupKeep
+}
+
+// PruneBackups deletes all but the newest keep state DB backups and returns the deleted ones.
+func PruneBackups(cfg config.Config, keep int) ([]BackupInfo, error) {
+    list, _, err := ListBackups(cfg)
+    if err != nil { return nil, err }
+    if keep < 1 { keep = 1 }
+    if len(list) <= keep { return nil, nil }
+    var out []BackupInfo
+    for _, b := range list[keep:] {
+        if err := DeleteBackup(b); err != nil { return out, err }
+        out = append(out, b)
+    }
+    return out, nil
+}
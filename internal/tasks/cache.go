@@ -0,0 +1,196 @@
+package tasks
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "roocode-task-man/internal/config"
+)
+
+// metaCacheVersion is bumped whenever metaEntry or the way it is derived changes;
+// caches written with another version are ignored.
+const metaCacheVersion = 3
+
+// metaEntry is what loading and listing derive from one task directory.
+type metaEntry struct {
+    Fingerprint string     `json:"fp"`
+    Summary     string     `json:"summary"`
+    CreatedAt   time.Time  `json:"createdAt"` // zero until the basics were computed
+    Stats       *TaskStats `json:"stats,omitempty"`
+    SizeFP      string     `json:"sizeFp,omitempty"` // subtreeFingerprint Stats.SizeBytes was measured at
+    Corpus      *string    `json:"corpus,omitempty"`
+    Usage       *DiskUsage `json:"usage,omitempty"`
+    UsageFP     string     `json:"usageFp,omitempty"` // subtreeFingerprint Usage was measured at
+}
+
+type metaCacheFile struct {
+    Version int                   `json:"version"`
+    Entries map[string]*metaEntry `json:"entries"`
+}
+
+// metaCache maps task directories to their derived metadata. It is shared by the whole
+// process; LoadTasks merges the on-disk copy in once and writes changes back.
+type metaCache struct {
+    mu      sync.Mutex
+    entries map[string]*metaEntry
+    loaded  map[string]bool // cache files already merged in
+    dirty   bool
+}
+
+var taskMeta = newMetaCache()
+
+func newMetaCache() *metaCache {
+    return &metaCache{entries: map[string]*metaEntry{}, loaded: map[string]bool{}}
+}
+
+// userCacheDir locates the directory MetaCachePath lives in; tests point it elsewhere
+// so they never read or write the user's cache.
+var userCacheDir = os.UserCacheDir
+
+// MetaCachePath is the file task metadata is cached in between runs.
+func MetaCachePath() string {
+    dir, err := userCacheDir()
+    if err != nil { return "" }
+    return filepath.Join(dir, "roo-code-man", "task-meta.json")
+}
+
+// fingerprint identifies the state of a task directory by the mtime and size of the
+// directory and of the JSON files Roo rewrites. Roo writes through a temp file and a
+// rename, which also bumps the directory's mtime.
+func fingerprint(dir string) string {
+    var b strings.Builder
+    for _, p := range []string{dir, filepath.Join(dir, "ui_messages.json"), filepath.Join(dir, "api_conversation_history.json")} {
+        if fi, err := os.Stat(p); err == nil {
+            fmt.Fprintf(&b, "%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+        } else {
+            b.WriteString("-;")
+        }
+    }
+    return b.String()
+}
+
+// subtreeFingerprint extends fingerprint to the folders whose contents change without
+// touching the conversation files: checkpoints/ (git commits) and compacted-images/. It
+// counts, sums and takes the newest mtime of everything below them.
+func subtreeFingerprint(dir string) string {
+    var b strings.Builder
+    for _, sub := range []string{"checkpoints", compactedImagesDir} {
+        var n, size, newest int64
+        _ = filepath.WalkDir(filepath.Join(dir, sub), func(p string, d fs.DirEntry, err error) error {
+            if err != nil { return nil }
+            info, err := d.Info()
+            if err != nil { return nil }
+            n++
+            if !d.IsDir() { size += info.Size() }
+            if m := info.ModTime().UnixNano(); m > newest { newest = m }
+            return nil
+        })
+        fmt.Fprintf(&b, "%d:%d:%d;", n, size, newest)
+    }
+    return b.String()
+}
+
+// get returns a copy of dir's entry if it was recorded for fingerprint fp.
+func (c *metaCache) get(dir, fp string) (metaEntry, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    e, ok := c.entries[dir]
+    if !ok || e.Fingerprint != fp { return metaEntry{}, false }
+    return *e, true
+}
+
+// update applies fn to dir's entry for fingerprint fp, starting a fresh entry when the
+// recorded one is stale.
+func (c *metaCache) update(dir, fp string, fn func(*metaEntry)) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    e, ok := c.entries[dir]
+    if !ok || e.Fingerprint != fp {
+        e = &metaEntry{Fingerprint: fp}
+        c.entries[dir] = e
+    }
+    fn(e)
+    c.dirty = true
+}
+
+// load merges the cache file at path into memory, once per path. Entries already in
+// memory win: they were computed by this process.
+func (c *metaCache) load(path string, debug bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if path == "" || c.loaded[path] { return }
+    c.loaded[path] = true
+    b, err := os.ReadFile(path)
+    if err != nil { return }
+    var f metaCacheFile
+    if err := json.Unmarshal(b, &f); err != nil || f.Version != metaCacheVersion {
+        if debug { log.Printf("[cache] ignoring %s (version %d, err %v)", path, f.Version, err) }
+        return
+    }
+    for dir, e := range f.Entries {
+        if _, ok := c.entries[dir]; !ok && e != nil { c.entries[dir] = e }
+    }
+    if debug { log.Printf("[cache] loaded %d entries from %s", len(f.Entries), path) }
+}
+
+// save writes the cache to path when it changed, dropping entries whose directory is
+// gone. The file is replaced atomically so concurrent runs never read a torn file.
+func (c *metaCache) save(path string) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if path == "" || !c.dirty { return nil }
+    for dir := range c.entries {
+        if !isDir(dir) { delete(c.entries, dir) }
+    }
+    b, err := json.Marshal(metaCacheFile{Version: metaCacheVersion, Entries: c.entries})
+    if err != nil { return err }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".task-meta-*")
+    if err != nil { return err }
+    if _, err := tmp.Write(b); err != nil { tmp.Close(); os.Remove(tmp.Name()); return err }
+    if err := tmp.Close(); err != nil { os.Remove(tmp.Name()); return err }
+    if err := os.Rename(tmp.Name(), path); err != nil { os.Remove(tmp.Name()); return err }
+    c.dirty = false
+    return nil
+}
+
+// openMetaCache merges the on-disk cache in unless cfg.NoCache is set.
+func openMetaCache(cfg config.Config) {
+    if cfg.NoCache { return }
+    taskMeta.load(MetaCachePath(), cfg.Debug)
+}
+
+// SaveMetaCache persists metadata computed since the last save (LoadTasks saves, but
+// stats and prompt corpora are usually derived afterwards). Failures only cost speed
+// on the next run.
+func SaveMetaCache(cfg config.Config) {
+    if cfg.NoCache { return }
+    if err := taskMeta.save(MetaCachePath()); err != nil && cfg.Debug { log.Printf("[cache] save: %v", err) }
+}
+
+// PromptCorpus joins the task's human prompts into one line (capped at ~4000 bytes)
+// for full-text filtering. It is cached like the task's other metadata.
+func PromptCorpus(t Task) string {
+    fp := fingerprint(t.Path)
+    if e, ok := taskMeta.get(t.Path, fp); ok && e.Corpus != nil { return *e.Corpus }
+    const maxCorpusLen = 4000
+    b := strings.Builder{}
+    for _, h := range LoadHistory(t) {
+        if h.Role != "user" { continue }
+        line, _, _ := CleanOneLine(h.Text, 200)
+        if line == "" { continue }
+        if b.Len() > 0 { b.WriteByte(' ') }
+        b.WriteString(line)
+        if b.Len() >= maxCorpusLen { break }
+    }
+    s := b.String()
+    taskMeta.update(t.Path, fp, func(e *metaEntry) { e.Corpus = &s })
+    return s
+}
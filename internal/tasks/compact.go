@@ -0,0 +1,300 @@
+package tasks
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// CompactOptions selects what CompactTask does.
+type CompactOptions struct {
+    DropImages bool // discard embedded images instead of extracting them to compacted-images/
+    NoGC       bool // leave checkpoint repositories alone
+    DryRun     bool // only measure what would be done
+}
+
+// CompactResult reports what CompactTask did (or, for a dry run, would do).
+type CompactResult struct {
+    ID         string
+    Before     int64 // task folder size
+    After      int64 // equal to Before for a dry run
+    Images     int   // embedded images removed from the JSON files
+    ImageBytes int64 // their base64 payload
+    Files      int   // new image files written to compacted-images/
+    Repos      int   // checkpoint repositories garbage collected
+    Skipped    []string // what was left alone, and why
+}
+
+// errChangedDuringCompact is returned when Roo rewrote a file while it was being compacted.
+var errChangedDuringCompact = errors.New("file changed while compacting (task running?); left as is")
+
+// CompactTask shrinks a task folder without breaking it for the extension: base64 images
+// embedded in ui_messages.json and api_conversation_history.json are moved to
+// deduplicated files under compacted-images/ (or dropped), and the checkpoint git
+// repositories are garbage collected.
+//
+// Every message is kept. A ui message keeps an empty "images" array; an API image block
+// becomes a text block naming the extracted file, so the history stays valid to resume
+// from. Files are replaced atomically, and one Roo rewrites meanwhile is left untouched.
+func CompactTask(t Task, opts CompactOptions) (CompactResult, error) {
+    res := CompactResult{ID: t.ID, Before: dirSize(t.Path)}
+    idx := imageIndex{}
+    idxPath := filepath.Join(t.Path, compactedImagesDir, "index.json")
+    if !opts.DropImages { idx.load(idxPath) }
+    for _, name := range conversationFiles {
+        path := filepath.Join(t.Path, name)
+        if fileSize(path) < 0 { continue }
+        if opts.DryRun {
+            n, count := embeddedImageBytes(path)
+            res.ImageBytes += n
+            res.Images += count
+            continue
+        }
+        r := imageRewriter{dir: filepath.Join(t.Path, compactedImagesDir), file: name, drop: opts.DropImages, index: idx}
+        err := r.rewrite(path)
+        if errors.Is(err, errChangedDuringCompact) {
+            res.Skipped = append(res.Skipped, name+": "+err.Error())
+            continue
+        }
+        if err != nil { return res, fmt.Errorf("%s: %w", name, err) }
+        res.Images += r.images
+        res.ImageBytes += r.bytes
+        res.Files += r.files
+    }
+    if !opts.DryRun && len(idx) > 0 {
+        if err := idx.save(idxPath); err != nil { return res, err }
+    }
+    if !opts.NoGC {
+        repos := checkpointRepos(t.Path)
+        if len(repos) > 0 {
+            if _, err := exec.LookPath("git"); err != nil {
+                res.Skipped = append(res.Skipped, "checkpoints: git not found on PATH")
+            } else if opts.DryRun {
+                res.Repos = len(repos)
+            } else {
+                for _, repo := range repos {
+                    out, err := exec.Command("git", "--git-dir", repo, "gc", "--prune=now", "--quiet").CombinedOutput()
+                    if err != nil {
+                        rel, _ := filepath.Rel(t.Path, repo)
+                        res.Skipped = append(res.Skipped, fmt.Sprintf("%s: git gc: %v %s", rel, err, strings.TrimSpace(string(out))))
+                        continue
+                    }
+                    res.Repos++
+                }
+            }
+        }
+    }
+    res.After = res.Before
+    if !opts.DryRun {
+        res.After = dirSize(t.Path)
+        // gc does not touch the files the cache fingerprint looks at
+        taskMeta.update(t.Path, fingerprint(t.Path), func(e *metaEntry) { e.Usage, e.Stats = nil, nil })
+    }
+    return res, nil
+}
+
+// checkpointRepos lists the git directories under the task's checkpoints/ folder.
+func checkpointRepos(taskDir string) []string {
+    var out []string
+    _ = filepath.WalkDir(filepath.Join(taskDir, "checkpoints"), func(p string, d fs.DirEntry, err error) error {
+        if err != nil || !d.IsDir() { return nil }
+        if fileSize(filepath.Join(p, "HEAD")) >= 0 && isDir(filepath.Join(p, "objects")) {
+            out = append(out, p)
+            return filepath.SkipDir
+        }
+        return nil
+    })
+    return out
+}
+
+// imageIndex records, for each file in compacted-images/, where its image was embedded
+// ("ui_messages.json[12]" is the 13th message of that file).
+type imageIndex map[string][]string
+
+func (x imageIndex) load(path string) {
+    b, err := os.ReadFile(path)
+    if err != nil { return }
+    _ = json.Unmarshal(b, &x)
+}
+
+func (x imageIndex) save(path string) error {
+    for k := range x {
+        sort.Strings(x[k])
+        x[k] = dedupeSorted(x[k])
+    }
+    b, err := json.MarshalIndent(x, "", "  ")
+    if err != nil { return err }
+    return os.WriteFile(path, b, 0o644)
+}
+
+func dedupeSorted(s []string) []string {
+    out := s[:0]
+    for i, v := range s {
+        if i == 0 || v != s[i-1] { out = append(out, v) }
+    }
+    return out
+}
+
+// imageRewriter rewrites one conversation file without its embedded images.
+type imageRewriter struct {
+    dir   string // compacted-images/
+    file  string // base name, for the index
+    drop  bool
+    index imageIndex
+
+    ref    string // current element, e.g. "ui_messages.json[3]"
+    images int
+    bytes  int64
+    files  int
+}
+
+// rewrite streams path element by element into a temp file, re-encoding only the
+// elements that held images, and renames it over path unless path changed meanwhile.
+func (r *imageRewriter) rewrite(path string) error {
+    before, err := os.Stat(path)
+    if err != nil { return err }
+    tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".compact-*")
+    if err != nil { return err }
+    defer os.Remove(tmp.Name())
+    w := bufio.NewWriter(tmp)
+    w.WriteByte('[')
+    i := 0
+    err = eachElement(path, func(raw json.RawMessage) error {
+        if i > 0 { w.WriteByte(',') }
+        r.ref = fmt.Sprintf("%s[%d]", r.file, i)
+        i++
+        out, err := r.element(raw)
+        if err != nil { return err }
+        _, err = w.Write(out)
+        return err
+    })
+    if err != nil { tmp.Close(); return err }
+    w.WriteByte(']')
+    if err := w.Flush(); err != nil { tmp.Close(); return err }
+    if err := tmp.Close(); err != nil { return err }
+    if r.images == 0 { return nil }
+    after, err := os.Stat(path)
+    if err != nil { return err }
+    if !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() { return errChangedDuringCompact }
+    if err := os.Chmod(tmp.Name(), before.Mode().Perm()); err != nil { return err }
+    return os.Rename(tmp.Name(), path)
+}
+
+// element returns raw with its images removed, or raw itself when it has none.
+func (r *imageRewriter) element(raw json.RawMessage) ([]byte, error) {
+    if !mayHoldImage(raw) { return raw, nil }
+    dec := json.NewDecoder(bytes.NewReader(raw))
+    dec.UseNumber()
+    var v any
+    if err := dec.Decode(&v); err != nil { return nil, err }
+    v, changed, err := r.strip(v)
+    if err != nil || !changed { return raw, err }
+    var buf bytes.Buffer
+    enc := json.NewEncoder(&buf)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(v); err != nil { return nil, err }
+    return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// strip removes the images from v: data URLs from "images" arrays (ui messages) and API
+// image blocks, which are replaced by a text block.
+func (r *imageRewriter) strip(v any) (any, bool, error) {
+    switch x := v.(type) {
+    case []any:
+        changed := false
+        for i, e := range x {
+            ne, c, err := r.strip(e)
+            if err != nil { return v, false, err }
+            x[i], changed = ne, changed || c
+        }
+        return x, changed, nil
+    case map[string]any:
+        if data, ok := imageBlockData(x); ok {
+            src := x["source"].(map[string]any)
+            mt, _ := src["media_type"].(string)
+            name, err := r.store(mt, data)
+            if err != nil || name == "" { return v, false, err }
+            return map[string]any{"type": "text", "text": r.placeholder(name)}, true, nil
+        }
+        changed := false
+        for k, e := range x {
+            if imgs, ok := e.([]any); ok && k == "images" {
+                kept := []any{}
+                for _, img := range imgs {
+                    s, _ := img.(string)
+                    if mt, data, ok := parseDataURL(s); ok {
+                        name, err := r.store(mt, data)
+                        if err != nil { return v, false, err }
+                        if name != "" { changed = true; continue }
+                    }
+                    kept = append(kept, img)
+                }
+                x[k] = kept
+                continue
+            }
+            ne, c, err := r.strip(e)
+            if err != nil { return v, false, err }
+            x[k], changed = ne, changed || c
+        }
+        return x, changed, nil
+    }
+    return v, false, nil
+}
+
+// store accounts for one image and, unless dropping, writes it to compacted-images/ named
+// by its content hash. It returns "" (leaving the image in place) if data is not base64.
+func (r *imageRewriter) store(mediaType, data string) (string, error) {
+    b, err := base64.StdEncoding.DecodeString(data)
+    if err != nil { return "", nil }
+    r.images++
+    r.bytes += int64(len(data))
+    if r.drop { return "-", nil }
+    sum := sha256.Sum256(b)
+    name := hex.EncodeToString(sum[:]) + imageExt(mediaType)
+    p := filepath.Join(r.dir, name)
+    if fileSize(p) != int64(len(b)) {
+        if err := os.MkdirAll(r.dir, 0o755); err != nil { return "", err }
+        if err := os.WriteFile(p, b, 0o644); err != nil { return "", err }
+        r.files++
+    }
+    r.index[name] = append(r.index[name], r.ref)
+    return name, nil
+}
+
+func (r *imageRewriter) placeholder(name string) string {
+    if r.drop { return "[image removed by roo-task-man compact]" }
+    return "[image moved by roo-task-man compact to " + compactedImagesDir + "/" + name + "]"
+}
+
+// parseDataURL splits "data:image/png;base64,…" into its media type and payload.
+func parseDataURL(s string) (mediaType, data string, ok bool) {
+    if !strings.HasPrefix(s, "data:image/") { return "", "", false }
+    head, data, ok := strings.Cut(s[len("data:"):], ",")
+    if !ok { return "", "", false }
+    mediaType, enc, _ := strings.Cut(head, ";")
+    if enc != "base64" { return "", "", false }
+    return mediaType, data, true
+}
+
+func imageExt(mediaType string) string {
+    switch mediaType {
+    case "image/jpeg":
+        return ".jpg"
+    case "image/svg+xml":
+        return ".svg"
+    case "":
+        return ".bin"
+    }
+    return "." + strings.TrimPrefix(mediaType, "image/")
+}
@@ -0,0 +1,139 @@
+package tasks
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "roocode-task-man/internal/version"
+)
+
+// BackupMeta is written next to every state DB backup, as <backup>.json, to say why the
+// backup exists.
+type BackupMeta struct {
+    Reason    string    `json:"reason"`            // e.g. "import", "delete", "restore from trash"
+    Version   string    `json:"version"`           // roo-task-man version that took it
+    CreatedAt time.Time `json:"createdAt"`
+    Source    string    `json:"source"`            // the database that was backed up
+    TaskIDs   []string  `json:"taskIds,omitempty"` // tasks the following write touched
+    Integrity string    `json:"integrity"`         // PRAGMA integrity_check of the copy
+}
+
+// copySQLite writes a consistent copy of the SQLite database src to dst with VACUUM INTO,
+// which reads through the database's own locking and so includes committed transactions
+// still in the write-ahead log, then checks the copy with PRAGMA integrity_check. dst is
+// only replaced once the copy is verified.
+func copySQLite(src, dst string) error {
+    if _, err := os.Stat(src); err != nil { return err }
+    tmp := fmt.Sprintf("%s.tmp-%d", dst, time.Now().UnixNano())
+    defer os.Remove(tmp)
+    db, err := sql.Open("sqlite", src)
+    if err != nil { return err }
+    _, _ = db.Exec("PRAGMA busy_timeout=5000")
+    _, err = db.Exec("VACUUM INTO ?", tmp)
+    db.Close()
+    if err != nil { return fmt.Errorf("vacuum into %s: %w", filepath.Base(tmp), err) }
+    if res, err := checkIntegrity(tmp); err != nil {
+        return err
+    } else if res != "ok" {
+        return fmt.Errorf("copy of %s failed the integrity check: %s", src, res)
+    }
+    if err := os.Chmod(tmp, 0o600); err != nil { return err }
+    return os.Rename(tmp, dst)
+}
+
+// checkIntegrity runs PRAGMA integrity_check on the database at path and returns its
+// result, "ok" for a sound database.
+func checkIntegrity(path string) (string, error) {
+    db, err := sql.Open("sqlite", path)
+    if err != nil { return "", err }
+    defer db.Close()
+    rows, err := db.Query("PRAGMA integrity_check")
+    if err != nil { return "", fmt.Errorf("integrity check of %s: %w", path, err) }
+    defer rows.Close()
+    var lines []string
+    for rows.Next() {
+        var s string
+        if err := rows.Scan(&s); err != nil { return "", err }
+        lines = append(lines, s)
+    }
+    if err := rows.Err(); err != nil { return "", err }
+    return strings.Join(lines, "; "), nil
+}
+
+// backupSuffix returns the suffix for the next backups of the state DB at dbPath and its
+// state.vscdb.backup twin: the current time, with -2, -3, … appended when a backup of
+// either already uses it (several writes within one second, e.g. `import a.zip b.zip`).
+func backupSuffix(dbPath string) string {
+    base := time.Now().Format("20060102-150405")
+    for n := 1; ; n++ {
+        s := base
+        if n > 1 { s = fmt.Sprintf("%s-%d", base, n) }
+        taken := false
+        for _, p := range []string{dbPath, dbPath + ".backup"} {
+            for _, f := range []string{p + ".bak-" + s, p + ".bak-" + s + ".json"} {
+                if _, err := os.Lstat(f); err == nil { taken = true }
+            }
+        }
+        if !taken { return s }
+    }
+}
+
+// backupStateDB backs the state DB at path up to <path>.bak-<suffix> (see copySQLite)
+// and records reason and taskIDs next to it. It never replaces an existing backup.
+// Callers must not write to path when it fails.
+func backupStateDB(path, suffix, reason string, taskIDs []string) error {
+    bak := path + ".bak-" + suffix
+    if _, err := os.Lstat(bak); err == nil { return fmt.Errorf("%s already exists", filepath.Base(bak)) }
+    if err := copySQLite(path, bak); err != nil { return err }
+    meta := BackupMeta{Reason: reason, Version: version.String(), CreatedAt: time.Now(), Source: path, TaskIDs: taskIDs, Integrity: "ok"}
+    b, err := json.MarshalIndent(meta, "", "  ")
+    if err != nil { return err }
+    return os.WriteFile(bak+".json", b, 0o600)
+}
+
+// existingStateDBs returns those of the state DB at dbPath and its state.vscdb.backup
+// twin that exist; writes go to both so the editor does not roll them back.
+func existingStateDBs(dbPath string) []string {
+    var out []string
+    for _, p := range []string{dbPath, dbPath + ".backup"} {
+        if _, err := os.Stat(p); err == nil { out = append(out, p) }
+    }
+    return out
+}
+
+// backupStateDBs backs up all of dbs (see existingStateDBs) under one suffix. Callers
+// write none of them until it returns nil, so a failure leaves every DB untouched.
+func backupStateDBs(dbs []string, reason string, taskIDs []string) error {
+    if len(dbs) == 0 { return nil }
+    suffix := backupSuffix(dbs[0])
+    for _, p := range dbs {
+        if err := backupStateDB(p, suffix, reason, taskIDs); err != nil { return fmt.Errorf("back up %s (nothing was changed): %w", p, err) }
+    }
+    return nil
+}
+
+// readBackupMeta reads the metadata of the backup at bak; nil for backups taken before
+// metadata was recorded.
+func readBackupMeta(bak string) *BackupMeta {
+    b, err := os.ReadFile(bak + ".json")
+    if err != nil { return nil }
+    var m BackupMeta
+    if json.Unmarshal(b, &m) != nil { return nil }
+    return &m
+}
+
+// replaceSQLite replaces the database at dst with a verified copy of src, dropping the
+// write-ahead log of the replaced database, which would otherwise be replayed into it.
+func replaceSQLite(src, dst string) error {
+    tmp := fmt.Sprintf("%s.restore-%d", dst, time.Now().UnixNano())
+    defer os.Remove(tmp)
+    if err := copySQLite(src, tmp); err != nil { return err }
+    os.Remove(dst + "-wal")
+    os.Remove(dst + "-shm")
+    return os.Rename(tmp, dst)
+}
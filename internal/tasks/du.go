@@ -0,0 +1,135 @@
+package tasks
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// DiskUsage breaks a task folder's size down by what the bytes are for.
+type DiskUsage struct {
+    Conversation int64 `json:"conversation"` // ui_messages/api_conversation_history/task metadata JSON, without images
+    Images       int64 `json:"images"`       // base64 images embedded in the JSON plus image files
+    Checkpoints  int64 `json:"checkpoints"`  // checkpoint (shadow git) repositories
+    Other        int64 `json:"other"`
+}
+
+func (u DiskUsage) Total() int64 { return u.Conversation + u.Images + u.Checkpoints + u.Other }
+
+// compactedImagesDir holds the images compact extracted from the task's JSON files.
+const compactedImagesDir = "compacted-images"
+
+// conversationFiles are the JSON files Roo keeps a task's conversation in.
+var conversationFiles = []string{"ui_messages.json", "api_conversation_history.json"}
+
+// TaskDiskUsage measures t's folder. It is cached like the task's other metadata, and
+// also remeasured when checkpoints/ or compacted-images/ changed.
+func TaskDiskUsage(t Task) DiskUsage {
+    fp, ufp := fingerprint(t.Path), subtreeFingerprint(t.Path)
+    if e, ok := taskMeta.get(t.Path, fp); ok && e.Usage != nil && e.UsageFP == ufp { return *e.Usage }
+    u := readDiskUsage(t.Path)
+    taskMeta.update(t.Path, fp, func(e *metaEntry) { e.Usage, e.UsageFP = &u, ufp })
+    return u
+}
+
+func readDiskUsage(dir string) DiskUsage {
+    var u DiskUsage
+    _ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() { return nil }
+        info, err := d.Info()
+        if err != nil { return nil }
+        rel, _ := filepath.Rel(dir, p)
+        top := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+        switch {
+        case top == "checkpoints":
+            u.Checkpoints += info.Size()
+        case top == compactedImagesDir || isImageFile(p):
+            u.Images += info.Size()
+        case rel == top && strings.HasSuffix(rel, ".json"):
+            u.Conversation += info.Size()
+        default:
+            u.Other += info.Size()
+        }
+        return nil
+    })
+    for _, name := range conversationFiles {
+        n, _ := embeddedImageBytes(filepath.Join(dir, name))
+        u.Conversation -= n
+        u.Images += n
+    }
+    return u
+}
+
+func isImageFile(p string) bool {
+    switch strings.ToLower(filepath.Ext(p)) {
+    case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".bmp":
+        return true
+    }
+    return false
+}
+
+// embeddedImageBytes sums the base64 payloads of the images embedded in a ui_messages or
+// api_conversation_history file and counts them.
+func embeddedImageBytes(path string) (n int64, count int) {
+    _ = eachElement(path, func(raw json.RawMessage) error {
+        if !mayHoldImage(raw) { return nil }
+        var v any
+        if json.Unmarshal(raw, &v) != nil { return nil }
+        walkImages(v, func(payload string) { n += int64(len(payload)); count++ })
+        return nil
+    })
+    return n, count
+}
+
+// eachElement streams the elements of the JSON array in the file at path, one element in
+// memory at a time, keeping each element's bytes verbatim.
+func eachElement(path string, fn func(json.RawMessage) error) error {
+    f, err := os.Open(path)
+    if err != nil { return err }
+    defer f.Close()
+    dec := json.NewDecoder(f)
+    tok, err := dec.Token()
+    if err == io.EOF { return nil }
+    if err != nil { return err }
+    if tok != json.Delim('[') { return fmt.Errorf("%s: not a JSON array", filepath.Base(path)) }
+    for dec.More() {
+        var raw json.RawMessage
+        if err := dec.Decode(&raw); err != nil { return err }
+        if err := fn(raw); err != nil { return err }
+    }
+    return nil
+}
+
+// mayHoldImage is a cheap pre-check before decoding an element.
+func mayHoldImage(raw []byte) bool {
+    return bytes.Contains(raw, []byte(`data:image/`)) || bytes.Contains(raw, []byte(`"base64"`))
+}
+
+// walkImages calls fn with the payload of every embedded image in v: data URLs (ui
+// messages) and {"type":"image","source":{"type":"base64","data":…}} blocks (API history,
+// including those nested in tool results).
+func walkImages(v any, fn func(payload string)) {
+    switch x := v.(type) {
+    case string:
+        if strings.HasPrefix(x, "data:image/") { fn(x) }
+    case []any:
+        for _, e := range x { walkImages(e, fn) }
+    case map[string]any:
+        if data, ok := imageBlockData(x); ok { fn(data); return }
+        for _, e := range x { walkImages(e, fn) }
+    }
+}
+
+// imageBlockData returns the base64 data of an API image block.
+func imageBlockData(m map[string]any) (string, bool) {
+    if m["type"] != "image" { return "", false }
+    src, _ := m["source"].(map[string]any)
+    if src == nil || src["type"] != "base64" { return "", false }
+    data, ok := src["data"].(string)
+    return data, ok
+}
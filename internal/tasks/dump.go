@@ -1,15 +1,48 @@
 package tasks
 
 import (
+    "encoding/json"
     "fmt"
     "io"
     "os"
+    "path/filepath"
     "strings"
+    "text/template"
     "time"
 
     "roocode-task-man/internal/config"
 )
 
+// DumpOptions controls which tasks are dumped and how they are laid out.
+type DumpOptions struct {
+    Filter       Filter
+    TemplatePath string // optional Go text/template file; empty uses the built-in layout
+    IncludeAll   bool   // also include AI responses and tool calls, not only human prompts
+}
+
+// DumpMessage is a history entry tagged with a coarse category for dump layouts:
+// prompt, request, response, tool or other.
+type DumpMessage struct {
+    HistoryItem
+    Category string
+}
+
+// DumpTask is the per-task value handed to dump templates.
+type DumpTask struct {
+    Task
+    Workspace string
+    Stats     TaskStats
+    Messages  []DumpMessage // prompts only unless IncludeAll is set
+}
+
+// DumpData is the root value handed to dump templates.
+type DumpData struct {
+    Generated time.Time
+    Editor    string
+    PluginID  string
+    Tasks     []DumpTask
+}
+
 // DumpMarkdown writes all tasks and their human prompts to a markdown file.
 // The title and each prompt are constrained to a single line.
 func DumpMarkdown(cfg config.Config, filename string) error {
@@ -18,15 +51,51 @@ func DumpMarkdown(cfg config.Config, filename string) error {
 
 // DumpMarkdownWithProgress is like DumpMarkdown but calls progress(cur,total) as it proceeds.
 func DumpMarkdownWithProgress(cfg config.Config, filename string, progress func(int, int)) error {
+    return DumpMarkdownWithOptions(cfg, filename, DumpOptions{}, progress)
+}
+
+// DumpMarkdownWithOptions writes the tasks selected by opts.Filter to filename, either with
+// the built-in layout or through the user-supplied template.
+func DumpMarkdownWithOptions(cfg config.Config, filename string, opts DumpOptions, progress func(int, int)) error {
     list, err := LoadTasks(cfg)
     if err != nil { return err }
+    var workspaces map[string]string
+    if opts.Filter.Workspace != "" || opts.TemplatePath != "" {
+        // Workspaces are only known to the editor's state DB; a missing DB is fatal only for filtering.
+        workspaces, err = TaskWorkspaces(cfg)
+        if err != nil && opts.Filter.Workspace != "" { return fmt.Errorf("workspace filter: %w", err) }
+    }
+    if len(opts.Filter.IDs) > 0 {
+        if opts.Filter.IDs, err = ResolveRefs(list, opts.Filter.IDs); err != nil { return err }
+    }
+    list = FilterTasks(list, opts.Filter, workspaces)
+
+    var tmpl *template.Template
+    if opts.TemplatePath != "" {
+        tmpl, err = template.New(filepath.Base(opts.TemplatePath)).Funcs(dumpFuncs).ParseFiles(opts.TemplatePath)
+        if err != nil { return fmt.Errorf("parse template: %w", err) }
+    }
+
     f, err := os.Create(filename)
     if err != nil { return err }
     defer f.Close()
-    return writeMarkdownWithProgress(cfg, list, f, progress)
+    if tmpl == nil {
+        return writeMarkdownWithProgress(cfg, list, f, opts.IncludeAll, progress)
+    }
+    data := DumpData{Generated: time.Now(), Editor: DisplayEditorName(cfg.CodeChannel), PluginID: cfg.PluginID}
+    for i, t := range list {
+        data.Tasks = append(data.Tasks, DumpTask{
+            Task:      t,
+            Workspace: workspaces[HistoryKey(t)],
+            Stats:     StatsFromTask(t),
+            Messages:  dumpMessages(LoadHistory(t), opts.IncludeAll),
+        })
+        if progress != nil { progress(i+1, len(list)) }
+    }
+    return tmpl.Execute(f, data)
 }
 
-func writeMarkdownWithProgress(cfg config.Config, list []Task, w io.Writer, progress func(int, int)) error {
+func writeMarkdownWithProgress(cfg config.Config, list []Task, w io.Writer, includeAll bool, progress func(int, int)) error {
     const maxTitle = 120
     const maxPrompt = 120
     total := len(list)
@@ -46,38 +115,118 @@ func writeMarkdownWithProgress(cfg config.Config, list []Task, w io.Writer, prog
 
         // If title was changed or truncated, include full content in a details block
         if changed || truncated {
-            fmt.Fprintf(w, "\n<details><summary>%s</summary>\n\n", escapeHTML(title))
-            fmt.Fprintf(w, "\n```\n%s\n```\n\n", tFull)
-            fmt.Fprintln(w, "</details>\n\n")
+            writeDetails(w, title, tFull)
         }
 
-        // Prompts (user role only)
-        hist := LoadHistory(t)
-        prompts := 0
-        for _, h := range hist { if h.Role == "user" && oneLine(h.Text) != "" { prompts++ } }
-        if prompts > 0 {
-            fmt.Fprintln(w, "## Prompts")
-            for _, h := range hist {
-                if h.Role != "user" { continue }
-                full := strings.TrimSpace(h.Text)
+        // Prompts (user role only) or, with includeAll, the whole conversation
+        msgs := dumpMessages(LoadHistory(t), includeAll)
+        lines := 0
+        for _, m := range msgs { if m.Category != "request" && oneLine(dumpText(m)) != "" { lines++ } }
+        if lines > 0 {
+            if includeAll { fmt.Fprintln(w, "## Conversation") } else { fmt.Fprintln(w, "## Prompts") }
+            for _, m := range msgs {
+                if m.Category == "request" { continue }
+                full := strings.TrimSpace(dumpText(m))
                 p, pChanged, pTrunc := CleanOneLine(full, maxPrompt)
                 if p == "" { continue }
-                fmt.Fprintf(w, "- %s\n", p)
+                if includeAll {
+                    fmt.Fprintf(w, "- **%s**: %s\n", dumpLabel(m), p)
+                } else {
+                    fmt.Fprintf(w, "- %s\n", p)
+                }
                 if pChanged || pTrunc {
-                    fmt.Fprintf(w, "\n<details><summary>%s</summary>\n\n", escapeHTML(p))
-                    fmt.Fprintf(w, "\n```\n%s\n```\n\n", full)
-                    fmt.Fprintln(w, "</details>\n\n")
+                    writeDetails(w, p, full)
                 }
             }
         }
         // Separator
-        if i != len(list)-1 { fmt.Fprintln(w, "---\n") } else { fmt.Fprintln(w) }
+        if i != len(list)-1 { fmt.Fprint(w, "---\n\n") } else { fmt.Fprintln(w) }
 
         if progress != nil { progress(i+1, total) }
     }
     return nil
 }
 
+func writeDetails(w io.Writer, summary, full string) {
+    fmt.Fprintf(w, "\n<details><summary>%s</summary>\n\n", escapeHTML(summary))
+    fmt.Fprintf(w, "\n```\n%s\n```\n\n", full)
+    fmt.Fprint(w, "</details>\n\n\n")
+}
+
+// dumpMessages categorizes history items and keeps only human prompts unless includeAll is set.
+func dumpMessages(hist []HistoryItem, includeAll bool) []DumpMessage {
+    out := make([]DumpMessage, 0, len(hist))
+    for _, h := range hist {
+        c := historyCategory(h)
+        if !includeAll && c != "prompt" { continue }
+        out = append(out, DumpMessage{HistoryItem: h, Category: c})
+    }
+    return out
+}
+
+func historyCategory(h HistoryItem) string {
+    switch h.Role {
+    case "user":
+        return "prompt"
+    case "ai":
+        return "request"
+    }
+    switch h.Kind {
+    case "text", "completion_result", "reasoning", "followup":
+        return "response"
+    case "tool", "command", "command_output", "use_mcp_server", "mcp_server_response",
+        "browser_action", "browser_action_launch", "browser_action_result":
+        return "tool"
+    }
+    return "other"
+}
+
+func dumpLabel(m DumpMessage) string {
+    switch m.Category {
+    case "prompt":
+        return "User"
+    case "response":
+        return "AI"
+    case "tool":
+        return "Tool"
+    }
+    if m.Kind != "" { return m.Kind }
+    return "Other"
+}
+
+// dumpText returns the text to show for a message. Tool calls are stored as JSON
+// objects, which CleanOneLine would drop entirely, so they are summarized first.
+func dumpText(m DumpMessage) string {
+    if m.Category == "tool" { return toolSummary(m.Text) }
+    return m.Text
+}
+
+// toolSummary turns {"tool":"readFile","path":"x.go",...} into "readFile x.go".
+// Non-JSON payloads (e.g. command lines) are returned unchanged.
+func toolSummary(s string) string {
+    var obj map[string]any
+    if !looksLikeJSON(strings.TrimSpace(s)) || json.Unmarshal([]byte(s), &obj) != nil { return s }
+    parts := []string{}
+    for _, k := range []string{"tool", "serverName", "toolName", "path", "regex", "command", "url"} {
+        if v, ok := obj[k].(string); ok && v != "" { parts = append(parts, v) }
+    }
+    if len(parts) == 0 { return "" }
+    return strings.Join(parts, " ")
+}
+
+// dumpFuncs are available to user-supplied dump templates.
+var dumpFuncs = template.FuncMap{
+    // oneLine collapses text to a single sanitized line, truncated to n runes (0 = no limit).
+    "oneLine": func(n int, s string) string { out, _, _ := CleanOneLine(s, n); return out },
+    "escapeHTML": escapeHTML,
+    "toolSummary": toolSummary,
+    "formatTime": func(layout string, t time.Time) string {
+        if t.IsZero() { return "" }
+        return t.Local().Format(layout)
+    },
+    "trim": strings.TrimSpace,
+}
+
 func oneLine(s string) string { out, _, _ := CleanOneLine(s, 0); return out }
 
 // Minimal HTML escaping for <summary> text
@@ -0,0 +1,212 @@
+package tasks
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/csv"
+    "fmt"
+    "log"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "runtime"
+    "strconv"
+    "strings"
+
+    "roocode-task-man/internal/config"
+)
+
+// EditorProcess is a running process of the editor.
+type EditorProcess struct {
+    PID  int
+    Path string // executable, or image name on Windows
+}
+
+// EditorStatus says whether the editor that owns a state DB looks like it is running.
+// The editor keeps state.vscdb in memory and writes it back when it exits, so a change
+// made while it runs is usually lost.
+type EditorStatus struct {
+    Editor    string
+    DB        string
+    Processes []EditorProcess
+    Locked    bool // another connection holds a write lock on the DB
+    WAL       bool // another connection keeps the DB open with unmerged writes in its -wal file
+}
+
+// Running reports whether anything suggests the editor has the DB open.
+func (s EditorStatus) Running() bool { return len(s.Processes) > 0 || s.Locked || s.WAL }
+
+func (s EditorStatus) String() string {
+    var why []string
+    if n := len(s.Processes); n > 0 {
+        pids := make([]string, 0, 3)
+        for _, p := range s.Processes[:min(n, 3)] { pids = append(pids, strconv.Itoa(p.PID)) }
+        more := ""
+        if n > 3 { more = fmt.Sprintf(" and %d more", n-3) }
+        why = append(why, fmt.Sprintf("%s is running (pid %s%s)", s.Editor, strings.Join(pids, ", "), more))
+    }
+    if s.Locked { why = append(why, filepath.Base(s.DB)+" is locked by another process") }
+    if s.WAL { why = append(why, filepath.Base(s.DB)+" is open in another process (its -wal file is in use)") }
+    if len(why) == 0 { return s.Editor + " is not running" }
+    return strings.Join(why, "; ")
+}
+
+// EditorRunningError is returned by the functions that write a state DB while its
+// editor is running.
+type EditorRunningError struct{ Status EditorStatus }
+
+func (e *EditorRunningError) Error() string {
+    return e.Status.String() + "; close " + e.Status.Editor + " first (or use --force)"
+}
+
+// DetectEditor looks for running processes of cfg's editor and probes its state DB for
+// locks held by other processes. Custom editors are only probed.
+func DetectEditor(cfg config.Config) (EditorStatus, error) {
+    st := EditorStatus{Editor: DisplayEditorName(cfg.CodeChannel)}
+    if dbPath, err := detectStateDBPath(cfg); err == nil {
+        st.DB = dbPath
+        for _, p := range []string{dbPath, dbPath + ".backup"} {
+            if fileSize(p) < 0 { continue }
+            locked, wal, err := probeStateDB(p)
+            if err != nil { return st, err }
+            st.Locked = st.Locked || locked
+            st.WAL = st.WAL || wal
+        }
+    }
+    m := editorMatcher(cfg)
+    if m == nil { return st, nil }
+    procs, err := listProcesses()
+    if err != nil { return st, fmt.Errorf("list processes: %w", err) }
+    self := os.Getpid()
+    for _, p := range procs {
+        if p.PID != self && m(p.Path) { st.Processes = append(st.Processes, p) }
+    }
+    return st, nil
+}
+
+// CheckEditorClosed returns an *EditorRunningError when cfg's editor is running, unless
+// cfg.Force is set. When the check itself fails it only logs in debug mode: the write
+// goes ahead as it did before the check existed.
+func CheckEditorClosed(cfg config.Config) error {
+    if cfg.Force { return nil }
+    st, err := DetectEditor(cfg)
+    if err != nil {
+        if cfg.Debug { log.Printf("[editor] detection failed: %v", err) }
+        return nil
+    }
+    if st.Running() { return &EditorRunningError{Status: st} }
+    return nil
+}
+
+// probeStateDB tries to take the write lock on the database at path without waiting,
+// then closes it. A database in WAL mode whose -wal file is still non-empty after that
+// is held open by another process: the last connection to close merges and deletes it.
+func probeStateDB(path string) (locked, wal bool, err error) {
+    db, err := sql.Open("sqlite", path)
+    if err != nil { return false, false, err }
+    db.SetMaxOpenConns(1)
+    _, _ = db.Exec("PRAGMA busy_timeout=0")
+    if _, err := db.Exec("BEGIN IMMEDIATE"); err != nil {
+        if !isBusy(err) { db.Close(); return false, false, err }
+        locked = true
+    } else {
+        _, _ = db.Exec("ROLLBACK")
+    }
+    db.Close()
+    return locked, fileSize(path+"-wal") > 0, nil
+}
+
+func isBusy(err error) bool {
+    s := strings.ToLower(err.Error())
+    return strings.Contains(s, "locked") || strings.Contains(s, "busy")
+}
+
+// editorMatcher returns a test for executable paths of cfg's editor, nil when the editor
+// cannot be recognized by its processes (custom editors, remote server homes).
+func editorMatcher(cfg config.Config) func(path string) bool {
+    if dir, ok := serverChannel(cfg.CodeChannel); ok {
+        if cfg.RemoteHome != "" { return nil } // the server runs on another machine
+        marker := dir + "/"
+        return func(path string) bool { return strings.Contains(filepath.ToSlash(path), "/"+marker) }
+    }
+    app, custom := mapEditorChannel(cfg.CodeChannel)
+    if custom || app == "" { return nil }
+    names := map[string]bool{strings.ToLower(app): true}
+    bundle := app + ".app"
+    switch app {
+    case "Code":
+        bundle = "Visual Studio Code.app"
+    case "Code - Insiders":
+        names["code-insiders"] = true
+        bundle = "Visual Studio Code - Insiders.app"
+    case "VSCodium":
+        names["codium"] = true
+    }
+    return func(path string) bool {
+        p := strings.ReplaceAll(path, "\\", "/")
+        if strings.Contains(p, "/"+bundle+"/") { return true }
+        base := strings.ToLower(p[strings.LastIndex(p, "/")+1:])
+        return names[strings.TrimSuffix(base, ".exe")]
+    }
+}
+
+// listProcesses lists the running processes with their executables. It is a variable
+// so tests can replace it.
+var listProcesses = func() ([]EditorProcess, error) {
+    switch runtime.GOOS {
+    case "linux":
+        return procProcesses()
+    case "windows":
+        return tasklistProcesses()
+    }
+    return psProcesses()
+}
+
+// procProcesses reads argv[0] of every process from /proc.
+func procProcesses() ([]EditorProcess, error) {
+    es, err := os.ReadDir("/proc")
+    if err != nil { return nil, err }
+    var out []EditorProcess
+    for _, e := range es {
+        pid, err := strconv.Atoi(e.Name())
+        if err != nil { continue }
+        b, err := os.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+        if err != nil || len(b) == 0 { continue } // gone, or a kernel thread
+        arg0, _, _ := bytes.Cut(b, []byte{0})
+        out = append(out, EditorProcess{PID: pid, Path: string(arg0)})
+    }
+    return out, nil
+}
+
+// psProcesses lists processes with ps (macOS, BSDs), which prints full executable paths.
+func psProcesses() ([]EditorProcess, error) {
+    b, err := exec.Command("ps", "-axo", "pid=,comm=").Output()
+    if err != nil { return nil, err }
+    var out []EditorProcess
+    for _, line := range strings.Split(string(b), "\n") {
+        f, path, ok := strings.Cut(strings.TrimSpace(line), " ")
+        if !ok { continue }
+        pid, err := strconv.Atoi(f)
+        if err != nil { continue }
+        out = append(out, EditorProcess{PID: pid, Path: strings.TrimSpace(path)})
+    }
+    return out, nil
+}
+
+// tasklistProcesses lists processes on Windows, by image name.
+func tasklistProcesses() ([]EditorProcess, error) {
+    b, err := exec.Command("tasklist", "/fo", "csv", "/nh").Output()
+    if err != nil { return nil, err }
+    r := csv.NewReader(bytes.NewReader(b))
+    r.FieldsPerRecord = -1
+    recs, err := r.ReadAll()
+    if err != nil { return nil, err }
+    var out []EditorProcess
+    for _, rec := range recs {
+        if len(rec) < 2 { continue }
+        pid, err := strconv.Atoi(rec[1])
+        if err != nil { continue }
+        out = append(out, EditorProcess{PID: pid, Path: rec[0]})
+    }
+    return out, nil
+}
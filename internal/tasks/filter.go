@@ -0,0 +1,63 @@
+package tasks
+
+import (
+    "strings"
+    "time"
+)
+
+// Filter selects tasks for batch operations (export, dump).
+// IDs and the date range combine with union semantics, as --export always did;
+// Workspace and Query then narrow whatever that selected (or the full list when
+// neither IDs nor dates are given).
+type Filter struct {
+    IDs       []string
+    From      *time.Time
+    To        *time.Time
+    Workspace string // case-insensitive substring of the taskHistory workspace path
+    Query     string // case-insensitive substring of title, ID or any human prompt
+}
+
+// IsZero reports whether the filter selects everything.
+func (f Filter) IsZero() bool {
+    return len(f.IDs) == 0 && f.From == nil && f.To == nil && f.Workspace == "" && f.Query == ""
+}
+
+// FilterTasks applies f to list, keeping the input order. workspaces maps task keys
+// (see HistoryKey) to their workspace path and is only consulted when f.Workspace is set.
+func FilterTasks(list []Task, f Filter, workspaces map[string]string) []Task {
+    idSet := map[string]struct{}{}
+    for _, id := range f.IDs { idSet[id] = struct{}{} }
+    hasDates := f.From != nil || f.To != nil
+    ws := strings.ToLower(f.Workspace)
+    q := strings.ToLower(strings.TrimSpace(f.Query))
+
+    out := make([]Task, 0, len(list))
+    for _, t := range list {
+        if len(idSet) > 0 || hasDates {
+            include := false
+            if _, ok := idSet[t.ID]; ok { include = true }
+            if hasDates && inDateRange(t.CreatedAt, f.From, f.To) { include = true }
+            if !include { continue }
+        }
+        if ws != "" && !strings.Contains(strings.ToLower(workspaces[HistoryKey(t)]), ws) { continue }
+        if q != "" && !matchesQuery(t, q) { continue }
+        out = append(out, t)
+    }
+    return out
+}
+
+func inDateRange(at time.Time, from, to *time.Time) bool {
+    if from != nil && at.Before(*from) { return false }
+    if to != nil && at.After(*to) { return false }
+    return true
+}
+
+// matchesQuery checks the lower-cased query against title, ID and human prompts.
+func matchesQuery(t Task, q string) bool {
+    if strings.Contains(strings.ToLower(t.Title), q) || strings.Contains(strings.ToLower(t.ID), q) { return true }
+    for _, h := range LoadHistory(t) {
+        if h.Role != "user" { continue }
+        if strings.Contains(strings.ToLower(h.Text), q) { return true }
+    }
+    return false
+}
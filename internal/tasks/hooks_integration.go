@@ -10,22 +10,29 @@ import (
 
 // LoadTasksWithHooks applies discovery and decoration hooks when available.
 func LoadTasksWithHooks(cfg config.Config, env *hooks.HookEnv) ([]Task, error) {
-    root, err := ResolveStorageRoot(cfg)
+    srcs, err := selectedSources(cfg)
     if err != nil { return nil, err }
 
-    // Discovery override
-    var dirs []string
-    if env != nil {
-        if ss, ok := env.CallStringSlice("discoverCandidates", root); ok && len(ss) > 0 {
-            if cfg.Debug { log.Printf("[hooks] discoverCandidates returned %d dirs", len(ss)) }
-            dirs = ss
+    openMetaCache(cfg)
+    var list []Task
+    for _, s := range srcs {
+        // Discovery override
+        var dirs []string
+        if env != nil {
+            if ss, ok := env.CallStringSlice("discoverCandidates", s.Root); ok && len(ss) > 0 {
+                if cfg.Debug { log.Printf("[hooks] discoverCandidates returned %d dirs", len(ss)) }
+                dirs = ss
+            }
         }
+        if len(dirs) == 0 {
+            dirs = DiscoverTaskDirs(s.Root)
+        }
+        part := BuildTasksFromDirs(dirs)
+        if MultiSource(cfg) { setSource(part, s) }
+        list = append(list, part...)
     }
-    if len(dirs) == 0 {
-        dirs = DiscoverTaskDirs(root)
-    }
-
-    list := BuildTasksFromDirs(dirs)
+    SaveMetaCache(cfg)
+    sortByCreatedDesc(list)
     // Extend/decorate
     for i := range list {
         t := &list[i]
@@ -54,6 +61,7 @@ func taskToMap(t Task) map[string]any {
         "createdAt": t.CreatedAt.Format(time.RFC3339),
         "path":      t.Path,
         "meta":      t.Meta,
+        "source":    t.Source,
     }
 }
 
@@ -0,0 +1,264 @@
+package tasks
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// uiMessage is one ui_messages.json entry as far as this package reads it. Images is
+// non-nil (an empty array) when the message carried images; see MessageReader.
+type uiMessage struct {
+    Ts      int64  `json:"ts"`
+    Type    string `json:"type"`
+    Say     string `json:"say"`
+    Ask     string `json:"ask"`
+    Text    string `json:"text"`
+    Images  any    `json:"images"`
+    Partial bool   `json:"partial"`
+}
+
+// messagesPath is the ui_messages.json of a task directory.
+func messagesPath(dir string) string { return filepath.Join(dir, "ui_messages.json") }
+
+// MessageReader streams the elements of a ui_messages.json array one at a time. Each
+// message's top-level "images" value is skipped on the fly and replaced by an empty
+// array, so embedded screenshots are never held in memory; skipped messages are not
+// buffered at all.
+type MessageReader struct {
+    f       *os.File
+    r       *bufio.Reader
+    started bool
+    done    bool
+    buf     []byte
+}
+
+// OpenMessages opens a ui_messages.json file for streaming.
+func OpenMessages(path string) (*MessageReader, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    return &MessageReader{f: f, r: bufio.NewReaderSize(f, 64<<10)}, nil
+}
+
+func (m *MessageReader) Close() error { return m.f.Close() }
+
+// Next decodes the next message into v (which may be nil to only read it) and returns
+// io.EOF after the last one.
+func (m *MessageReader) Next(v any) error {
+    raw, err := m.NextRaw()
+    if err != nil { return err }
+    if v == nil { return nil }
+    return json.Unmarshal(raw, v)
+}
+
+// NextRaw returns the next message's JSON with images stripped. The slice is only valid
+// until the following call.
+func (m *MessageReader) NextRaw() (json.RawMessage, error) {
+    if ok, err := m.advance(); err != nil || !ok {
+        if err == nil { err = io.EOF }
+        return nil, err
+    }
+    m.buf = m.buf[:0]
+    if err := m.message(); err != nil { return nil, m.wrap(err) }
+    return m.buf, nil
+}
+
+// Skip moves past the next message without decoding or buffering it; io.EOF after the last.
+func (m *MessageReader) Skip() error {
+    if ok, err := m.advance(); err != nil || !ok {
+        if err == nil { err = io.EOF }
+        return err
+    }
+    return m.wrap(m.value(false))
+}
+
+func (m *MessageReader) wrap(err error) error {
+    if err == io.EOF { err = io.ErrUnexpectedEOF }
+    if err != nil { return fmt.Errorf("%s: %w", m.f.Name(), err) }
+    return nil
+}
+
+// advance positions the reader at the start of the next element and reports false at
+// the end of the array.
+func (m *MessageReader) advance() (bool, error) {
+    if m.done { return false, nil }
+    c, err := m.nonSpace()
+    if err != nil { return false, m.wrap(err) }
+    if !m.started {
+        if c != '[' { return false, fmt.Errorf("%s: not a JSON array", m.f.Name()) }
+        m.started = true
+        if c, err = m.nonSpace(); err != nil { return false, m.wrap(err) }
+        if c == ']' { m.done = true; return false, nil }
+        return true, m.r.UnreadByte()
+    }
+    switch c {
+    case ',':
+        return true, nil
+    case ']':
+        m.done = true
+        return false, nil
+    }
+    return false, fmt.Errorf("%s: unexpected %q between messages", m.f.Name(), c)
+}
+
+func (m *MessageReader) nonSpace() (byte, error) {
+    for {
+        c, err := m.r.ReadByte()
+        if err != nil { return 0, err }
+        if c != ' ' && c != '\n' && c != '\r' && c != '\t' { return c, nil }
+    }
+}
+
+// message copies one element into m.buf, replacing a top-level "images" value.
+func (m *MessageReader) message() error {
+    c, err := m.nonSpace()
+    if err != nil { return err }
+    if c != '{' {
+        if err := m.r.UnreadByte(); err != nil { return err }
+        return m.value(true)
+    }
+    m.buf = append(m.buf, '{')
+    for {
+        if c, err = m.nonSpace(); err != nil { return err }
+        switch c {
+        case '}':
+            m.buf = append(m.buf, '}')
+            return nil
+        case ',':
+            m.buf = append(m.buf, ',')
+            continue
+        case '"':
+        default:
+            return fmt.Errorf("unexpected %q in message", c)
+        }
+        start := len(m.buf)
+        m.buf = append(m.buf, '"')
+        if err := m.str(true); err != nil { return err }
+        images := bytes.Equal(m.buf[start:], []byte(`"images"`))
+        if c, err = m.nonSpace(); err != nil { return err }
+        if c != ':' { return fmt.Errorf("expected ':' after key, got %q", c) }
+        m.buf = append(m.buf, ':')
+        if !images {
+            if err := m.value(true); err != nil { return err }
+            continue
+        }
+        if c, err = m.nonSpace(); err != nil { return err }
+        if err := m.r.UnreadByte(); err != nil { return err }
+        if c == 'n' { // null: keep it, it means "no images"
+            if err := m.value(true); err != nil { return err }
+            continue
+        }
+        if err := m.value(false); err != nil { return err }
+        m.buf = append(m.buf, '[', ']')
+    }
+}
+
+// value reads one JSON value, appending it to m.buf when keep is set.
+func (m *MessageReader) value(keep bool) error {
+    c, err := m.nonSpace()
+    if err != nil { return err }
+    if keep { m.buf = append(m.buf, c) }
+    switch c {
+    case '"':
+        return m.str(keep)
+    case '{', '[':
+        for depth := 1; depth > 0; {
+            if c, err = m.r.ReadByte(); err != nil { return err }
+            if keep { m.buf = append(m.buf, c) }
+            switch c {
+            case '"':
+                if err := m.str(keep); err != nil { return err }
+            case '{', '[':
+                depth++
+            case '}', ']':
+                depth--
+            }
+        }
+        return nil
+    }
+    // number, true, false or null: runs until a delimiter
+    for {
+        if c, err = m.r.ReadByte(); err != nil { return err }
+        switch c {
+        case ',', '}', ']', ' ', '\n', '\r', '\t':
+            return m.r.UnreadByte()
+        }
+        if keep { m.buf = append(m.buf, c) }
+    }
+}
+
+// str reads the rest of a string whose opening quote was consumed, a buffer at a time.
+func (m *MessageReader) str(keep bool) error {
+    carry := 0 // backslashes ending the previous chunk
+    for {
+        chunk, err := m.r.ReadSlice('"')
+        if keep { m.buf = append(m.buf, chunk...) }
+        if errors.Is(err, bufio.ErrBufferFull) {
+            if n := trailingBackslashes(chunk); n == len(chunk) { carry += n } else { carry = n }
+            continue
+        }
+        if err != nil { return err }
+        body := chunk[:len(chunk)-1]
+        n := trailingBackslashes(body)
+        if n == len(body) { n += carry }
+        if n%2 == 0 { return nil }
+        carry = 0
+    }
+}
+
+func trailingBackslashes(b []byte) int {
+    n := 0
+    for i := len(b) - 1; i >= 0 && b[i] == '\\'; i-- { n++ }
+    return n
+}
+
+// FirstMessage decodes the first message of the file at path into v; it returns io.EOF
+// when the array is empty.
+func FirstMessage(path string, v any) error {
+    m, err := OpenMessages(path)
+    if err != nil { return err }
+    defer m.Close()
+    return m.Next(v)
+}
+
+// LastMessages returns the last n messages of the file at path (images stripped),
+// keeping only n messages in memory while it reads.
+func LastMessages(path string, n int) ([]json.RawMessage, error) {
+    if n <= 0 { return nil, nil }
+    m, err := OpenMessages(path)
+    if err != nil { return nil, err }
+    defer m.Close()
+    ring := make([]json.RawMessage, 0, n)
+    total := 0
+    for {
+        raw, err := m.NextRaw()
+        if err == io.EOF { break }
+        if err != nil { return nil, err }
+        cp := append(json.RawMessage(nil), raw...)
+        if len(ring) < n { ring = append(ring, cp) } else { ring[total%n] = cp }
+        total++
+    }
+    if len(ring) < n { return ring, nil }
+    start := total % n
+    return append(ring[start:], ring[:start]...), nil
+}
+
+// eachMessage streams every message of the file at path into fn, stopping early when
+// fn returns false.
+func eachMessage(path string, fn func(uiMessage) bool) error {
+    m, err := OpenMessages(path)
+    if err != nil { return err }
+    defer m.Close()
+    for {
+        var msg uiMessage
+        err := m.Next(&msg)
+        if err == io.EOF { return nil }
+        if err != nil { return err }
+        if !fn(msg) { return nil }
+    }
+}
@@ -0,0 +1,303 @@
+package tasks
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "roocode-task-man/internal/config"
+)
+
+// ParseSource parses "Editor[:pluginID]" (e.g. "Cursor:kilocode.kilo-code"). The plugin
+// defaults to cfg.PluginID; the editor accepts the same names as --editor.
+func ParseSource(spec string, cfg config.Config) (Source, error) {
+    editor, plugin := spec, cfg.PluginID
+    if i := strings.Index(spec, ":"); i >= 0 { editor, plugin = spec[:i], spec[i+1:] }
+    editor, plugin = strings.TrimSpace(editor), strings.TrimSpace(plugin)
+    if editor == "" || plugin == "" { return Source{}, fmt.Errorf("expected Editor:plugin-id, got %q", spec) }
+    if _, custom := mapEditorChannel(editor); custom { return Source{}, fmt.Errorf("%q has no fixed storage location", editor) }
+    s := Source{Editor: DisplayEditorName(editor), PluginID: plugin}
+    root, err := ResolveStorageRoot(s.Config(cfg))
+    if err != nil { return Source{}, err }
+    s.Root = root
+    return s, nil
+}
+
+// PathRewrite replaces the From prefix of a path with To.
+type PathRewrite struct {
+    From string
+    To   string
+}
+
+// ParsePathRewrite parses "from=to".
+func ParsePathRewrite(s string) (PathRewrite, error) {
+    i := strings.Index(s, "=")
+    if i <= 0 || i == len(s)-1 { return PathRewrite{}, fmt.Errorf("expected from=to, got %q", s) }
+    return PathRewrite{From: s[:i], To: s[i+1:]}, nil
+}
+
+// RewritePath applies the longest matching rule. A rule matches when From equals p or is
+// a prefix of p ending at a path separator; p is returned unchanged when nothing matches.
+func RewritePath(p string, rules []PathRewrite) string {
+    out, _ := MatchPathRewrite(p, rules)
+    return out
+}
+
+// MatchPathRewrite is RewritePath that also returns the index of the rule applied, -1
+// when none matched. Of equally long rules the first wins.
+func MatchPathRewrite(p string, rules []PathRewrite) (string, int) {
+    best := -1
+    for i, r := range rules {
+        from := strings.TrimRight(r.From, `/\`)
+        if from == "" { continue }
+        if p != from && !strings.HasPrefix(p, from+"/") && !strings.HasPrefix(p, from+`\`) { continue }
+        if best < 0 || len(from) > len(strings.TrimRight(rules[best].From, `/\`)) { best = i }
+    }
+    if best < 0 { return p, -1 }
+    from := strings.TrimRight(rules[best].From, `/\`)
+    return strings.TrimRight(rules[best].To, `/\`) + p[len(from):], best
+}
+
+// PathRewrites returns the pathMap rules of the config.
+func PathRewrites(cfg config.Config) []PathRewrite {
+    out := make([]PathRewrite, 0, len(cfg.PathMap))
+    for _, m := range cfg.PathMap {
+        if m.From != "" && m.To != "" { out = append(out, PathRewrite{From: m.From, To: m.To}) }
+    }
+    return out
+}
+
+// ImportWorkspace is the workspace an imported task is registered under, and why.
+type ImportWorkspace struct {
+    ID       string
+    Original string       // workspace recorded in the archive; empty for older archives
+    Path     string       // where the task is registered
+    Rule     *PathRewrite // the rule that mapped Original, if any
+    Reason   string       // "flag", "rule", "original" (exists here) or "cwd"
+}
+
+// MapImportWorkspace decides where an imported task goes: the --workspace override when
+// given, else its original workspace mapped by the first-longest matching rule, else the
+// original when that directory exists on this machine, else cwd.
+func MapImportWorkspace(id, original, override, cwd string, rules []PathRewrite) ImportWorkspace {
+    w := ImportWorkspace{ID: id, Original: original}
+    switch {
+    case override != "":
+        w.Path, w.Reason = override, "flag"
+    case original == "":
+        w.Path, w.Reason = cwd, "cwd"
+    default:
+        if p, i := MatchPathRewrite(original, rules); i >= 0 {
+            w.Path, w.Reason, w.Rule = p, "rule", &rules[i]
+        } else if isDir(original) {
+            w.Path, w.Reason = original, "original"
+        } else {
+            w.Path, w.Reason = cwd, "cwd"
+        }
+    }
+    return w
+}
+
+// historySchema names the taskHistory entry layout an extension uses.
+func historySchema(pluginID string) string {
+    if strings.EqualFold(pluginID, "saoudrizwan.claude-dev") { return "cline" }
+    return "roo" // Roo Code and forks that kept its HistoryItem (Kilo Code, …)
+}
+
+// HistoryWorkspace returns the workspace path recorded in a taskHistory entry of either schema.
+func HistoryWorkspace(e map[string]any) string {
+    if ws, _ := e["workspace"].(string); ws != "" { return ws }
+    ws, _ := e["cwdOnTaskInitialization"].(string)
+    return ws
+}
+
+// TranslateHistoryEntry converts a taskHistory entry from one extension's schema to
+// another's, setting the workspace to workspace. Fields the target does not know are
+// dropped when schemas differ and kept when they match.
+func TranslateHistoryEntry(e map[string]any, fromPlugin, toPlugin, workspace string) map[string]any {
+    from, to := historySchema(fromPlugin), historySchema(toPlugin)
+    out := map[string]any{}
+    if from == to {
+        for k, v := range e { out[k] = v }
+    } else {
+        for _, k := range []string{"id", "ts", "task", "tokensIn", "tokensOut", "cacheWrites", "cacheReads", "totalCost", "size", "isFavorited"} {
+            if v, ok := e[k]; ok { out[k] = v }
+        }
+    }
+    switch to {
+    case "cline":
+        delete(out, "workspace")
+        out["cwdOnTaskInitialization"] = workspace
+    default:
+        delete(out, "cwdOnTaskInitialization")
+        out["workspace"] = workspace
+        if _, ok := out["number"]; !ok { out["number"] = 1 }
+        if _, ok := out["mode"]; !ok { out["mode"] = "code" }
+    }
+    return out
+}
+
+// HistoryEntryFromTask builds a taskHistory entry from the task directory when the
+// source editor has none for it.
+func HistoryEntryFromTask(t Task) map[string]any {
+    st := StatsFromTask(t)
+    return map[string]any{
+        "id": t.ID, "ts": t.CreatedAt.UnixMilli(), "task": t.Summary,
+        "tokensIn": st.TokensIn, "tokensOut": st.TokensOut,
+        "cacheWrites": st.CacheWrites, "cacheReads": st.CacheReads,
+        "totalCost": st.TotalCost, "size": st.SizeBytes,
+    }
+}
+
+// MigrateOptions configures MigrateTasks.
+type MigrateOptions struct {
+    From, To  Source
+    Filter    Filter
+    Rewrites  []PathRewrite // applied to each task's workspace
+    Overwrite bool          // replace task directories that already exist in the target
+    DryRun    bool
+    Config    config.Config // base settings (debug, remote home) for both sides
+}
+
+// MigrateResult reports what happened to one task.
+type MigrateResult struct {
+    ID        string
+    Dest      string
+    Workspace string // after rewriting
+    Skipped   string // reason, empty when copied
+}
+
+// MigrateTasks copies the tasks selected by opts.Filter from one editor/extension to
+// another and registers them in the target editor's state.vscdb (and its .backup),
+// translating taskHistory entries between extension schemas.
+func MigrateTasks(opts MigrateOptions) ([]MigrateResult, error) {
+    if opts.From.Label() == opts.To.Label() { return nil, fmt.Errorf("source and target are the same (%s)", opts.From.Label()) }
+    fromCfg := opts.From.Config(opts.Config)
+    toCfg := opts.To.Config(opts.Config)
+    debug := opts.Config.Debug
+
+    list, err := LoadTasks(fromCfg)
+    if err != nil { return nil, err }
+    hist, err := HistoryIndex(fromCfg)
+    if err != nil {
+        if opts.Filter.Workspace != "" { return nil, fmt.Errorf("workspace filter: %w", err) }
+        if debug { log.Printf("[migrate] source taskHistory unavailable: %v", err) }
+    }
+    workspaces := map[string]string{}
+    for id, e := range hist { workspaces[id] = HistoryWorkspace(e) }
+    if len(opts.Filter.IDs) > 0 {
+        if opts.Filter.IDs, err = ResolveRefs(list, opts.Filter.IDs); err != nil { return nil, err }
+    }
+    selected := FilterTasks(list, opts.Filter, workspaces)
+    if len(selected) == 0 { return nil, fmt.Errorf("no tasks in %s matched", opts.From.Label()) }
+
+    dbPath := ""
+    if !opts.DryRun {
+        if dbPath, err = detectStateDBPath(toCfg); err != nil { return nil, err }
+        if err := CheckEditorClosed(toCfg); err != nil { return nil, err }
+    }
+
+    destRoot := filepath.Join(opts.To.Root, "tasks")
+    var results []MigrateResult
+    var copies []Task // tasks to copy, in the order of entries
+    var entries []map[string]any
+    for _, t := range selected {
+        r := MigrateResult{ID: t.ID, Dest: filepath.Join(destRoot, t.ID), Workspace: RewritePath(workspaces[t.ID], opts.Rewrites)}
+        if _, err := os.Stat(r.Dest); err == nil && !opts.Overwrite {
+            r.Skipped = "already exists in target (use --overwrite)"
+            results = append(results, r)
+            continue
+        }
+        src, ok := hist[t.ID]
+        if !ok { src = HistoryEntryFromTask(t) }
+        entries = append(entries, TranslateHistoryEntry(src, opts.From.PluginID, opts.To.PluginID, r.Workspace))
+        copies = append(copies, t)
+        results = append(results, r)
+    }
+    if opts.DryRun || len(entries) == 0 { return results, nil }
+
+    // Back up before copying anything, so a failed backup leaves no orphan folders.
+    dbs := existingStateDBs(dbPath)
+    ids := make([]string, 0, len(copies))
+    for _, t := range copies { ids = append(ids, t.ID) }
+    if err := backupStateDBs(dbs, "migrate from "+opts.From.Label(), ids); err != nil { return results, err }
+    var copyErr error
+    for i, t := range copies {
+        dest := filepath.Join(destRoot, t.ID)
+        if err := os.RemoveAll(dest); err != nil { copyErr = err }
+        if copyErr == nil {
+            if err := copyDir(t.Path, dest); err != nil {
+                os.RemoveAll(dest)
+                copyErr = fmt.Errorf("copy %s: %w", t.ID, err)
+            }
+        }
+        if copyErr != nil {
+            // Register what was copied; the rest was not migrated.
+            entries = entries[:i]
+            break
+        }
+    }
+    if len(entries) > 0 {
+        for _, p := range dbs {
+            if err := mergeHistoryEntries(p, opts.To.PluginID, entries); err != nil { return results, fmt.Errorf("register in %s: %w", p, err) }
+        }
+    }
+    return results, copyErr
+}
+
+// mergeHistoryEntries writes entries into pluginID's taskHistory, replacing entries with
+// the same id in place and appending the rest; other entries keep their order.
+func mergeHistoryEntries(dbPath, pluginID string, entries []map[string]any) error {
+    db, err := sql.Open("sqlite", dbPath)
+    if err != nil { return err }
+    defer db.Close()
+    _, _ = db.Exec("PRAGMA busy_timeout=5000")
+    _, _ = db.Exec("PRAGMA journal_mode=WAL")
+    if _, err := db.Exec("BEGIN IMMEDIATE"); err != nil { return err }
+    defer db.Exec("ROLLBACK")
+    if _, err := db.Exec("CREATE TABLE IF NOT EXISTS ItemTable (key TEXT PRIMARY KEY, value BLOB)"); err != nil { return err }
+
+    var raw []byte
+    err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&raw)
+    if err == sql.ErrNoRows { raw = []byte(`{"taskHistory":[]}`) } else if err != nil { return err }
+    var doc map[string]any
+    if err := json.Unmarshal(raw, &doc); err != nil { return fmt.Errorf("parse json: %w", err) }
+    hist, _ := doc["taskHistory"].([]any)
+    byID := map[string]int{}
+    for i, it := range hist {
+        if m, ok := it.(map[string]any); ok {
+            if id, _ := m["id"].(string); id != "" { byID[id] = i }
+        }
+    }
+    for _, e := range entries {
+        id, _ := e["id"].(string)
+        if i, ok := byID[id]; ok { hist[i] = e; continue }
+        byID[id] = len(hist)
+        hist = append(hist, e)
+    }
+    doc["taskHistory"] = hist
+    b, err := json.Marshal(doc)
+    if err != nil { return err }
+    if _, err := db.Exec("INSERT INTO ItemTable(key, value) VALUES(?, ?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", pluginID, b); err != nil { return err }
+    if _, err := db.Exec("COMMIT"); err != nil { return err }
+    _, _ = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+    return nil
+}
+
+// copyDir copies the regular files under src into dst, creating directories as needed.
+func copyDir(src, dst string) error {
+    return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+        if err != nil { return err }
+        rel, err := filepath.Rel(src, p)
+        if err != nil { return err }
+        target := filepath.Join(dst, rel)
+        if d.IsDir() { return os.MkdirAll(target, 0o755) }
+        if !d.Type().IsRegular() { return nil }
+        return copyFile(p, target)
+    })
+}
@@ -0,0 +1,67 @@
+package tasks
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+
+    "roocode-task-man/internal/config"
+)
+
+// PruneCandidate is a task selected by PlanPrune.
+type PruneCandidate struct {
+    *Row
+    Rules   []string // labels of the rules that matched
+    Archive bool     // a matching rule asks for an archive before deletion
+}
+
+// RuleLabel names a rule in reports: its name, or a description of its conditions.
+func RuleLabel(r config.PruneRule) string {
+    switch {
+    case r.Name != "":
+        return r.Name
+    case r.Where != "" && r.KeepPerWorkspace > 0:
+        return fmt.Sprintf("%s (beyond %d per workspace)", r.Where, r.KeepPerWorkspace)
+    case r.KeepPerWorkspace > 0:
+        return fmt.Sprintf("beyond %d per workspace", r.KeepPerWorkspace)
+    }
+    return r.Where
+}
+
+// PlanPrune returns the rows matching any rule, newest first. Favorited tasks are never
+// pruned. Within one rule, Where and KeepPerWorkspace must both hold: the newest
+// KeepPerWorkspace tasks matching Where in each workspace are spared.
+func PlanPrune(rows []*Row, rules []config.PruneRule) ([]PruneCandidate, error) {
+    if len(rules) == 0 { return nil, errors.New("no prune rules configured") }
+    sorted := append([]*Row(nil), rows...)
+    sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+    byRow := map[*Row]*PruneCandidate{}
+    var out []*PruneCandidate
+    for i, rule := range rules {
+        if rule.Where == "" && rule.KeepPerWorkspace <= 0 {
+            return nil, fmt.Errorf("prune rule %d (%s) has no conditions and would match every task", i+1, rule.Name)
+        }
+        q, err := ParseQuery(rule.Where)
+        if err != nil { return nil, fmt.Errorf("prune rule %d (%s): %w", i+1, RuleLabel(rule), err) }
+        seen := map[string]int{} // workspace -> matching tasks so far, newest first
+        for _, r := range sorted {
+            if r.Favorite || !q.Match(r) { continue }
+            if rule.KeepPerWorkspace > 0 {
+                seen[r.Workspace]++
+                if seen[r.Workspace] <= rule.KeepPerWorkspace { continue }
+            }
+            c, ok := byRow[r]
+            if !ok {
+                c = &PruneCandidate{Row: r}
+                byRow[r] = c
+                out = append(out, c)
+            }
+            c.Rules = append(c.Rules, RuleLabel(rule))
+            c.Archive = c.Archive || rule.Archive
+        }
+    }
+    sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+    res := make([]PruneCandidate, len(out))
+    for i, c := range out { res[i] = *c }
+    return res, nil
+}
@@ -0,0 +1,566 @@
+package tasks
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Row is a task enriched with editor metadata for querying, sorting and listing.
+// Expensive fields (stats, history, touched files) are loaded on first use.
+type Row struct {
+    Task
+    Workspace string
+    Mode      string
+    Favorite  bool // isFavorited in taskHistory
+
+    stats     *TaskStats
+    usage     *DiskUsage
+    hist      []HistoryItem
+    histDone  bool
+    files     []string
+    filesDone bool
+}
+
+// NewRows wraps tasks as rows, taking workspace and mode from taskHistory entries
+// keyed by HistoryKey (see HistoryIndex). history may be nil.
+func NewRows(list []Task, history map[string]map[string]any) []*Row {
+    rows := make([]*Row, 0, len(list))
+    for _, t := range list {
+        r := &Row{Task: t}
+        if h, ok := history[HistoryKey(t)]; ok {
+            r.Workspace = HistoryWorkspace(h)
+            r.Mode, _ = h["mode"].(string)
+            r.Favorite, _ = h["isFavorited"].(bool)
+        }
+        rows = append(rows, r)
+    }
+    return rows
+}
+
+func (r *Row) Stats() TaskStats {
+    if r.stats == nil { st := StatsFromTask(r.Task); r.stats = &st }
+    return *r.stats
+}
+
+// Usage is the task's disk usage breakdown (see TaskDiskUsage), computed once per row.
+func (r *Row) Usage() DiskUsage {
+    if r.usage == nil { u := TaskDiskUsage(r.Task); r.usage = &u }
+    return *r.usage
+}
+
+func (r *Row) History() []HistoryItem {
+    if !r.histDone { r.hist = LoadHistory(r.Task); r.histDone = true }
+    return r.hist
+}
+
+// Files returns paths the task touched: task_metadata.json files_in_context entries
+// plus the "path" of every tool call recorded in ui_messages.json.
+func (r *Row) Files() []string {
+    if r.filesDone { return r.files }
+    r.filesDone = true
+    seen := map[string]bool{}
+    add := func(p string) { if p != "" && !seen[p] { seen[p] = true; r.files = append(r.files, p) } }
+    if b, err := os.ReadFile(filepath.Join(r.Path, "task_metadata.json")); err == nil {
+        var meta struct {
+            Files []struct{ Path string `json:"path"` } `json:"files_in_context"`
+        }
+        if json.Unmarshal(b, &meta) == nil {
+            for _, f := range meta.Files { add(f.Path) }
+        }
+    }
+    for _, h := range r.History() {
+        if historyCategory(h) != "tool" { continue }
+        var call struct{ Path string `json:"path"` }
+        if json.Unmarshal([]byte(h.Text), &call) == nil { add(call.Path) }
+    }
+    return r.files
+}
+
+// Messages counts history entries.
+func (r *Row) Messages() int { return len(r.History()) }
+
+// queryFields maps accepted field names (and aliases) to their canonical name.
+var queryFields = map[string]string{
+    "id": "id", "title": "title",
+    "created": "created", "date": "created",
+    "age": "age",
+    "cost": "cost", "totalcost": "cost",
+    "tokensin": "tokensin", "in": "tokensin",
+    "tokensout": "tokensout", "out": "tokensout",
+    "size": "size",
+    "images_size": "images_size", "images": "images_size", // bytes, as in `du`
+    "checkpoints_size": "checkpoints_size", "checkpoints": "checkpoints_size", "ckpt": "checkpoints_size",
+    "messages": "messages", "msgs": "messages",
+    "mode": "mode",
+    "workspace": "workspace", "ws": "workspace",
+    "source": "source", "src": "source",
+    "text": "text",
+    "hasfile": "hasfile", "has-file": "hasfile", "file": "hasfile",
+}
+
+// QueryFieldNames lists the canonical field names for help output.
+func QueryFieldNames() []string {
+    seen := map[string]bool{}
+    out := []string{}
+    for _, c := range queryFields { if !seen[c] { seen[c] = true; out = append(out, c) } }
+    sort.Strings(out)
+    return out
+}
+
+func canonicalField(name string) (string, error) {
+    c, ok := queryFields[strings.ToLower(name)]
+    if !ok { return "", fmt.Errorf("unknown field %q (known: %s)", name, strings.Join(QueryFieldNames(), ", ")) }
+    return c, nil
+}
+
+func fieldKind(field string) string {
+    switch field {
+    case "cost", "tokensin", "tokensout", "size", "images_size", "checkpoints_size", "messages":
+        return "number"
+    case "created":
+        return "date"
+    case "age":
+        return "duration"
+    }
+    return "string"
+}
+
+// Value returns the comparable value of a canonical field: float64, time.Time,
+// time.Duration or string.
+func (r *Row) Value(field string) any {
+    switch field {
+    case "id":
+        return r.ID
+    case "title":
+        return r.Title
+    case "created":
+        return r.CreatedAt
+    case "age":
+        return time.Since(r.CreatedAt)
+    case "cost":
+        return r.Stats().TotalCost
+    case "tokensin":
+        return float64(r.Stats().TokensIn)
+    case "tokensout":
+        return float64(r.Stats().TokensOut)
+    case "size":
+        return float64(r.Stats().SizeBytes)
+    case "images_size":
+        return float64(r.Usage().Images)
+    case "checkpoints_size":
+        return float64(r.Usage().Checkpoints)
+    case "messages":
+        return float64(r.Messages())
+    case "mode":
+        return r.Mode
+    case "workspace":
+        return r.Workspace
+    case "source":
+        return r.Source
+    }
+    return ""
+}
+
+// Query is a parsed --where expression. The zero value and nil match everything.
+//
+// Grammar: clauses "field op value" combined with and/or/not and parentheses;
+// adjacent clauses are joined with "and". Operators: = != > >= < <= ~ (contains).
+// Dates accept YYYY-MM-DD, YYYYMMDD or from..to ranges; durations (age) accept
+// 90m, 36h, 7d, 2w; numbers accept K/M/G suffixes (1024-based).
+//
+//	cost>5 and mode=code
+//	created=2025-12-01..2025-12-07 (workspace~api or text~"login bug")
+//	not has-file~_test.go age<7d
+type Query struct{ root queryNode }
+
+// ParseQuery parses a --where expression.
+func ParseQuery(s string) (*Query, error) {
+    toks, err := lexQuery(s)
+    if err != nil { return nil, err }
+    if len(toks) == 0 { return &Query{}, nil }
+    p := &queryParser{toks: toks}
+    n, err := p.parseOr()
+    if err != nil { return nil, err }
+    if p.pos < len(p.toks) { return nil, fmt.Errorf("unexpected %q", p.toks[p.pos].text) }
+    return &Query{root: n}, nil
+}
+
+// Match reports whether the row satisfies the query.
+func (q *Query) Match(r *Row) bool {
+    if q == nil || q.root == nil { return true }
+    return q.root.match(r)
+}
+
+type queryNode interface{ match(r *Row) bool }
+
+type andNode struct{ l, r queryNode }
+type orNode struct{ l, r queryNode }
+type notNode struct{ n queryNode }
+
+func (n andNode) match(r *Row) bool { return n.l.match(r) && n.r.match(r) }
+func (n orNode) match(r *Row) bool  { return n.l.match(r) || n.r.match(r) }
+func (n notNode) match(r *Row) bool { return !n.n.match(r) }
+
+type clauseNode struct {
+    field string
+    op    string
+    str   string        // lower-cased string operand
+    num   float64       // number operand
+    dur   time.Duration // duration operand
+    from  time.Time     // date operand: inclusive day (or range) bounds
+    to    time.Time
+}
+
+func (c clauseNode) match(r *Row) bool {
+    switch c.field {
+    case "text":
+        ok := strings.Contains(strings.ToLower(r.Title), c.str) || strings.Contains(strings.ToLower(r.ID), c.str)
+        if !ok {
+            for _, h := range r.History() {
+                if h.Role == "user" && strings.Contains(strings.ToLower(h.Text), c.str) { ok = true; break }
+            }
+        }
+        if c.op == "!=" { return !ok }
+        return ok
+    case "hasfile":
+        ok := false
+        for _, f := range r.Files() { if strings.Contains(strings.ToLower(filepath.ToSlash(f)), c.str) { ok = true; break } }
+        if c.op == "!=" { return !ok }
+        return ok
+    }
+    switch v := r.Value(c.field).(type) {
+    case string:
+        s := strings.ToLower(v)
+        switch c.op {
+        case "=":
+            return s == c.str
+        case "!=":
+            return s != c.str
+        case "~":
+            return strings.Contains(s, c.str)
+        case ">":
+            return s > c.str
+        case ">=":
+            return s >= c.str
+        case "<":
+            return s < c.str
+        case "<=":
+            return s <= c.str
+        }
+    case float64:
+        return compareNum(v, c.op, c.num)
+    case time.Duration:
+        return compareNum(float64(v), c.op, float64(c.dur))
+    case time.Time:
+        switch c.op {
+        case "=", "~":
+            return !v.Before(c.from) && !v.After(c.to)
+        case "!=":
+            return v.Before(c.from) || v.After(c.to)
+        case ">":
+            return v.After(c.to)
+        case ">=":
+            return !v.Before(c.from)
+        case "<":
+            return v.Before(c.from)
+        case "<=":
+            return !v.After(c.to)
+        }
+    }
+    return false
+}
+
+func compareNum(a float64, op string, b float64) bool {
+    switch op {
+    case "=", "~":
+        return a == b
+    case "!=":
+        return a != b
+    case ">":
+        return a > b
+    case ">=":
+        return a >= b
+    case "<":
+        return a < b
+    case "<=":
+        return a <= b
+    }
+    return false
+}
+
+func newClause(field, op, val string) (clauseNode, error) {
+    f, err := canonicalField(field)
+    if err != nil { return clauseNode{}, err }
+    c := clauseNode{field: f, op: op}
+    switch f {
+    case "text", "hasfile":
+        if op != "=" && op != "~" && op != "!=" { return c, fmt.Errorf("%s supports only =, ~ and !=", f) }
+        c.str = strings.ToLower(filepath.ToSlash(val))
+        return c, nil
+    }
+    switch fieldKind(f) {
+    case "number":
+        c.num, err = parseQuantity(val)
+    case "duration":
+        c.dur, err = ParseAge(val)
+    case "date":
+        if strings.Contains(val, "..") {
+            var from, to *time.Time
+            from, to, err = ParseDateRange(val)
+            if err == nil { c.from, c.to = *from, *to }
+        } else {
+            var d time.Time
+            d, err = ParseDay(val)
+            c.from = d
+            c.to = d.Add(24*time.Hour - time.Millisecond)
+        }
+    default:
+        c.str = strings.ToLower(val)
+    }
+    if err != nil { return c, fmt.Errorf("%s: %w", f, err) }
+    return c, nil
+}
+
+// parseQuantity parses numbers with an optional K/M/G (or KB/MB/GB) suffix.
+func parseQuantity(s string) (float64, error) {
+    u := strings.ToUpper(strings.TrimSpace(s))
+    u = strings.TrimSuffix(strings.TrimPrefix(u, "$"), "B")
+    mult := 1.0
+    if n := len(u); n > 0 {
+        switch u[n-1] {
+        case 'K':
+            mult, u = 1<<10, u[:n-1]
+        case 'M':
+            mult, u = 1<<20, u[:n-1]
+        case 'G':
+            mult, u = 1<<30, u[:n-1]
+        }
+    }
+    f, err := strconv.ParseFloat(u, 64)
+    if err != nil { return 0, fmt.Errorf("invalid number %q", s) }
+    return f * mult, nil
+}
+
+// ParseAge parses Go durations plus day (d) and week (w) units.
+func ParseAge(s string) (time.Duration, error) {
+    s = strings.TrimSpace(s)
+    if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+        v, err := strconv.ParseFloat(s[:n-1], 64)
+        if err != nil { return 0, fmt.Errorf("invalid duration %q", s) }
+        unit := 24 * time.Hour
+        if s[n-1] == 'w' { unit *= 7 }
+        return time.Duration(v * float64(unit)), nil
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil { return 0, fmt.Errorf("invalid duration %q", s) }
+    return d, nil
+}
+
+// ParseDay parses YYYY-MM-DD or YYYYMMDD in local time.
+func ParseDay(in string) (time.Time, error) {
+    if len(in) == 10 && in[4] == '-' && in[7] == '-' {
+        if t, err := time.ParseInLocation("2006-01-02", in, time.Local); err == nil { return t, nil }
+    }
+    if len(in) == 8 {
+        if t, err := time.ParseInLocation("20060102", in, time.Local); err == nil { return t, nil }
+    }
+    return time.Time{}, fmt.Errorf("invalid date: %q", in)
+}
+
+// ParseDateRange parses "from..to" with dates in YYYY-MM-DD or YYYYMMDD.
+// Returns inclusive time bounds in local time at 00:00:00 and 23:59:59.999.
+func ParseDateRange(s string) (*time.Time, *time.Time, error) {
+    dots := strings.Index(s, "..")
+    if dots <= 0 || dots+2 > len(s) { return nil, nil, fmt.Errorf("expected from..to") }
+    left := strings.TrimSpace(s[:dots])
+    right := strings.TrimSpace(s[dots+2:])
+    if left == "" || right == "" { return nil, nil, fmt.Errorf("both from and to are required") }
+    f, err := ParseDay(left); if err != nil { return nil, nil, err }
+    t, err := ParseDay(right); if err != nil { return nil, nil, err }
+    // Normalize to day start/end
+    f = time.Date(f.Year(), f.Month(), f.Day(), 0, 0, 0, 0, f.Location())
+    t = time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, int(time.Millisecond*999), t.Location())
+    return &f, &t, nil
+}
+
+// ---- lexer/parser ----
+
+type queryTok struct {
+    kind string // word, op, lparen, rparen, string
+    text string
+}
+
+func isOpChar(c byte) bool { return c == '=' || c == '!' || c == '<' || c == '>' || c == '~' }
+
+func lexQuery(s string) ([]queryTok, error) {
+    var out []queryTok
+    i := 0
+    for i < len(s) {
+        c := s[i]
+        switch {
+        case c == ' ' || c == '\t' || c == '\n':
+            i++
+        case c == '(':
+            out = append(out, queryTok{"lparen", "("}); i++
+        case c == ')':
+            out = append(out, queryTok{"rparen", ")"}); i++
+        case c == '"' || c == '\'':
+            j := strings.IndexByte(s[i+1:], c)
+            if j < 0 { return nil, fmt.Errorf("unterminated quote at %d", i) }
+            out = append(out, queryTok{"string", s[i+1 : i+1+j]})
+            i += j + 2
+        case isOpChar(c):
+            j := i
+            for j < len(s) && isOpChar(s[j]) { j++ }
+            op := s[i:j]
+            switch op {
+            case "=", "==", "!=", ">", ">=", "<", "<=", "~", "=~":
+            default:
+                return nil, fmt.Errorf("unknown operator %q", op)
+            }
+            if op == "==" { op = "=" }
+            if op == "=~" { op = "~" }
+            out = append(out, queryTok{"op", op})
+            i = j
+        default:
+            j := i
+            for j < len(s) && !isOpChar(s[j]) && s[j] != ' ' && s[j] != '\t' && s[j] != '\n' && s[j] != '(' && s[j] != ')' { j++ }
+            out = append(out, queryTok{"word", s[i:j]})
+            i = j
+        }
+    }
+    return out, nil
+}
+
+type queryParser struct {
+    toks []queryTok
+    pos  int
+}
+
+func (p *queryParser) peek() *queryTok {
+    if p.pos < len(p.toks) { return &p.toks[p.pos] }
+    return nil
+}
+
+func (p *queryParser) keyword(kw string) bool {
+    t := p.peek()
+    if t != nil && t.kind == "word" && strings.EqualFold(t.text, kw) {
+        // a keyword followed by an operator is a field name, not a keyword
+        if p.pos+1 < len(p.toks) && p.toks[p.pos+1].kind == "op" { return false }
+        p.pos++
+        return true
+    }
+    return false
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+    l, err := p.parseAnd()
+    if err != nil { return nil, err }
+    for p.keyword("or") {
+        r, err := p.parseAnd()
+        if err != nil { return nil, err }
+        l = orNode{l, r}
+    }
+    return l, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+    l, err := p.parseUnary()
+    if err != nil { return nil, err }
+    for {
+        if p.keyword("and") {
+            r, err := p.parseUnary()
+            if err != nil { return nil, err }
+            l = andNode{l, r}
+            continue
+        }
+        t := p.peek()
+        if t == nil || t.kind == "rparen" { return l, nil }
+        if t.kind == "word" && strings.EqualFold(t.text, "or") && !(p.pos+1 < len(p.toks) && p.toks[p.pos+1].kind == "op") { return l, nil }
+        r, err := p.parseUnary()
+        if err != nil { return nil, err }
+        l = andNode{l, r}
+    }
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+    if p.keyword("not") {
+        n, err := p.parseUnary()
+        if err != nil { return nil, err }
+        return notNode{n}, nil
+    }
+    t := p.peek()
+    if t == nil { return nil, fmt.Errorf("unexpected end of query") }
+    if t.kind == "lparen" {
+        p.pos++
+        n, err := p.parseOr()
+        if err != nil { return nil, err }
+        if t := p.peek(); t == nil || t.kind != "rparen" { return nil, fmt.Errorf("missing )") }
+        p.pos++
+        return n, nil
+    }
+    if t.kind != "word" { return nil, fmt.Errorf("expected field name, got %q", t.text) }
+    field := t.text
+    p.pos++
+    op := p.peek()
+    if op == nil || op.kind != "op" { return nil, fmt.Errorf("expected operator after %q", field) }
+    p.pos++
+    val := p.peek()
+    if val == nil || (val.kind != "word" && val.kind != "string") { return nil, fmt.Errorf("expected value after %s%s", field, op.text) }
+    p.pos++
+    return newClause(field, op.text, val.text)
+}
+
+// SortRows sorts rows by a comma-separated list of fields; a leading '-' sorts
+// that field descending. An empty spec leaves the order unchanged.
+func SortRows(rows []*Row, spec string) error {
+    type key struct {
+        field string
+        desc  bool
+    }
+    var keys []key
+    for _, part := range strings.Split(spec, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" { continue }
+        k := key{}
+        if strings.HasPrefix(part, "-") { k.desc = true; part = part[1:] } else { part = strings.TrimPrefix(part, "+") }
+        f, err := canonicalField(part)
+        if err != nil { return err }
+        if f == "text" || f == "hasfile" { return fmt.Errorf("cannot sort by %s", f) }
+        k.field = f
+        keys = append(keys, k)
+    }
+    if len(keys) == 0 { return nil }
+    sort.SliceStable(rows, func(i, j int) bool {
+        for _, k := range keys {
+            c := compareValues(rows[i].Value(k.field), rows[j].Value(k.field))
+            if c == 0 { continue }
+            if k.desc { return c > 0 }
+            return c < 0
+        }
+        return false
+    })
+    return nil
+}
+
+func compareValues(a, b any) int {
+    switch av := a.(type) {
+    case string:
+        return strings.Compare(strings.ToLower(av), strings.ToLower(b.(string)))
+    case float64:
+        bv := b.(float64)
+        if av < bv { return -1 } else if av > bv { return 1 }
+    case time.Duration:
+        bv := b.(time.Duration)
+        if av < bv { return -1 } else if av > bv { return 1 }
+    case time.Time:
+        return av.Compare(b.(time.Time))
+    }
+    return 0
+}
@@ -0,0 +1,90 @@
+package tasks
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// AmbiguousError is returned by ResolveRef when a reference matches more than one task.
+type AmbiguousError struct {
+    Ref        string
+    Candidates []Task
+}
+
+func (e *AmbiguousError) Error() string {
+    const maxShown = 10
+    var b strings.Builder
+    fmt.Fprintf(&b, "%q matches %d tasks:", e.Ref, len(e.Candidates))
+    for i, t := range e.Candidates {
+        if i == maxShown {
+            fmt.Fprintf(&b, "\n  … and %d more", len(e.Candidates)-maxShown)
+            break
+        }
+        title, _, _ := CleanOneLine(t.Title, 60)
+        fmt.Fprintf(&b, "\n  %s  %s  %s", t.ID, t.CreatedAt.Local().Format("2006-01-02 15:04"), title)
+        if t.Source != "" { fmt.Fprintf(&b, "  (%s)", t.Source) }
+    }
+    return b.String()
+}
+
+// ResolveRef finds the task a user-supplied reference points at. In order it tries:
+//   - @latest or @N: the Nth most recently created task (@1 == @latest)
+//   - an exact task ID
+//   - a unique ID prefix
+//   - a unique, case-insensitive title fragment
+// A reference matching several tasks at the prefix or title step yields an *AmbiguousError.
+func ResolveRef(list []Task, ref string) (Task, error) {
+    ref = strings.TrimSpace(ref)
+    if ref == "" { return Task{}, fmt.Errorf("empty task reference") }
+
+    if strings.HasPrefix(ref, "@") {
+        n := 1
+        if spec := strings.ToLower(ref[1:]); spec != "latest" {
+            v, err := strconv.Atoi(spec)
+            if err != nil || v < 1 { return Task{}, fmt.Errorf("invalid reference %q (use @latest or @N with N >= 1)", ref) }
+            n = v
+        }
+        if n > len(list) { return Task{}, fmt.Errorf("%s: only %d tasks", ref, len(list)) }
+        byAge := append([]Task(nil), list...)
+        sort.SliceStable(byAge, func(i, j int) bool { return byAge[i].CreatedAt.After(byAge[j].CreatedAt) })
+        return byAge[n-1], nil
+    }
+
+    lref := strings.ToLower(ref)
+    var prefix []Task
+    for _, t := range list {
+        if strings.EqualFold(t.ID, ref) { return t, nil }
+        if strings.HasPrefix(strings.ToLower(t.ID), lref) { prefix = append(prefix, t) }
+    }
+    if len(prefix) == 1 { return prefix[0], nil }
+    if len(prefix) > 1 { return Task{}, &AmbiguousError{Ref: ref, Candidates: prefix} }
+
+    var titled []Task
+    for _, t := range list {
+        if strings.Contains(strings.ToLower(t.Title), lref) { titled = append(titled, t) }
+    }
+    switch len(titled) {
+    case 0:
+        return Task{}, fmt.Errorf("no task matches %q", ref)
+    case 1:
+        return titled[0], nil
+    }
+    return Task{}, &AmbiguousError{Ref: ref, Candidates: titled}
+}
+
+// ResolveRefs resolves each reference with ResolveRef and returns the full task IDs
+// in input order, dropping duplicates.
+func ResolveRefs(list []Task, refs []string) ([]string, error) {
+    out := make([]string, 0, len(refs))
+    seen := map[string]bool{}
+    for _, r := range refs {
+        t, err := ResolveRef(list, r)
+        if err != nil { return nil, err }
+        if seen[t.ID] { continue }
+        seen[t.ID] = true
+        out = append(out, t.ID)
+    }
+    return out, nil
+}
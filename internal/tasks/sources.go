@@ -0,0 +1,206 @@
+package tasks
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "roocode-task-man/internal/config"
+)
+
+// KnownPluginIDs are the Roo-compatible extensions (Roo Code and its forks) whose
+// globalStorage layout this tool understands.
+var KnownPluginIDs = []string{
+    "RooVeterinaryInc.roo-cline", // Roo Code
+    "kilocode.kilo-code",         // Kilo Code
+    "saoudrizwan.claude-dev",     // Cline
+}
+
+// Source is one editor + extension pair that stores tasks.
+type Source struct {
+    Editor   string `json:"editor"` // app data folder name, e.g. "Code", "Cursor", or a server such as "vscode-server"
+    PluginID string `json:"pluginId"`
+    Root     string `json:"root"` // <User dir>/globalStorage/<PluginID>
+    // UserDataDir is set for sources found under a configured --user-data-dir.
+    UserDataDir string `json:"userDataDir,omitempty"`
+}
+
+// Label identifies the source as Editor:pluginID.
+func (s Source) Label() string { return s.Editor + ":" + s.PluginID }
+
+// Config returns base narrowed to this single source.
+func (s Source) Config(base config.Config) config.Config {
+    c := base
+    c.CodeChannel = s.Editor
+    c.PluginID = s.PluginID
+    c.DataDir = ""
+    c.UserDataDir = s.UserDataDir
+    c.AllSources = false
+    c.Source = ""
+    return c
+}
+
+// ConfiguredLabel is the label of the single source cfg points at (Label format).
+func ConfiguredLabel(cfg config.Config) string {
+    editor := DisplayEditorName(cfg.CodeChannel)
+    if cfg.UserDataDir != "" { editor += " (" + cfg.UserDataDir + ")" }
+    return editor + ":" + cfg.PluginID
+}
+
+// MultiSource reports whether cfg asks for the aggregated all-sources view.
+func MultiSource(cfg config.Config) bool { return cfg.AllSources || cfg.Source != "" }
+
+// editorLocation is one place an editor or remote server keeps its User directory.
+type editorLocation struct {
+    Editor      string // channel/display name
+    Dir         string // <appdata>/<Editor> or <home>/.<server>
+    UserDir     string
+    UserDataDir string // set for the configured --user-data-dir
+}
+
+// editorLocations lists the configured user data dir, the installed desktop editors
+// under the OS app-data directory and the remote servers under the server home.
+func editorLocations(cfg config.Config) []editorLocation {
+    var out []editorLocation
+    if cfg.UserDataDir != "" {
+        name := strings.TrimSuffix(ConfiguredLabel(cfg), ":"+cfg.PluginID)
+        out = append(out, editorLocation{Editor: name, Dir: cfg.UserDataDir, UserDir: userDirFromDataDir(cfg.UserDataDir), UserDataDir: cfg.UserDataDir})
+    }
+    if base, err := appDataBase(); err == nil {
+        for _, ch := range knownEditorChannels {
+            editor, _ := mapEditorChannel(ch)
+            dir := filepath.Join(base, editor)
+            if isDir(dir) { out = append(out, editorLocation{Editor: editor, Dir: dir, UserDir: filepath.Join(dir, "User")}) }
+        }
+    }
+    home := serverHome(cfg)
+    for _, d := range serverDirs {
+        dir := filepath.Join(home, d)
+        if isDir(dir) { out = append(out, editorLocation{Editor: strings.TrimPrefix(d, "."), Dir: dir, UserDir: filepath.Join(dir, "data", "User")}) }
+    }
+    return out
+}
+
+// isRooPlugin reports whether a globalStorage folder looks like a Roo-compatible extension:
+// a known plugin ID or any folder holding a tasks/ directory.
+func isRooPlugin(gs, name string) bool {
+    for _, id := range KnownPluginIDs {
+        if strings.EqualFold(id, name) { return true }
+    }
+    return isDir(filepath.Join(gs, name, "tasks"))
+}
+
+// DetectSources scans every known editor's (and remote server's) globalStorage for known
+// plugin IDs and any other extension folder that holds a tasks/ directory. Sources are
+// sorted by label.
+func DetectSources(cfg config.Config) ([]Source, error) {
+    var out []Source
+    for _, loc := range editorLocations(cfg) {
+        gs := filepath.Join(loc.UserDir, "globalStorage")
+        entries, err := os.ReadDir(gs)
+        if err != nil { continue }
+        for _, e := range entries {
+            if !e.IsDir() || !isRooPlugin(gs, e.Name()) { continue }
+            out = append(out, Source{Editor: loc.Editor, PluginID: e.Name(), Root: filepath.Join(gs, e.Name()), UserDataDir: loc.UserDataDir})
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Label() < out[j].Label() })
+    return out, nil
+}
+
+// selectedSources returns the sources LoadTasks should read: every detected source whose
+// label contains cfg.Source (case-insensitive) in multi-source mode, otherwise the single
+// configured editor/plugin.
+func selectedSources(cfg config.Config) ([]Source, error) {
+    if !MultiSource(cfg) {
+        root, err := ResolveStorageRoot(cfg)
+        if err != nil { return nil, err }
+        return []Source{{Editor: DisplayEditorName(cfg.CodeChannel), PluginID: cfg.PluginID, Root: root, UserDataDir: cfg.UserDataDir}}, nil
+    }
+    all, err := DetectSources(cfg)
+    if err != nil { return nil, err }
+    want := strings.ToLower(cfg.Source)
+    out := make([]Source, 0, len(all))
+    for _, s := range all {
+        if want == "" || strings.Contains(strings.ToLower(s.Label()), want) { out = append(out, s) }
+    }
+    return out, nil
+}
+
+// WatchDirs returns the existing directories task folders are created in for every
+// source LoadTasks reads: each storage root and its tasks/ subfolder.
+func WatchDirs(cfg config.Config) ([]string, error) {
+    srcs, err := selectedSources(cfg)
+    if err != nil { return nil, err }
+    var out []string
+    for _, s := range srcs {
+        for _, d := range []string{s.Root, filepath.Join(s.Root, "tasks")} {
+            if isDir(d) { out = append(out, d) }
+        }
+    }
+    return out, nil
+}
+
+func isDir(p string) bool {
+    fi, err := os.Stat(p)
+    return err == nil && fi.IsDir()
+}
+
+// EditorInfo describes one installed editor found under the OS app-data directory.
+type EditorInfo struct {
+    Editor      string       `json:"editor"`
+    Dir         string       `json:"dir"`     // <appdata>/<Editor> or <home>/.<server>
+    StateDB     string       `json:"stateDb"` // empty when the editor has no state.vscdb yet
+    StateDBSize int64        `json:"stateDbSize"`
+    Sources     []SourceInfo `json:"sources"`
+}
+
+// SourceInfo is a Source plus what the scan found for it.
+type SourceInfo struct {
+    Source
+    TaskDirs       int  `json:"taskDirs"`       // task directories on disk
+    HistoryEntries int  `json:"historyEntries"` // taskHistory entries in state.vscdb
+    HasStorage     bool `json:"hasStorage"`     // Root exists on disk
+}
+
+// ScanEditors reports every installed editor mapEditorChannel knows, plus remote servers
+// under the server home, and for each the extensions that hold a tasks/ folder or a
+// taskHistory key in state.vscdb.
+func ScanEditors(cfg config.Config) ([]EditorInfo, error) {
+    var out []EditorInfo
+    for _, loc := range editorLocations(cfg) {
+        editor := loc.Editor
+        info := EditorInfo{Editor: editor, Dir: loc.Dir}
+        gs := filepath.Join(loc.UserDir, "globalStorage")
+        history := map[string]int{}
+        if p := filepath.Join(gs, "state.vscdb"); fileSize(p) >= 0 {
+            info.StateDB, info.StateDBSize = p, fileSize(p)
+            if h, err := taskHistoryCounts(p); err == nil { history = h }
+        }
+        plugins := map[string]bool{}
+        if entries, err := os.ReadDir(gs); err == nil {
+            for _, e := range entries {
+                if !e.IsDir() { continue }
+                if isRooPlugin(gs, e.Name()) { plugins[e.Name()] = true }
+            }
+        }
+        for id := range history { plugins[id] = true }
+        for id := range plugins {
+            root := filepath.Join(gs, id)
+            si := SourceInfo{Source: Source{Editor: editor, PluginID: id, Root: root, UserDataDir: loc.UserDataDir}, HistoryEntries: history[id], HasStorage: isDir(root)}
+            if si.HasStorage { si.TaskDirs = len(DiscoverTaskDirs(root)) }
+            info.Sources = append(info.Sources, si)
+        }
+        sort.Slice(info.Sources, func(i, j int) bool { return info.Sources[i].PluginID < info.Sources[j].PluginID })
+        out = append(out, info)
+    }
+    return out, nil
+}
+
+// fileSize returns the size of the regular file at p, or -1 if there is none.
+func fileSize(p string) int64 {
+    fi, err := os.Stat(p)
+    if err != nil || !fi.Mode().IsRegular() { return -1 }
+    return fi.Size()
+}
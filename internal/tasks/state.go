@@ -0,0 +1,384 @@
+package tasks
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "roocode-task-man/internal/config"
+)
+
+// StateKey is one piece of an extension's state in state.vscdb: a field of the JSON
+// object stored under the plugin ID (customModes, listApiConfigMeta, taskHistory, …) or
+// another ItemTable row whose key names the plugin, such as its secrets.
+type StateKey struct {
+    Name   string // the field, or the ItemTable key of other rows
+    Row    string // ItemTable key holding the value
+    Field  string // field of Row's JSON object; empty for a whole row
+    Kind   string // object, array, string, number, bool, null, text, or secret
+    Size   int    // stored size in bytes
+    Secret bool   // kept in the editor's encrypted secret storage; never shown or exported
+    Value  json.RawMessage // nil for secrets
+}
+
+// MaskedValue replaces secret-looking strings in shown and exported values.
+const MaskedValue = "********"
+
+// secretRowPrefix starts the ItemTable keys of VS Code's secret storage.
+const secretRowPrefix = "secret://"
+
+var (
+    secretName  = regexp.MustCompile(`(?i)(api_?key|secret|token|password|passwd|credential|private_?key|authorization|cookie)`)
+    secretValue = regexp.MustCompile(`^(sk-|sk_|AIza|ghp_|gho_|github_pat_|xox[abp]-|glpat-)`)
+)
+
+// ListStateKeys lists the state cfg's extension keeps in the state DB, sorted by name.
+func ListStateKeys(cfg config.Config) ([]StateKey, error) {
+    dbPath, err := detectStateDBPath(cfg)
+    if err != nil { return nil, err }
+    rows, err := readItemTable(dbPath)
+    if err != nil { return nil, err }
+    return stateKeys(rows, cfg.PluginID), nil
+}
+
+func stateKeys(rows map[string][]byte, pluginID string) []StateKey {
+    var out []StateKey
+    if raw, ok := rows[pluginID]; ok {
+        var doc map[string]json.RawMessage
+        if json.Unmarshal(raw, &doc) == nil {
+            for f, v := range doc {
+                out = append(out, StateKey{Name: f, Row: pluginID, Field: f, Kind: jsonKind(v), Size: len(v), Value: v})
+            }
+        } else {
+            out = append(out, StateKey{Name: pluginID, Row: pluginID, Kind: "text", Size: len(raw), Value: textValue(raw)})
+        }
+    }
+    for k, v := range rows {
+        if !isStateRow(k, pluginID) { continue }
+        sk := StateKey{Name: k, Row: k, Size: len(v)}
+        if strings.HasPrefix(k, secretRowPrefix) {
+            sk.Kind, sk.Secret = "secret", true
+        } else if json.Valid(v) {
+            sk.Kind, sk.Value = jsonKind(v), json.RawMessage(v)
+        } else {
+            sk.Kind, sk.Value = "text", textValue(v)
+        }
+        out = append(out, sk)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+    return out
+}
+
+// isStateRow reports whether name is an ItemTable key of the extension other than its
+// main row: one that contains the plugin ID, such as its secret storage keys. Field
+// names of the main row never do, since plugin IDs are publisher.name.
+func isStateRow(name, pluginID string) bool {
+    return name != pluginID && strings.Contains(strings.ToLower(name), strings.ToLower(pluginID))
+}
+
+// textValue encodes a non-JSON row value as a JSON string.
+func textValue(b []byte) json.RawMessage {
+    s, _ := json.Marshal(string(b))
+    return s
+}
+
+func jsonKind(v json.RawMessage) string {
+    t := bytes.TrimSpace(v)
+    if len(t) == 0 { return "null" }
+    switch t[0] {
+    case '{':
+        return "object"
+    case '[':
+        return "array"
+    case '"':
+        return "string"
+    case 't', 'f':
+        return "bool"
+    case 'n':
+        return "null"
+    }
+    return "number"
+}
+
+// FindStateKey looks name up in keys.
+func FindStateKey(keys []StateKey, name string) (StateKey, error) {
+    for _, k := range keys {
+        if k.Name == name { return k, nil }
+    }
+    return StateKey{}, fmt.Errorf("no state key %q (see `roo-task-man state list`)", name)
+}
+
+// MaskSecrets returns v with every string that looks like a credential replaced by
+// MaskedValue: values of fields named like apiKey, token or password, and strings
+// shaped like well-known API keys. It also reports how many were replaced.
+func MaskSecrets(v json.RawMessage) (json.RawMessage, int) {
+    var x any
+    dec := json.NewDecoder(bytes.NewReader(v))
+    dec.UseNumber()
+    if dec.Decode(&x) != nil { return v, 0 }
+    n := 0
+    x = maskValue(x, "", &n)
+    if n == 0 { return v, 0 }
+    b, err := json.Marshal(x)
+    if err != nil { return v, 0 }
+    return b, n
+}
+
+func maskValue(v any, name string, n *int) any {
+    switch x := v.(type) {
+    case map[string]any:
+        for k, e := range x { x[k] = maskValue(e, k, n) }
+    case []any:
+        for i, e := range x { x[i] = maskValue(e, name, n) }
+    case string:
+        if x != "" && x != MaskedValue && (secretName.MatchString(name) || secretValue.MatchString(x)) {
+            *n++
+            return MaskedValue
+        }
+    }
+    return v
+}
+
+// PrettyJSON indents v for display.
+func PrettyJSON(v json.RawMessage) string {
+    var buf bytes.Buffer
+    if json.Indent(&buf, v, "", "  ") != nil { return string(v) }
+    return buf.String()
+}
+
+// StateExport is the file written by `state export`.
+type StateExport struct {
+    Version    int                        `json:"version"`
+    Editor     string                     `json:"editor"`
+    PluginID   string                     `json:"pluginId"`
+    ExportedAt time.Time                  `json:"exportedAt"`
+    Masked     int                        `json:"masked,omitempty"` // values replaced by MaskedValue
+    Keys       map[string]json.RawMessage `json:"keys"`
+}
+
+// ExportStateKeys collects the named keys (by default every key but taskHistory) with
+// secrets masked unless reveal is set. Secret storage rows are never exported.
+func ExportStateKeys(cfg config.Config, names []string, reveal bool) (StateExport, error) {
+    exp := StateExport{Version: 1, Editor: DisplayEditorName(cfg.CodeChannel), PluginID: cfg.PluginID, ExportedAt: time.Now(), Keys: map[string]json.RawMessage{}}
+    keys, err := ListStateKeys(cfg)
+    if err != nil { return exp, err }
+    var picked []StateKey
+    if len(names) == 0 {
+        for _, k := range keys {
+            if k.Name != "taskHistory" && !k.Secret { picked = append(picked, k) }
+        }
+    } else {
+        for _, name := range names {
+            k, err := FindStateKey(keys, name)
+            if err != nil { return exp, err }
+            if k.Secret { return exp, fmt.Errorf("%s is kept in the editor's encrypted secret storage and cannot be exported", name) }
+            picked = append(picked, k)
+        }
+    }
+    for _, k := range picked {
+        v := k.Value
+        if !reveal {
+            var n int
+            v, n = MaskSecrets(v)
+            exp.Masked += n
+        }
+        exp.Keys[k.Name] = v
+    }
+    return exp, nil
+}
+
+// ReadStateExport reads a file written by `state export`.
+func ReadStateExport(path string) (StateExport, error) {
+    var exp StateExport
+    b, err := os.ReadFile(path)
+    if err != nil { return exp, err }
+    if err := json.Unmarshal(b, &exp); err != nil { return exp, fmt.Errorf("%s: %w", path, err) }
+    if exp.Version != 1 || exp.Keys == nil { return exp, fmt.Errorf("%s is not a roo-task-man state export", path) }
+    return exp, nil
+}
+
+// WriteStateExport writes exp to path, readable by the owner only since revealed
+// exports hold credentials.
+func WriteStateExport(path string, exp StateExport) error {
+    b, err := json.MarshalIndent(exp, "", "  ")
+    if err != nil { return err }
+    return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// StateChange is what importing one key does: "added", "changed" or "same".
+type StateChange struct {
+    Name string
+    Kind string
+}
+
+// ImportStateKeys writes the named keys of exp (all of them when names is empty) into
+// the state DB and its .backup, both backed up first. Masked values keep the current
+// value at the same place. With dryRun it only reports what would change.
+func ImportStateKeys(cfg config.Config, exp StateExport, names []string, dryRun bool) ([]StateChange, error) {
+    if len(names) == 0 {
+        for k := range exp.Keys { names = append(names, k) }
+        sort.Strings(names)
+    }
+    dbPath, err := detectStateDBPath(cfg)
+    if err != nil { return nil, err }
+    rows, err := readItemTable(dbPath)
+    if err != nil { return nil, err }
+    current := map[string]StateKey{}
+    for _, k := range stateKeys(rows, cfg.PluginID) { current[k.Name] = k }
+
+    var changes []StateChange
+    values := map[string]json.RawMessage{}
+    for _, name := range names {
+        v, ok := exp.Keys[name]
+        if !ok { return nil, fmt.Errorf("%s is not in the export", name) }
+        if strings.HasPrefix(name, secretRowPrefix) { return nil, fmt.Errorf("%s belongs to the editor's secret storage", name) }
+        cur, exists := current[name]
+        v, err := unmaskValue(v, cur.Value)
+        if err != nil { return nil, fmt.Errorf("%s: %w", name, err) }
+        c := StateChange{Name: name, Kind: "added"}
+        if exists {
+            c.Kind = "changed"
+            if jsonEqual(v, cur.Value) { c.Kind = "same" }
+        }
+        changes = append(changes, c)
+        if c.Kind != "same" { values[name] = v }
+    }
+    if dryRun || len(values) == 0 { return changes, nil }
+    if err := CheckEditorClosed(cfg); err != nil { return nil, err }
+    changed := make([]string, 0, len(values))
+    for k := range values { changed = append(changed, k) }
+    sort.Strings(changed)
+    dbs := existingStateDBs(dbPath)
+    if err := backupStateDBs(dbs, "state import: "+strings.Join(changed, ", "), nil); err != nil { return nil, err }
+    for _, p := range dbs {
+        if err := writeStateKeys(p, cfg.PluginID, values); err != nil { return nil, fmt.Errorf("write %s: %w", p, err) }
+    }
+    return changes, nil
+}
+
+// unmaskValue puts the current values back where v holds MaskedValue.
+func unmaskValue(v, current json.RawMessage) (json.RawMessage, error) {
+    if !bytes.Contains(v, []byte(MaskedValue)) { return v, nil }
+    var nv, cv any
+    dec := json.NewDecoder(bytes.NewReader(v))
+    dec.UseNumber()
+    if err := dec.Decode(&nv); err != nil { return nil, err }
+    if current != nil {
+        dec = json.NewDecoder(bytes.NewReader(current))
+        dec.UseNumber()
+        _ = dec.Decode(&cv)
+    }
+    out, err := unmask(nv, cv, "")
+    if err != nil { return nil, err }
+    return json.Marshal(out)
+}
+
+func unmask(v, cur any, path string) (any, error) {
+    switch x := v.(type) {
+    case map[string]any:
+        cm, _ := cur.(map[string]any)
+        for k, e := range x {
+            ne, err := unmask(e, cm[k], path+"."+k)
+            if err != nil { return nil, err }
+            x[k] = ne
+        }
+    case []any:
+        ca, _ := cur.([]any)
+        for i, e := range x {
+            ne, err := unmask(e, sameElement(e, ca), fmt.Sprintf("%s[%d]", path, i))
+            if err != nil { return nil, err }
+            x[i] = ne
+        }
+    case string:
+        if x != MaskedValue { return v, nil }
+        if s, ok := cur.(string); ok { return s, nil }
+        return nil, fmt.Errorf("masked value at %s has no current value to keep; export it with --reveal", strings.TrimPrefix(path, "."))
+    }
+    return v, nil
+}
+
+// identityFields name the fields that identify an object in an array of profiles or
+// modes, most specific first.
+var identityFields = []string{"id", "name", "slug"}
+
+// sameElement finds the object in cur that is the same entity as e: the only one with
+// e's id, else its name, else its slug. Positions say nothing (profiles are ordered
+// differently on each machine), so elements without an identity match nothing.
+func sameElement(e any, cur []any) any {
+    em, ok := e.(map[string]any)
+    if !ok { return nil }
+    for _, f := range identityFields {
+        id, _ := em[f].(string)
+        if id == "" { continue }
+        var found any
+        n := 0
+        for _, c := range cur {
+            if cm, ok := c.(map[string]any); ok && cm[f] == id { found = c; n++ }
+        }
+        if n == 1 { return found }
+    }
+    return nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+    if a == nil || b == nil { return a == nil && b == nil }
+    var x, y bytes.Buffer
+    if json.Compact(&x, a) != nil || json.Compact(&y, b) != nil { return bytes.Equal(a, b) }
+    var xv, yv any
+    if json.Unmarshal(x.Bytes(), &xv) != nil || json.Unmarshal(y.Bytes(), &yv) != nil { return bytes.Equal(x.Bytes(), y.Bytes()) }
+    xb, _ := json.Marshal(xv)
+    yb, _ := json.Marshal(yv)
+    return bytes.Equal(xb, yb)
+}
+
+// writeStateKeys stores values: names for which isStateRow holds are whole ItemTable
+// rows, the others fields of the plugin's JSON object.
+func writeStateKeys(dbPath, pluginID string, values map[string]json.RawMessage) error {
+    db, err := sql.Open("sqlite", dbPath)
+    if err != nil { return err }
+    defer db.Close()
+    _, _ = db.Exec("PRAGMA busy_timeout=5000")
+    if _, err := db.Exec("BEGIN IMMEDIATE"); err != nil { return err }
+    defer db.Exec("ROLLBACK")
+    if _, err := db.Exec("CREATE TABLE IF NOT EXISTS ItemTable (key TEXT PRIMARY KEY, value BLOB)"); err != nil { return err }
+    upsert := func(k string, v []byte) error {
+        _, err := db.Exec("INSERT INTO ItemTable(key, value) VALUES(?, ?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", k, v)
+        return err
+    }
+    var raw []byte
+    err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&raw)
+    if errors.Is(err, sql.ErrNoRows) { raw = []byte(`{}`) } else if err != nil { return err }
+    doc := map[string]json.RawMessage{}
+    if err := json.Unmarshal(raw, &doc); err != nil { return fmt.Errorf("parse %s: %w", pluginID, err) }
+    fields := 0
+    for name, v := range values {
+        if isStateRow(name, pluginID) {
+            if err := upsert(name, rowValue(v)); err != nil { return err }
+            continue
+        }
+        doc[name] = v
+        fields++
+    }
+    if fields > 0 {
+        b, err := json.Marshal(doc)
+        if err != nil { return err }
+        if err := upsert(pluginID, b); err != nil { return err }
+    }
+    if _, err := db.Exec("COMMIT"); err != nil { return err }
+    _, _ = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+    return nil
+}
+
+// rowValue undoes textValue: a row that was not JSON is stored as the plain string.
+func rowValue(v json.RawMessage) []byte {
+    var s string
+    if json.Unmarshal(v, &s) == nil && !json.Valid([]byte(s)) { return []byte(s) }
+    return v
+}
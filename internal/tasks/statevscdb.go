@@ -8,7 +8,6 @@ import (
     "log"
     "os"
     "path/filepath"
-    "runtime"
     "sort"
     "strings"
     "time"
@@ -18,167 +17,64 @@ import (
     "roocode-task-man/internal/config"
 )
 
-// RegisterImportedTasks appends imported tasks into the extension's TaskHistory in state.vscdb for the given workspace path.
+// RegisterImportedTasks registers imported tasks in the extension's taskHistory in
+// state.vscdb (and its .backup) under their own Workspace, or the given workspace path
+// for tasks without one. Entries carry the tasks' real stats; re-importing a task
+// replaces its entry instead of adding another.
 func RegisterImportedTasks(cfg config.Config, workspace string, ts []Task) error {
-    if workspace == "" { return errors.New("workspace is required") }
-    // find state db
+    entries := make([]map[string]any, 0, len(ts))
+    for _, t := range ts {
+        ws := workspace
+        if t.Workspace != "" { ws = t.Workspace }
+        if ws == "" { return errors.New("workspace is required") }
+        e := HistoryEntryFromTask(t)
+        e["number"] = 1
+        e["workspace"] = ws
+        e["mode"] = "code"
+        entries = append(entries, e)
+        if cfg.Debug { log.Printf("[statevscdb] registering taskHistory: plugin=%s id=%s workspace=%s size=%v tokensIn=%v tokensOut=%v totalCost=%v", cfg.PluginID, t.ID, ws, e["size"], e["tokensIn"], e["tokensOut"], e["totalCost"]) }
+    }
+    return RegisterHistoryEntries(cfg, "import", entries)
+}
+
+// RegisterHistoryEntries merges ready-made taskHistory entries into state.vscdb and its
+// .backup, replacing entries with the same id. Both are backed up first with reason.
+func RegisterHistoryEntries(cfg config.Config, reason string, entries []map[string]any) error {
+    if len(entries) == 0 { return nil }
     dbPath, err := detectStateDBPath(cfg)
     if err != nil { return err }
-    // Backup both primary and backup DBs with the same suffix
-    suffix := time.Now().Format("20060102-150405")
-    // Backup primary db unconditionally
-    if err := backupFileWithSuffix(dbPath, suffix); err != nil {
-        if cfg.Debug { log.Printf("[statevscdb] warning: backup primary state DB failed: %v", err) }
+    if err := CheckEditorClosed(cfg); err != nil { return err }
+    ids := make([]string, 0, len(entries))
+    for _, e := range entries {
+        if id, _ := e["id"].(string); id != "" { ids = append(ids, id) }
     }
-    if err := upsertTasksIntoDB(dbPath, cfg.PluginID, workspace, ts, cfg.Debug); err != nil { return err }
-    // Update backup db (to avoid VS Code rollback overwriting changes), also back it up
-    bak := dbPath + ".backup"
-    if _, err := os.Stat(bak); err == nil {
-        if err := backupFileWithSuffix(bak, suffix); err != nil { if cfg.Debug { log.Printf("[statevscdb] warning: backup of state DB backup failed: %v", err) } }
-        if err := upsertTasksIntoDB(bak, cfg.PluginID, workspace, ts, cfg.Debug); err != nil { return err }
-    } else {
-        // Even if backup DB is missing, log for visibility
-        if cfg.Debug { log.Printf("[statevscdb] info: state DB backup file not found at %s; skipping", bak) }
+    dbs := existingStateDBs(dbPath)
+    if err := backupStateDBs(dbs, reason, ids); err != nil { return err }
+    for _, p := range dbs {
+        if err := mergeHistoryEntries(p, cfg.PluginID, entries); err != nil { return fmt.Errorf("register in %s: %w", p, err) }
     }
     return nil
 }
 
 func detectStateDBPath(cfg config.Config) (string, error) {
-    base, editor := stateDBBaseAndEditor(cfg)
-    p := filepath.Join(base, editor, "User", "globalStorage", "state.vscdb")
+    userDir, err := editorUserDir(cfg)
+    if err != nil { return "", err }
+    p := filepath.Join(userDir, "globalStorage", "state.vscdb")
     if _, err := os.Stat(p); err != nil { return "", fmt.Errorf("state db not found at %s", p) }
     return p, nil
 }
 
 // detectStateDBDir returns the directory that should contain state.vscdb even if the file is missing.
 func detectStateDBDir(cfg config.Config) (string, error) {
-    base, editor := stateDBBaseAndEditor(cfg)
-    dir := filepath.Join(base, editor, "User", "globalStorage")
+    userDir, err := editorUserDir(cfg)
+    if err != nil { return "", err }
+    dir := filepath.Join(userDir, "globalStorage")
     if _, err := os.Stat(dir); err != nil {
         return "", fmt.Errorf("state db directory not found: %s", dir)
     }
     return dir, nil
 }
 
-func stateDBBaseAndEditor(cfg config.Config) (string, string) {
-    base := ""
-    switch runtime.GOOS {
-    case "darwin":
-        base = filepath.Join(config.UserHome(), "Library", "Application Support")
-    case "linux":
-        base = filepath.Join(config.UserHome(), ".config")
-    case "windows":
-        if app := os.Getenv("APPDATA"); app != "" { base = app } else { base = "" }
-    default:
-        base = ""
-    }
-    editor := DisplayEditorName(cfg.CodeChannel)
-    return base, editor
-}
-
-func backupFile(path string) error {
-    if _, err := os.Stat(path); err != nil { return err }
-    name := filepath.Base(path)
-    bak := filepath.Join(filepath.Dir(path), name+".bak-"+time.Now().Format("20060102-150405"))
-    src, err := os.ReadFile(path)
-    if err != nil { return err }
-    return os.WriteFile(bak, src, 0o600)
-}
-
-func backupFileWithSuffix(path, suffix string) error {
-    if _, err := os.Stat(path); err != nil { return err }
-    name := filepath.Base(path)
-    bak := filepath.Join(filepath.Dir(path), name+".bak-"+suffix)
-    src, err := os.ReadFile(path)
-    if err != nil { return err }
-    return os.WriteFile(bak, src, 0o600)
-}
-
-func upsertTasksIntoDB(dbPath, pluginID, workspace string, ts []Task, debug bool) error {
-    db, err := sql.Open("sqlite", dbPath)
-    if err != nil { return err }
-    defer db.Close()
-    // Align with VS Code state DB behavior: WAL + busy timeout to avoid lock issues
-    _, _ = db.Exec("PRAGMA busy_timeout=5000")
-    _, _ = db.Exec("PRAGMA journal_mode=WAL")
-    if _, err := db.Exec("BEGIN IMMEDIATE"); err != nil { return err }
-    defer db.Exec("ROLLBACK")
-    if _, err := db.Exec("CREATE TABLE IF NOT EXISTS ItemTable (key TEXT PRIMARY KEY, value BLOB)"); err != nil { return err }
-
-    var raw []byte
-    err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&raw)
-    if err == sql.ErrNoRows { raw = []byte(`{"taskHistory":[]}`) } else if err != nil { return err }
-    var doc map[string]any
-    if err := json.Unmarshal(raw, &doc); err != nil { return fmt.Errorf("parse json: %w", err) }
-    hist, _ := doc["taskHistory"].([]any)
-    if hist == nil { hist = []any{} }
-    for _, t := range ts {
-        st := StatsFromTask(t)
-        entry := map[string]any{
-            "id":         t.ID,
-            "number":     1,
-            "ts":         t.CreatedAt.UnixMilli(),
-            "task":       t.Summary,
-            "tokensIn":   452134,
-            "tokensOut":  7027,
-            "totalCost":  1.2548531250000001,
-            "cacheWrites": st.CacheWrites,
-            "cacheReads":  st.CacheReads,
-            "size":       st.SizeBytes,
-            "workspace":  workspace,
-            "mode":       "code",
-        }
-        hist = append(hist, entry)
-        if debug {
-            log.Printf("[statevscdb] inserting taskHistory: db=%s plugin=%s id=%s number=%d ts=%d size=%d workspace=%s tokensIn=%d tokensOut=%d cacheReads=%d cacheWrites=%d totalCost=%.6f mode=%s",
-                dbPath, pluginID, t.ID, 1, t.CreatedAt.UnixMilli(), st.SizeBytes, workspace, 1, 1, st.CacheReads, st.CacheWrites, float64(1), "code")
-        }
-    }
-    doc["taskHistory"] = hist
-    b, err := json.Marshal(doc)
-    if err != nil { return err }
-    if _, err := db.Exec("INSERT INTO ItemTable(key, value) VALUES(?, ?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", pluginID, b); err != nil { return err }
-    if _, err := db.Exec("COMMIT"); err != nil { return err }
-    // Ensure WAL is checkpointed so changes persist to main db file
-    _, _ = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
-    if debug {
-        // verify write by reading back and logging count and presence of inserted IDs
-        var after []byte
-        if err := db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&after); err == nil {
-            var verify map[string]any
-            if json.Unmarshal(after, &verify) == nil {
-                if arr, ok := verify["taskHistory"].([]any); ok {
-                    log.Printf("[statevscdb] write committed: db=%s plugin=%s taskHistoryCount=%d", dbPath, pluginID, len(arr))
-                    // Build a quick index for lookup and verify each inserted id
-                    for _, t := range ts {
-                        found := false
-                        var number int
-                        var ws string
-                        for _, it := range arr {
-                            if m, ok := it.(map[string]any); ok {
-                                if idv, ok := m["id"].(string); ok && idv == t.ID {
-                                    found = true
-                                    if v, ok := m["number"].(float64); ok { number = int(v) }
-                                    if w, ok := m["workspace"].(string); ok { ws = w }
-                                    break
-                                }
-                            }
-                        }
-                        log.Printf("[statevscdb] verify: db=%s plugin=%s id=%s found=%t number=%d workspace=%s", dbPath, pluginID, t.ID, found, number, ws)
-                    }
-                } else {
-                    log.Printf("[statevscdb] verify: db=%s plugin=%s missing taskHistory array", dbPath, pluginID)
-                }
-            } else {
-                log.Printf("[statevscdb] verify: failed to parse JSON from db=%s plugin=%s: %v", dbPath, pluginID, err)
-            }
-        } else {
-            log.Printf("[statevscdb] verify: failed to read back row from db=%s plugin=%s: %v", dbPath, pluginID, err)
-        }
-    }
-    return nil
-}
-
 // VerifyRegistration checks that the given IDs exist in the taskHistory for both
 // the primary state DB and the optional backup DB. It returns presence maps keyed
 // by task ID for primary and backup.
@@ -229,6 +125,7 @@ type BackupInfo struct {
     Suffix  string
     ModTime time.Time
     Size    int64
+    Meta    *BackupMeta // why the backup was taken; nil for backups without metadata
 }
 
 // ListBackups returns all state.vscdb.bak-* backups sorted by ModTime desc, and the directory.
@@ -242,19 +139,23 @@ func ListBackups(cfg config.Config) ([]BackupInfo, string, error) {
         name := e.Name()
         if !e.Type().IsRegular() { continue }
         if !strings.HasPrefix(name, "state.vscdb.bak-") { continue }
+        if strings.HasSuffix(name, ".json") || strings.Contains(name, ".tmp-") { continue } // metadata, unfinished copies
+        if strings.HasSuffix(name, "-wal") || strings.HasSuffix(name, "-shm") { continue } // a backup being read
         info, err := e.Info(); if err != nil { continue }
         out = append(out, BackupInfo{
             Path: filepath.Join(dir, name),
             Suffix: strings.TrimPrefix(name, "state.vscdb.bak-"),
             ModTime: info.ModTime(),
             Size: info.Size(),
+            Meta: readBackupMeta(filepath.Join(dir, name)),
         })
     }
     sort.Slice(out, func(i, j int) bool { return out[i].ModTime.After(out[j].ModTime) })
     return out, dir, nil
 }
 
-// RestoreFromBackup restores state.vscdb and paired state.vscdb.backup from backups with the given suffix.
+// RestoreFromBackup restores state.vscdb and paired state.vscdb.backup from backups with
+// the given suffix. The backups are verified first and the current files backed up.
 func RestoreFromBackup(cfg config.Config, suffix string, debug bool) error {
     dir, err := detectStateDBDir(cfg)
     if err != nil { return err }
@@ -264,9 +165,15 @@ func RestoreFromBackup(cfg config.Config, suffix string, debug bool) error {
     dstBackup  := filepath.Join(dir, "state.vscdb.backup")
     // Sanity
     if _, err := os.Stat(srcPrimary); err != nil { return fmt.Errorf("primary backup not found: %s", srcPrimary) }
-    if err := copyFile(srcPrimary, dstPrimary); err != nil { return fmt.Errorf("restore primary: %w", err) }
+    if err := CheckEditorClosed(cfg); err != nil { return err }
+    now := backupSuffix(dstPrimary)
+    for _, p := range []string{dstPrimary, dstBackup} {
+        if _, err := os.Stat(p); err != nil { continue }
+        if err := backupStateDB(p, now, "before restoring .bak-"+suffix, nil); err != nil { return fmt.Errorf("back up %s (nothing was changed): %w", p, err) }
+    }
+    if err := replaceSQLite(srcPrimary, dstPrimary); err != nil { return fmt.Errorf("restore primary: %w", err) }
     if _, err := os.Stat(srcBackup); err == nil {
-        if err := copyFile(srcBackup, dstBackup); err != nil { return fmt.Errorf("restore backup: %w", err) }
+        if err := replaceSQLite(srcBackup, dstBackup); err != nil { return fmt.Errorf("restore backup: %w", err) }
     } else if debug {
         log.Printf("[restore] paired backup not found: %s (restored primary only)", srcBackup)
     }
@@ -281,3 +188,124 @@ func copyFile(src, dst string) error {
     if err := os.WriteFile(tmp, b, 0o600); err != nil { return err }
     return os.Rename(tmp, dst)
 }
+
+// ReadTaskHistory returns the raw taskHistory entries stored under the plugin key of
+// the primary state DB. A missing row yields an empty slice.
+func ReadTaskHistory(cfg config.Config) ([]map[string]any, error) {
+    if MultiSource(cfg) {
+        bySource, err := sourceHistories(cfg)
+        if err != nil { return nil, err }
+        var out []map[string]any
+        for _, hist := range bySource { out = append(out, hist...) }
+        return out, nil
+    }
+    dbPath, err := detectStateDBPath(cfg)
+    if err != nil { return nil, err }
+    return readTaskHistoryFromDB(dbPath, cfg.PluginID)
+}
+
+// sourceHistories reads taskHistory for every selected source, keyed by source label.
+// Sources without a readable state DB are skipped.
+func sourceHistories(cfg config.Config) (map[string][]map[string]any, error) {
+    srcs, err := selectedSources(cfg)
+    if err != nil { return nil, err }
+    out := map[string][]map[string]any{}
+    for _, s := range srcs {
+        dbPath, err := detectStateDBPath(s.Config(cfg))
+        if err != nil { continue }
+        hist, err := readTaskHistoryFromDB(dbPath, s.PluginID)
+        if err != nil {
+            if cfg.Debug { log.Printf("[statevscdb] %s: %v", s.Label(), err) }
+            continue
+        }
+        out[s.Label()] = hist
+    }
+    return out, nil
+}
+
+func readTaskHistoryFromDB(dbPath, pluginID string) ([]map[string]any, error) {
+    db, err := sql.Open("sqlite", dbPath)
+    if err != nil { return nil, err }
+    defer db.Close()
+    var raw []byte
+    err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&raw)
+    if err == sql.ErrNoRows { return []map[string]any{}, nil } else if err != nil { return nil, err }
+    var doc map[string]any
+    if err := json.Unmarshal(raw, &doc); err != nil { return nil, fmt.Errorf("parse json: %w", err) }
+    arr, _ := doc["taskHistory"].([]any)
+    out := make([]map[string]any, 0, len(arr))
+    for _, it := range arr {
+        if m, ok := it.(map[string]any); ok { out = append(out, m) }
+    }
+    return out, nil
+}
+
+// taskHistoryCounts returns, for every ItemTable key whose JSON value holds a
+// taskHistory array, the number of entries in it.
+func taskHistoryCounts(dbPath string) (map[string]int, error) {
+    db, err := sql.Open("sqlite", dbPath)
+    if err != nil { return nil, err }
+    defer db.Close()
+    rows, err := db.Query(`SELECT key, value FROM ItemTable WHERE value LIKE '%"taskHistory"%'`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[string]int{}
+    for rows.Next() {
+        var key string
+        var raw []byte
+        if err := rows.Scan(&key, &raw); err != nil { return nil, err }
+        var doc struct{ TaskHistory []json.RawMessage `json:"taskHistory"` }
+        if json.Unmarshal(raw, &doc) != nil || doc.TaskHistory == nil { continue }
+        out[key] = len(doc.TaskHistory)
+    }
+    return out, rows.Err()
+}
+
+// HistoryIndex returns the editor's taskHistory entries keyed by HistoryKey, which is the
+// task ID except in all-sources mode, where the same ID may live in several sources.
+func HistoryIndex(cfg config.Config) (map[string]map[string]any, error) {
+    bySource := map[string][]map[string]any{}
+    if MultiSource(cfg) {
+        var err error
+        if bySource, err = sourceHistories(cfg); err != nil { return nil, err }
+    } else {
+        hist, err := ReadTaskHistory(cfg)
+        if err != nil { return nil, err }
+        bySource[""] = hist
+    }
+    out := map[string]map[string]any{}
+    for src, hist := range bySource {
+        for _, m := range hist {
+            if id, _ := m["id"].(string); id != "" { out[HistoryKey(Task{ID: id, Source: src})] = m }
+        }
+    }
+    return out, nil
+}
+
+// HistoryKey is the key of t's entry in HistoryIndex and TaskWorkspaces.
+func HistoryKey(t Task) string {
+    if t.Source == "" { return t.ID }
+    return t.Source + "/" + t.ID
+}
+
+// TaskWorkspaces maps task keys (see HistoryKey) to the workspace recorded in the editor's taskHistory.
+func TaskWorkspaces(cfg config.Config) (map[string]string, error) {
+    idx, err := HistoryIndex(cfg)
+    if err != nil { return nil, err }
+    out := make(map[string]string, len(idx))
+    for key, m := range idx { out[key] = HistoryWorkspace(m) }
+    return out, nil
+}
+
+// AttachWorkspaces fills in the Workspace of tasks from the editor's taskHistory, so that
+// archives record where each task came from. Tasks not in the history are left as they are.
+func AttachWorkspaces(cfg config.Config, list []Task) {
+    ws, err := TaskWorkspaces(cfg)
+    if err != nil {
+        if cfg.Debug { log.Printf("[statevscdb] no workspaces for export: %v", err) }
+        return
+    }
+    for i := range list {
+        if w := ws[HistoryKey(list[i])]; w != "" { list[i].Workspace = w }
+    }
+}
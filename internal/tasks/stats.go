@@ -2,9 +2,10 @@ package tasks
 
 import (
     "encoding/json"
+    "fmt"
     "io/fs"
-    "os"
     "path/filepath"
+    "strings"
 )
 
 // TaskStats represents aggregate metrics parsed from a task directory.
@@ -18,23 +19,29 @@ type TaskStats struct {
 }
 
 // StatsFromTask attempts to read metrics from ui_messages.json. Falls back to zeros.
+// Results are cached per task directory until it changes; the size is also measured
+// again when checkpoints/ or compacted-images/ changed (see TaskDiskUsage).
 func StatsFromTask(t Task) TaskStats {
+    fp, ufp := fingerprint(t.Path), subtreeFingerprint(t.Path)
+    if e, ok := taskMeta.get(t.Path, fp); ok && e.Stats != nil {
+        st := *e.Stats
+        if e.SizeFP == ufp { return st }
+        st.SizeBytes = dirSize(t.Path)
+        taskMeta.update(t.Path, fp, func(e *metaEntry) { e.Stats, e.SizeFP = &st, ufp })
+        return st
+    }
+    st := readStats(t)
+    taskMeta.update(t.Path, fp, func(e *metaEntry) { e.Stats, e.SizeFP = &st, ufp })
+    return st
+}
+
+func readStats(t Task) TaskStats {
     var st TaskStats
     // compute size first
     st.SizeBytes = dirSize(t.Path)
-    // parse ui_messages.json for last AI stats JSON payload
-    p := filepath.Join(t.Path, "ui_messages.json")
-    b, err := os.ReadFile(p)
-    if err != nil { return st }
-    type raw struct {
-        Text string `json:"text"`
-        Images any   `json:"images"`
-    }
-    var arr []raw
-    if err := json.Unmarshal(b, &arr); err != nil { return st }
-    // iterate reversed to find last AI request (where Text contains JSON)
-    for i := len(arr) - 1; i >= 0; i-- {
-        if arr[i].Images != nil { continue } // skip user
+    // stream ui_messages.json and keep the last AI stats JSON payload
+    _ = eachMessage(messagesPath(t.Path), func(m uiMessage) bool {
+        if m.Images != nil || !strings.HasPrefix(m.Text, "{") { return true } // skip user and plain text
         var ai struct {
             APIProtocol string  `json:"apiProtocol"`
             Costs       float64 `json:"costs"`
@@ -44,15 +51,15 @@ func StatsFromTask(t Task) TaskStats {
             CacheReads  int     `json:"cacheReads"`
             CacheWrites int     `json:"cacheWrites"`
         }
-        if json.Unmarshal([]byte(arr[i].Text), &ai) == nil && (ai.TokenIn > 0 || ai.TokenOut > 0 || ai.Costs > 0) {
+        if json.Unmarshal([]byte(m.Text), &ai) == nil && (ai.TokenIn > 0 || ai.TokenOut > 0 || ai.Costs > 0) {
             st.TokensIn = ai.TokenIn
             st.TokensOut = ai.TokenOut
             st.CacheReads = ai.CacheReads
             st.CacheWrites = ai.CacheWrites
             st.TotalCost = ai.Costs
-            break
         }
-    }
+        return true
+    })
     return st
 }
 
@@ -67,3 +74,12 @@ func dirSize(root string) int64 {
     return n
 }
 
+
+// FormatSize renders a byte count with a 1024-based unit, e.g. "1.5 MB".
+func FormatSize(n int64) string {
+    const unit = 1024
+    if n < unit { return fmt.Sprintf("%d B", n) }
+    div, exp := int64(unit), 0
+    for v := n / unit; v >= unit; v /= unit { div *= unit; exp++ }
+    return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,139 @@
+package tasks
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+)
+
+// TailEvent is one finished ui_messages.json message, classified for `tail`.
+type TailEvent struct {
+    At        time.Time `json:"ts"`
+    Kind      string    `json:"kind"`           // user | api_req | tool | command | error | completion | question | text | other
+    Type      string    `json:"type"`           // "say" or "ask"
+    Name      string    `json:"name,omitempty"` // the say/ask value, e.g. "api_req_started"
+    Text      string    `json:"text,omitempty"`
+    Tool      string    `json:"tool,omitempty"`
+    Cost      float64   `json:"cost,omitempty"`      // cost of this API request
+    TotalCost float64   `json:"totalCost,omitempty"` // running task cost up to this request
+    TokensIn  int       `json:"tokensIn,omitempty"`
+    TokensOut int       `json:"tokensOut,omitempty"`
+}
+
+// Tailer reports the messages of a task's ui_messages.json that it has not reported yet.
+// Roo rewrites the whole array on every change and updates streaming ("partial") messages
+// in place, so each Poll re-reads the file and remembers messages by timestamp and kind.
+type Tailer struct {
+    path  string
+    seen  map[string]bool
+    total float64
+}
+
+func NewTailer(t Task) *Tailer {
+    return &Tailer{path: messagesPath(t.Path), seen: map[string]bool{}}
+}
+
+// Path is the file the tailer reads.
+func (tl *Tailer) Path() string { return tl.path }
+
+// Poll returns the messages finished since the previous call, oldest first. A missing
+// file yields nothing; a file caught mid-write returns an error and can be polled again.
+func (tl *Tailer) Poll() ([]TailEvent, error) {
+    var arr []uiMessage
+    err := eachMessage(tl.path, func(m uiMessage) bool { arr = append(arr, m); return true })
+    if os.IsNotExist(err) { return nil, nil }
+    if err != nil { return nil, err }
+    var out []TailEvent
+    for i, r := range arr {
+        key := fmt.Sprintf("%d/%s/%s%s", r.Ts, r.Type, r.Say, r.Ask)
+        if tl.seen[key] || r.Partial { continue }
+        ev, priced := classifyMessage(r)
+        // api_req_started is written before the response streams and gets its cost
+        // afterwards; wait for the cost unless later messages show the request is over.
+        if ev.Kind == "api_req" && !priced && i == len(arr)-1 { continue }
+        tl.seen[key] = true
+        if ev.Kind == "api_req" {
+            tl.total += ev.Cost
+            ev.TotalCost = tl.total
+        }
+        out = append(out, ev)
+    }
+    return out, nil
+}
+
+// classifyMessage maps a raw message to a TailEvent; priced reports whether an API
+// request already carries its cost.
+func classifyMessage(r uiMessage) (ev TailEvent, priced bool) {
+    ev = TailEvent{Type: r.Type, Name: r.Say, Text: r.Text}
+    if ev.Name == "" { ev.Name = r.Ask }
+    if r.Ts > 0 { ev.At = time.UnixMilli(r.Ts) }
+    var ai struct {
+        Request   string   `json:"request"`
+        Cost      *float64 `json:"cost"`
+        Costs     *float64 `json:"costs"` // older payloads
+        TokensIn  int      `json:"tokensIn"`
+        TokenIn   int      `json:"tokenIn"`
+        TokensOut int      `json:"tokensOut"`
+        TokenOut  int      `json:"tokenOut"`
+    }
+    isReq := r.Say == "api_req_started"
+    if isReq {
+        _ = json.Unmarshal([]byte(r.Text), &ai)
+    } else if r.Say == "" && r.Ask == "" && r.Images == nil {
+        // payloads without a say field, as LoadHistory accepts them
+        isReq = json.Unmarshal([]byte(r.Text), &ai) == nil && ai.Request != ""
+    }
+    switch {
+    case r.Images != nil || r.Say == "user_feedback":
+        ev.Kind = "user"
+    case isReq:
+        ev.Kind = "api_req"
+        ev.Text = ai.Request
+        ev.TokensIn, ev.TokensOut = ai.TokensIn+ai.TokenIn, ai.TokensOut+ai.TokenOut
+        switch {
+        case ai.Cost != nil:
+            ev.Cost, priced = *ai.Cost, true
+        case ai.Costs != nil:
+            ev.Cost, priced = *ai.Costs, true
+        }
+    case r.Ask != "":
+        ev.Kind = askKind(r.Ask)
+    case r.Say == "tool":
+        ev.Kind = "tool"
+    case r.Say == "error" || r.Say == "diff_error" || r.Say == "rooignore_error":
+        ev.Kind = "error"
+    case r.Say == "completion_result":
+        ev.Kind = "completion"
+    case r.Say == "text":
+        ev.Kind = "text"
+    default:
+        ev.Kind = "other"
+    }
+    if ev.Kind == "tool" {
+        var tool struct {
+            Tool string `json:"tool"`
+            Path string `json:"path"`
+        }
+        if json.Unmarshal([]byte(r.Text), &tool) == nil && tool.Tool != "" {
+            ev.Tool, ev.Text = tool.Tool, tool.Path
+        }
+    }
+    return ev, priced
+}
+
+func askKind(ask string) string {
+    switch ask {
+    case "tool":
+        return "tool"
+    case "command":
+        return "command"
+    case "api_req_failed", "mistake_limit_reached":
+        return "error"
+    case "completion_result":
+        return "completion"
+    case "followup":
+        return "question"
+    }
+    return "other"
+}
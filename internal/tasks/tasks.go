@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"roocode-task-man/internal/config"
@@ -22,6 +23,8 @@ type Task struct {
     CreatedAt time.Time
     Path      string
     Meta      map[string]any
+    Source    string // Editor:pluginID, set when loading all sources
+    Workspace string // workspace from taskHistory, set by AttachWorkspaces or read from an archive
 }
 
 type HistoryItem struct {
@@ -36,47 +39,89 @@ func ResolveStorageRoot(cfg config.Config) (string, error) {
     if cfg.DataDir != "" {
         return cfg.DataDir, nil
     }
-    base := ""
+    userDir, err := editorUserDir(cfg)
+    if err != nil { return "", err }
+    // Global storage root
+    return filepath.Join(userDir, "globalStorage", cfg.PluginID), nil
+}
+
+// editorUserDir returns the editor's User directory (the parent of globalStorage). In order:
+//   - cfg.UserDataDir, as given to the editor's --user-data-dir or a portable data/ folder
+//   - derived from cfg.DataDir when it is <User>/globalStorage/<plugin>
+//   - <home>/<.server-dir>/data/User for remote servers (see serverChannel)
+//   - <appdata>/<Editor>/User for desktop editors
+func editorUserDir(cfg config.Config) (string, error) {
+    if cfg.UserDataDir != "" { return userDirFromDataDir(cfg.UserDataDir), nil }
+    if cfg.DataDir != "" {
+        if gs := filepath.Dir(filepath.Clean(cfg.DataDir)); filepath.Base(gs) == "globalStorage" { return filepath.Dir(gs), nil }
+    }
+    channel := cfg.CodeChannel
+    if channel == "" { channel = "Code" }
+    if dir, ok := serverChannel(channel); ok {
+        return filepath.Join(serverHome(cfg), dir, "data", "User"), nil
+    }
+    codeDir, isCustom := mapEditorChannel(channel)
+    if isCustom {
+        return "", errors.New("custom editor requires --user-data-dir (or a --data-dir inside <User>/globalStorage)")
+    }
+    base, err := appDataBase()
+    if err != nil { return "", err }
+    return filepath.Join(base, codeDir, "User"), nil
+}
+
+// userDirFromDataDir maps a user data directory to its User folder. A portable install's
+// data/ folder keeps it under user-data/; an editor --user-data-dir has it directly.
+func userDirFromDataDir(dir string) string {
+    if !isDir(filepath.Join(dir, "User")) && isDir(filepath.Join(dir, "user-data")) {
+        return filepath.Join(dir, "user-data", "User")
+    }
+    return filepath.Join(dir, "User")
+}
+
+// appDataBase returns the OS application data directory editors keep their User folder in.
+func appDataBase() (string, error) {
     switch runtime.GOOS {
     case "darwin":
         // macOS
-        base = filepath.Join(config.UserHome(), "Library", "Application Support")
+        return filepath.Join(config.UserHome(), "Library", "Application Support"), nil
     case "linux":
-        base = filepath.Join(config.UserHome(), ".config")
+        if xdg := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) { return xdg, nil }
+        return filepath.Join(config.UserHome(), ".config"), nil
     case "windows":
         appdata := os.Getenv("APPDATA")
         if appdata == "" {
             return "", errors.New("APPDATA not set")
         }
-        base = appdata
-    default:
-        return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
-    }
-
-    channel := cfg.CodeChannel
-    if channel == "" { channel = "Code" }
-    codeDir, isCustom := mapEditorChannel(channel)
-    if isCustom {
-        if cfg.DataDir == "" {
-            return "", errors.New("custom editor requires dataDir override")
-        }
-        return cfg.DataDir, nil
+        return appdata, nil
     }
-
-    // Global storage root
-    userDir := filepath.Join(base, codeDir, "User", "globalStorage", cfg.PluginID)
-    return userDir, nil
+    return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
 }
 
-// LoadTasks discovers available tasks under the plugin storage.
+// LoadTasks discovers available tasks under the plugin storage, or under every
+// detected source in all-sources mode (see MultiSource).
 func LoadTasks(cfg config.Config) ([]Task, error) {
-    root, err := ResolveStorageRoot(cfg)
+    srcs, err := selectedSources(cfg)
     if err != nil { return nil, err }
-    dirs := DiscoverTaskDirs(root)
-    tasks := BuildTasksFromDirs(dirs)
+    openMetaCache(cfg)
+    var tasks []Task
+    for _, s := range srcs {
+        part := BuildTasksFromDirs(DiscoverTaskDirs(s.Root))
+        if MultiSource(cfg) { setSource(part, s) }
+        tasks = append(tasks, part...)
+    }
+    SaveMetaCache(cfg)
+    sortByCreatedDesc(tasks)
     return tasks, nil
 }
 
+func setSource(list []Task, s Source) {
+    for i := range list { list[i].Source = s.Label() }
+}
+
+func sortByCreatedDesc(list []Task) {
+    sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+}
+
 // DiscoverTaskDirs returns likely task directories.
 func DiscoverTaskDirs(root string) []string {
     candidates := []string{
@@ -104,101 +149,122 @@ func DiscoverTaskDirs(root string) []string {
     return taskDirs
 }
 
-// BuildTasksFromDirs builds Task objects from directory paths.
+// BuildTasksFromDirs builds Task objects from directory paths. Directories are read by a
+// pool of workers, and directories unchanged since they were last read (see fingerprint)
+// are served from the metadata cache.
 func BuildTasksFromDirs(taskDirs []string) []Task {
-    tasks := make([]Task, 0, len(taskDirs))
-    for _, d := range taskDirs {
-        id := filepath.Base(d)
-        summary := readSummary(d)
-        title := summary
-        if title == "" { title = id }
-        created := dirCreatedAt(d)
-        tasks = append(tasks, Task{
-            ID:        id,
-            Title:     title,
-            Summary:   summary,
-            CreatedAt: created,
-            Path:      d,
-            Meta:      map[string]any{},
-        })
+    tasks := make([]Task, len(taskDirs))
+    workers := min(len(taskDirs), max(4, runtime.NumCPU()))
+    next := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next { tasks[i] = buildTask(taskDirs[i]) }
+        }()
     }
-    sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.After(tasks[j].CreatedAt) })
+    for i := range taskDirs { next <- i }
+    close(next)
+    wg.Wait()
+    sortByCreatedDesc(tasks)
     return tasks
 }
 
+// buildTask reads one task directory's title and creation time.
+func buildTask(d string) Task {
+    id := filepath.Base(d)
+    fp := fingerprint(d)
+    e, ok := taskMeta.get(d, fp)
+    if !ok || e.CreatedAt.IsZero() {
+        e.Summary, e.CreatedAt = readSummary(d), dirCreatedAt(d)
+        taskMeta.update(d, fp, func(c *metaEntry) { c.Summary, c.CreatedAt = e.Summary, e.CreatedAt })
+    }
+    title := e.Summary
+    if title == "" { title = id }
+    return Task{
+        ID:        id,
+        Title:     title,
+        Summary:   e.Summary,
+        CreatedAt: e.CreatedAt,
+        Path:      d,
+        Meta:      map[string]any{},
+    }
+}
+
 func readSummary(dir string) string {
-    // Attempt to read <dir>/ui_messages.json and extract first object's "text" field
-    p := filepath.Join(dir, "ui_messages.json")
-    b, err := os.ReadFile(p)
-    if err != nil { return "" }
-    // Minimal JSON scan to avoid importing encoding/json if we can? We already use it in zipper, so use it.
-    type msg struct{ Text string `json:"text"` }
-    var arr []msg
-    if err := json.Unmarshal(b, &arr); err != nil || len(arr) == 0 { return "" }
-    return arr[0].Text
+    // The first message's "text" is the task prompt; only that message is read.
+    var first uiMessage
+    if err := FirstMessage(messagesPath(dir), &first); err != nil { return "" }
+    return first.Text
 }
 
 // LoadHistory parses ui_messages.json within the task directory and returns a list of history items.
+// The file is streamed, so embedded images are never loaded.
 func LoadHistory(t Task) []HistoryItem {
-    p := filepath.Join(t.Path, "ui_messages.json")
-    b, err := os.ReadFile(p)
-    if err != nil { return nil }
-    // support array of objects with fields: ts, type, say, text
-    type raw struct {
-        Ts   int64   `json:"ts"`
-        Type string  `json:"type"`
-        Say  string  `json:"say"`
-        Text string  `json:"text"`
-        Images any   `json:"images"`
+    var out []HistoryItem
+    _ = eachMessage(messagesPath(t.Path), func(r uiMessage) bool {
+        out = append(out, historyItem(r))
+        return true
+    })
+    return out
+}
+
+// LastHistory is LoadHistory limited to the last n entries; the earlier messages are
+// streamed past without being kept.
+func LastHistory(t Task, n int) []HistoryItem {
+    raws, _ := LastMessages(messagesPath(t.Path), n)
+    out := make([]HistoryItem, 0, len(raws))
+    for _, raw := range raws {
+        var r uiMessage
+        if json.Unmarshal(raw, &r) == nil { out = append(out, historyItem(r)) }
     }
-    var arr []raw
-    if err := json.Unmarshal(b, &arr); err != nil { return nil }
-    out := make([]HistoryItem, 0, len(arr))
-    for _, r := range arr {
-        if r.Ts > 0 { /* ok */ }
-        // If user message: has images field (array even if empty)
-        if r.Images != nil {
-            it := HistoryItem{Role: "user", Kind: "User", Text: r.Text}
-            if r.Ts > 0 { it.At = time.UnixMilli(r.Ts) }
-            out = append(out, it)
-            continue
-        }
-        // Try to parse AI request JSON in r.Text
-        var ai struct {
-            APIProtocol string  `json:"apiProtocol"`
-            Costs       float64 `json:"costs"`
-            Request     string  `json:"request"`
-            Mode        string  `json:"mode"`
-            TokenIn     int     `json:"tokenIn"`
-            TokenOut    int     `json:"tokenOut"`
-            CacheReads  int     `json:"cacheReads"`
-            CacheWrites int     `json:"cacheWrites"`
-        }
-        var it HistoryItem
-        if json.Unmarshal([]byte(r.Text), &ai) == nil && ai.Request != "" {
-            it.Role = "ai"
-            it.Kind = "AI Request"
-            // Build markdown block with request and stats
-            sb := strings.Builder{}
-            if ai.Request != "" { sb.WriteString(ai.Request); sb.WriteString("\n\n") }
-            sb.WriteString("**Stats**\\n")
-            fmt.Fprintf(&sb, "- Protocol: %s\\n", ai.APIProtocol)
-            fmt.Fprintf(&sb, "- Cost: $%.4f\\n", ai.Costs)
-            fmt.Fprintf(&sb, "- Tokens: in %d / out %d\\n", ai.TokenIn, ai.TokenOut)
-            fmt.Fprintf(&sb, "- Mode: %s\\n", ai.Mode)
-            fmt.Fprintf(&sb, "- Cache: reads %d / writes %d\\n", ai.CacheReads, ai.CacheWrites)
-            it.Text = sb.String()
-        } else {
-            // Fallback: include as-is if text present
-            it.Role = "other"
-            it.Kind = r.Say
-            if it.Kind == "" { it.Kind = r.Type }
-            it.Text = r.Text
-        }
+    return out
+}
+
+// historyItem converts one message (fields: ts, type, say, text, images) to a HistoryItem.
+func historyItem(r uiMessage) HistoryItem {
+    // If user message: has images field (array even if empty)
+    if r.Images != nil {
+        it := HistoryItem{Role: "user", Kind: "User", Text: r.Text}
         if r.Ts > 0 { it.At = time.UnixMilli(r.Ts) }
-        out = append(out, it)
+        return it
     }
-    return out
+    // Try to parse AI request JSON in r.Text
+    var ai struct {
+        APIProtocol string  `json:"apiProtocol"`
+        Costs       float64 `json:"costs"`
+        Request     string  `json:"request"`
+        Mode        string  `json:"mode"`
+        TokenIn     int     `json:"tokenIn"`
+        TokenOut    int     `json:"tokenOut"`
+        CacheReads  int     `json:"cacheReads"`
+        CacheWrites int     `json:"cacheWrites"`
+    }
+    var it HistoryItem
+    if json.Unmarshal([]byte(r.Text), &ai) == nil && ai.Request != "" {
+        it.Role = "ai"
+        it.Kind = "AI Request"
+        // Build markdown block with request and stats
+        sb := strings.Builder{}
+        if ai.Request != "" { sb.WriteString(ai.Request); sb.WriteString("\n\n") }
+        sb.WriteString("**Stats**\\n")
+        fmt.Fprintf(&sb, "- Protocol: %s\\n", ai.APIProtocol)
+        fmt.Fprintf(&sb, "- Cost: $%.4f\\n", ai.Costs)
+        fmt.Fprintf(&sb, "- Tokens: in %d / out %d\\n", ai.TokenIn, ai.TokenOut)
+        fmt.Fprintf(&sb, "- Mode: %s\\n", ai.Mode)
+        fmt.Fprintf(&sb, "- Cache: reads %d / writes %d\\n", ai.CacheReads, ai.CacheWrites)
+        it.Text = sb.String()
+    } else {
+        // Fallback: include as-is if text present
+        it.Role = "other"
+        it.Kind = r.Say
+        if it.Kind == "" { it.Kind = r.Ask }
+        if it.Kind == "" { it.Kind = r.Type }
+        it.Text = r.Text
+    }
+    if r.Ts > 0 { it.At = time.UnixMilli(r.Ts) }
+    return it
 }
 
 func dirCreatedAt(path string) time.Time {
@@ -221,6 +287,31 @@ func dirCreatedAt(path string) time.Time {
     return t
 }
 
+// serverDirs are the folders VS Code-style remote servers (Remote-SSH, devcontainers,
+// WSL) keep under the remote user's home; each holds data/User/globalStorage.
+var serverDirs = []string{".vscode-server", ".vscode-server-insiders", ".vscode-remote", ".cursor-server", ".windsurf-server", ".vscodium-server", ".trae-server"}
+
+// serverChannel maps a channel such as "vscode-server" or ".cursor-server" to its
+// folder under the server home.
+func serverChannel(channel string) (string, bool) {
+    norm := "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(channel)), ".")
+    for _, d := range serverDirs {
+        if norm == d { return d, true }
+    }
+    return "", false
+}
+
+// serverHome is where server folders are looked up: cfg.RemoteHome (e.g. a remote home
+// mounted over SSHFS, or a container volume) or the local home when running remotely.
+func serverHome(cfg config.Config) string {
+    if cfg.RemoteHome != "" { return cfg.RemoteHome }
+    return config.UserHome()
+}
+
+// knownEditorChannels lists one channel name per editor mapEditorChannel knows about;
+// all-sources mode scans each of them.
+var knownEditorChannels = []string{"code", "insiders", "vscodium", "cursor", "windsurf", "trae"}
+
 // mapEditorChannel normalizes known VS Code forks to their application data folder name.
 // Returns (codeDir, isCustom). For unknown strings, returns the input as-is with isCustom=false.
 func mapEditorChannel(channel string) (string, bool) {
@@ -251,13 +342,10 @@ func mapEditorChannel(channel string) (string, bool) {
 // DisplayEditorName returns a friendly editor/app folder name used for display and path resolution.
 func DisplayEditorName(channel string) string {
     if channel == "" { return "Code" }
+    if dir, ok := serverChannel(channel); ok { return strings.TrimPrefix(dir, ".") }
     if name, custom := mapEditorChannel(channel); !custom && name != "" {
         return name
     }
     return channel
 }
 
-// DeleteTask removes the task directory recursively.
-func DeleteTask(t Task) error {
-    return os.RemoveAll(t.Path)
-}
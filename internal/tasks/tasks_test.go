@@ -1,11 +1,30 @@
 package tasks
 
 import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
     "os"
     "path/filepath"
+    "runtime"
+    "strings"
     "testing"
+    "time"
+
+    "roocode-task-man/internal/config"
 )
 
+func TestMain(m *testing.M) {
+    // Tests that load tasks without NoCache must not touch ~/.cache.
+    dir, err := os.MkdirTemp("", "roo-task-man-cache-")
+    if err != nil { panic(err) }
+    userCacheDir = func() (string, error) { return dir, nil }
+    code := m.Run()
+    os.RemoveAll(dir)
+    os.Exit(code)
+}
+
 func TestDiscoverAndBuildTasks(t *testing.T) {
     root := t.TempDir()
     // Create structure: <root>/tasks/t1/file.txt
@@ -26,3 +45,844 @@ func TestDiscoverAndBuildTasks(t *testing.T) {
     if list[0].ID != "t1" { t.Fatalf("expected id t1, got %s", list[0].ID) }
 }
 
+
+// writeTask creates <root>/tasks/<id>/ui_messages.json with the given raw JSON array.
+func writeTask(t *testing.T, root, id, uiMessages string) string {
+    t.Helper()
+    dir := filepath.Join(root, "tasks", id)
+    if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(uiMessages), 0o644); err != nil { t.Fatal(err) }
+    return dir
+}
+
+func TestFilterTasks(t *testing.T) {
+    root := t.TempDir()
+    day := func(d int) time.Time { return time.Date(2025, 12, d, 12, 0, 0, 0, time.Local) }
+    list := []Task{
+        {ID: "a", Title: "fix login", CreatedAt: day(1), Path: writeTask(t, root, "a", `[{"text":"fix login","images":[]}]`)},
+        {ID: "b", Title: "add docs", CreatedAt: day(2), Path: writeTask(t, root, "b", `[{"text":"add docs","images":[]},{"text":"mention login too","images":[]}]`)},
+        {ID: "c", Title: "refactor", CreatedAt: day(3), Path: writeTask(t, root, "c", `[{"text":"refactor","images":[]}]`)},
+    }
+    ids := func(ts []Task) string { s := []string{}; for _, t := range ts { s = append(s, t.ID) }; return strings.Join(s, ",") }
+
+    if got := ids(FilterTasks(list, Filter{}, nil)); got != "a,b,c" { t.Fatalf("empty filter: got %s", got) }
+    from, to := day(3), day(3)
+    if got := ids(FilterTasks(list, Filter{IDs: []string{"a"}, From: &from, To: &to}, nil)); got != "a,c" {
+        t.Fatalf("ids+dates should union: got %s", got)
+    }
+    if got := ids(FilterTasks(list, Filter{Query: "LOGIN"}, nil)); got != "a,b" { t.Fatalf("query: got %s", got) }
+    ws := map[string]string{"a": "/src/app", "b": "/src/lib", "c": "/src/app"}
+    if got := ids(FilterTasks(list, Filter{Workspace: "app", Query: "login"}, ws)); got != "a" {
+        t.Fatalf("workspace+query: got %s", got)
+    }
+}
+
+func TestDumpMarkdownWithTemplate(t *testing.T) {
+    root := t.TempDir()
+    writeTask(t, root, "t1", `[{"ts":1,"text":"build it","images":[]},{"ts":2,"type":"ask","ask":"tool","text":"{\"tool\":\"readFile\",\"path\":\"main.go\"}"},{"ts":3,"type":"say","say":"text","text":"done"}]`)
+    tmplPath := filepath.Join(root, "dump.tmpl")
+    tmpl := `{{range .Tasks}}{{.ID}}:{{range .Messages}} [{{.Category}}] {{if eq .Category "tool"}}{{toolSummary .Text}}{{else}}{{oneLine 20 .Text}}{{end}}{{end}}
+{{end}}`
+    if err := os.WriteFile(tmplPath, []byte(tmpl), 0o644); err != nil { t.Fatal(err) }
+    cfg := config.Config{CodeChannel: "Custom", DataDir: root}
+    out := filepath.Join(root, "out.md")
+
+    if err := DumpMarkdownWithOptions(cfg, out, DumpOptions{TemplatePath: tmplPath}, nil); err != nil { t.Fatal(err) }
+    b, _ := os.ReadFile(out)
+    if got := strings.TrimSpace(string(b)); got != "t1: [prompt] build it" { t.Fatalf("prompts only: got %q", got) }
+
+    if err := DumpMarkdownWithOptions(cfg, out, DumpOptions{TemplatePath: tmplPath, IncludeAll: true}, nil); err != nil { t.Fatal(err) }
+    b, _ = os.ReadFile(out)
+    if got := strings.TrimSpace(string(b)); got != "t1: [prompt] build it [tool] readFile main.go [response] done" {
+        t.Fatalf("include all: got %q", got)
+    }
+
+    if err := DumpMarkdownWithOptions(cfg, out, DumpOptions{Filter: Filter{Query: "nomatch"}, TemplatePath: tmplPath}, nil); err != nil { t.Fatal(err) }
+    b, _ = os.ReadFile(out)
+    if strings.TrimSpace(string(b)) != "" { t.Fatalf("filtered dump should be empty, got %q", b) }
+}
+
+func TestQueryAndSort(t *testing.T) {
+    root := t.TempDir()
+    now := time.Now()
+    mk := func(id, ui string, created time.Time) Task {
+        return Task{ID: id, Title: id, CreatedAt: created, Path: writeTask(t, root, id, ui)}
+    }
+    list := []Task{
+        mk("cheap", `[{"text":"tweak readme","images":[]}]`, now.Add(-48*time.Hour)),
+        mk("pricey", `[{"text":"fix login","images":[]},{"type":"say","say":"api_req_started","text":"{\"request\":\"r\",\"costs\":7.5}"},{"type":"ask","ask":"tool","text":"{\"tool\":\"editedExistingFile\",\"path\":\"src/auth.go\"}"}]`, now),
+    }
+    hist := map[string]map[string]any{"pricey": {"workspace": "/src/api", "mode": "code"}, "cheap": {"workspace": "/src/web", "mode": "ask"}}
+    rows := NewRows(list, hist)
+    match := func(expr string) string {
+        q, err := ParseQuery(expr)
+        if err != nil { t.Fatalf("parse %q: %v", expr, err) }
+        ids := []string{}
+        for _, r := range rows { if q.Match(r) { ids = append(ids, r.ID) } }
+        return strings.Join(ids, ",")
+    }
+    cases := map[string]string{
+        "":                               "cheap,pricey",
+        "cost>5":                         "pricey",
+        "cost <= 5":                      "cheap",
+        "mode=code and workspace~api":    "pricey",
+        "mode=ask or has-file~auth.go":   "cheap,pricey",
+        "not text~'fix login'":           "cheap",
+        "age<1d":                         "pricey",
+        "(cost>5 or mode=ask) msgs>=3":   "pricey",
+        "created=" + now.Format("2006-01-02"): "pricey",
+    }
+    for expr, want := range cases {
+        if got := match(expr); got != want { t.Errorf("%q: got %q want %q", expr, got, want) }
+    }
+    for _, bad := range []string{"bogus>1", "cost>abc", "cost>", "(cost>1", "text>1"} {
+        if _, err := ParseQuery(bad); err == nil { t.Errorf("%q: expected error", bad) }
+    }
+
+    if err := SortRows(rows, "-cost"); err != nil { t.Fatal(err) }
+    if rows[0].ID != "pricey" { t.Fatalf("sort -cost: got %s first", rows[0].ID) }
+    if err := SortRows(rows, "workspace"); err != nil { t.Fatal(err) }
+    if rows[0].ID != "pricey" { t.Fatalf("sort workspace: got %s first", rows[0].ID) }
+}
+
+func TestResolveRef(t *testing.T) {
+    day := func(d int) time.Time { return time.Date(2025, 12, d, 12, 0, 0, 0, time.Local) }
+    list := []Task{
+        {ID: "0199ab-1111", Title: "Fix login redirect", CreatedAt: day(1)},
+        {ID: "0199ac-2222", Title: "Add docs", CreatedAt: day(3)},
+        {ID: "7f00aa-3333", Title: "Refactor login form", CreatedAt: day(2)},
+    }
+    for ref, want := range map[string]string{
+        "0199ac-2222": "0199ac-2222",
+        "0199AB":      "0199ab-1111",
+        "7":           "7f00aa-3333",
+        "@latest":     "0199ac-2222",
+        "@2":          "7f00aa-3333",
+        "redirect":    "0199ab-1111",
+    } {
+        got, err := ResolveRef(list, ref)
+        if err != nil { t.Fatalf("%s: %v", ref, err) }
+        if got.ID != want { t.Fatalf("%s: got %s, want %s", ref, got.ID, want) }
+    }
+    _, err := ResolveRef(list, "0199a")
+    amb, ok := err.(*AmbiguousError)
+    if !ok || len(amb.Candidates) != 2 { t.Fatalf("prefix 0199a should be ambiguous, got %v", err) }
+    if _, err := ResolveRef(list, "login"); err == nil || !strings.Contains(err.Error(), "7f00aa-3333") {
+        t.Fatalf("title login should list candidates, got %v", err)
+    }
+    for _, ref := range []string{"@4", "@0", "nothing"} {
+        if _, err := ResolveRef(list, ref); err == nil { t.Fatalf("%s: expected error", ref) }
+    }
+    ids, err := ResolveRefs(list, []string{"@latest", "0199ac", "docs"})
+    if err != nil || strings.Join(ids, ",") != "0199ac-2222" { t.Fatalf("ResolveRefs: %v %v", ids, err) }
+}
+
+func TestLoadAllSources(t *testing.T) {
+    if runtime.GOOS != "linux" { t.Skip("app data layout below is Linux's") }
+    home := t.TempDir()
+    t.Setenv("HOME", home)
+    t.Setenv("XDG_CONFIG_HOME", "")
+    t.Setenv("XDG_CACHE_HOME", "")
+    gs := func(editor string) string { return filepath.Join(home, ".config", editor, "User", "globalStorage") }
+    writeTask(t, filepath.Join(gs("Code"), "RooVeterinaryInc.roo-cline"), "a", `[{"text":"one","images":[]}]`)
+    writeTask(t, filepath.Join(gs("Cursor"), "kilocode.kilo-code"), "b", `[{"text":"two","images":[]}]`)
+    writeTask(t, filepath.Join(gs("Cursor"), "someone.fork"), "c", `[{"text":"three","images":[]}]`)
+    if err := os.MkdirAll(filepath.Join(gs("Cursor"), "unrelated.ext"), 0o755); err != nil { t.Fatal(err) }
+
+    srcs, err := DetectSources(config.Config{})
+    if err != nil { t.Fatal(err) }
+    labels := []string{}
+    for _, s := range srcs { labels = append(labels, s.Label()) }
+    if got := strings.Join(labels, ","); got != "Code:RooVeterinaryInc.roo-cline,Cursor:kilocode.kilo-code,Cursor:someone.fork" {
+        t.Fatalf("sources: %s", got)
+    }
+
+    list, err := LoadTasks(config.Config{Source: "cursor"})
+    if err != nil { t.Fatal(err) }
+    got := map[string]string{}
+    for _, tk := range list { got[tk.ID] = tk.Source }
+    if len(got) != 2 || got["b"] != "Cursor:kilocode.kilo-code" || got["c"] != "Cursor:someone.fork" {
+        t.Fatalf("cursor tasks: %v", got)
+    }
+}
+
+func TestRewriteAndTranslateHistory(t *testing.T) {
+    rules := []PathRewrite{{From: "/Users/me", To: "/home/me"}, {From: "/Users/me/work/", To: "/srv/work"}}
+    for in, want := range map[string]string{
+        "/Users/me/app":       "/home/me/app",
+        "/Users/me/work/api":  "/srv/work/api",
+        "/Users/me":           "/home/me",
+        "/Users/meow/app":     "/Users/meow/app",
+        "":                    "",
+    } {
+        if got := RewritePath(in, rules); got != want { t.Fatalf("RewritePath(%q) = %q, want %q", in, got, want) }
+    }
+
+    here := t.TempDir()
+    rules = append(rules, PathRewrite{From: "/Users/alice/src", To: "/home/bob/code"})
+    for _, c := range []struct{ original, override, path, reason string }{
+        {"/Users/alice/src/api", "", "/home/bob/code/api", "rule"},
+        {"/Users/me/work/api", "", "/srv/work/api", "rule"},
+        {"/Users/alice/src/api", "/ws", "/ws", "flag"},
+        {here, "", here, "original"},
+        {"/Volumes/gone/app", "", "/cwd", "cwd"},
+        {"", "", "/cwd", "cwd"},
+    } {
+        w := MapImportWorkspace("id", c.original, c.override, "/cwd", rules)
+        if w.Path != c.path || w.Reason != c.reason || (c.reason == "rule") != (w.Rule != nil) {
+            t.Fatalf("MapImportWorkspace(%q, %q) = %+v", c.original, c.override, w)
+        }
+    }
+    if _, i := MatchPathRewrite("/Users/alice/src/api", rules); i != 2 { t.Fatalf("matched rule %d", i) }
+    if got := PathRewrites(config.Config{PathMap: []config.PathMapping{{From: "/a", To: "/b"}, {From: "/c"}}}); len(got) != 1 || got[0].To != "/b" { t.Fatalf("PathRewrites: %v", got) }
+
+    roo := map[string]any{"id": "a", "ts": 1.0, "task": "x", "number": 3.0, "mode": "architect", "workspace": "/old", "extra": true}
+    cline := TranslateHistoryEntry(roo, "RooVeterinaryInc.roo-cline", "saoudrizwan.claude-dev", "/new")
+    if cline["cwdOnTaskInitialization"] != "/new" || cline["workspace"] != nil || cline["mode"] != nil || cline["extra"] != nil || cline["task"] != "x" {
+        t.Fatalf("roo -> cline: %v", cline)
+    }
+    back := TranslateHistoryEntry(cline, "saoudrizwan.claude-dev", "kilocode.kilo-code", "/new")
+    if back["workspace"] != "/new" || back["cwdOnTaskInitialization"] != nil || back["mode"] != "code" || back["number"] != 1 {
+        t.Fatalf("cline -> kilo: %v", back)
+    }
+    same := TranslateHistoryEntry(roo, "RooVeterinaryInc.roo-cline", "kilocode.kilo-code", "/new")
+    if same["mode"] != "architect" || same["extra"] != true || same["workspace"] != "/new" { t.Fatalf("roo -> kilo: %v", same) }
+}
+
+func TestMigrateTasks(t *testing.T) {
+    base := t.TempDir()
+    src := func(name, pluginID string) Source {
+        user := filepath.Join(base, name)
+        return Source{Editor: "Custom", PluginID: pluginID, Root: filepath.Join(user, "User", "globalStorage", pluginID), UserDataDir: user}
+    }
+    from, to := src("from", "RooVeterinaryInc.roo-cline"), src("to", "kilocode.kilo-code")
+    writeTask(t, from.Root, "a", `[{"ts":3,"text":"first","images":[]}]`)
+    writeStateDB(t, filepath.Join(filepath.Dir(from.Root), "state.vscdb"), from.PluginID, "a")
+    toDB := filepath.Join(filepath.Dir(to.Root), "state.vscdb")
+    if err := os.MkdirAll(to.Root, 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(toDB, []byte("not a database, just some bytes long enough to look like a header"), 0o644); err != nil { t.Fatal(err) }
+    opts := MigrateOptions{From: from, To: to, Filter: Filter{IDs: []string{"a"}}, Config: config.Config{NoCache: true}}
+    if _, err := MigrateTasks(opts); err == nil { t.Fatal("migrating into a broken state DB should fail") }
+    if isDir(filepath.Join(to.Root, "tasks", "a")) { t.Fatal("failed migration left the task folder behind") }
+
+    // Existing entries keep their order, even when it is not by ts.
+    if err := os.Remove(toDB); err != nil { t.Fatal(err) }
+    if err := mergeHistoryEntries(toDB, to.PluginID, []map[string]any{{"id": "z", "ts": 5}, {"id": "y", "ts": 1}}); err != nil { t.Fatal(err) }
+    res, err := MigrateTasks(opts)
+    if err != nil || len(res) != 1 || res[0].Skipped != "" { t.Fatalf("migrate: %+v %v", res, err) }
+    if !isDir(filepath.Join(to.Root, "tasks", "a")) { t.Fatal("task folder not copied") }
+    if got := historyIDs(t, toDB, to.PluginID); got != "z,y,a" { t.Fatalf("target history: %s", got) }
+}
+
+func TestServerLayout(t *testing.T) {
+    home := t.TempDir()
+    root := filepath.Join(home, ".cursor-server", "data", "User", "globalStorage", "kilocode.kilo-code")
+    writeTask(t, root, "r1", `[{"text":"remote","images":[]}]`)
+    cfg := config.Config{CodeChannel: "cursor-server", PluginID: "kilocode.kilo-code", RemoteHome: home}
+    got, err := ResolveStorageRoot(cfg)
+    if err != nil || got != root { t.Fatalf("ResolveStorageRoot = %q, %v; want %q", got, err, root) }
+    if DisplayEditorName(".cursor-server") != "cursor-server" { t.Fatalf("display name: %s", DisplayEditorName(".cursor-server")) }
+
+    srcs, err := DetectSources(config.Config{RemoteHome: home})
+    if err != nil { t.Fatal(err) }
+    found := false
+    for _, s := range srcs { if s.Label() == "cursor-server:kilocode.kilo-code" && s.Root == root { found = true } }
+    if !found { t.Fatalf("server source not detected: %v", srcs) }
+}
+
+func TestUserDataDir(t *testing.T) {
+    portable := t.TempDir()
+    if err := os.MkdirAll(filepath.Join(portable, "user-data", "User"), 0o755); err != nil { t.Fatal(err) }
+    root, err := ResolveStorageRoot(config.Config{CodeChannel: "Custom", PluginID: "p", UserDataDir: portable})
+    if want := filepath.Join(portable, "user-data", "User", "globalStorage", "p"); err != nil || root != want {
+        t.Fatalf("portable root = %q, %v; want %q", root, err, want)
+    }
+    udd := t.TempDir()
+    root, err = ResolveStorageRoot(config.Config{PluginID: "p", UserDataDir: udd})
+    if want := filepath.Join(udd, "User", "globalStorage", "p"); err != nil || root != want {
+        t.Fatalf("user-data-dir root = %q, %v; want %q", root, err, want)
+    }
+    dataDir := filepath.Join(udd, "User", "globalStorage", "p")
+    if got, err := editorUserDir(config.Config{CodeChannel: "Custom", DataDir: dataDir}); err != nil || got != filepath.Join(udd, "User") {
+        t.Fatalf("user dir from data-dir = %q, %v", got, err)
+    }
+    if _, err := editorUserDir(config.Config{CodeChannel: "Custom", DataDir: t.TempDir()}); err == nil {
+        t.Fatal("custom editor without a locatable user dir should fail")
+    }
+    if runtime.GOOS == "linux" {
+        xdg := t.TempDir()
+        t.Setenv("XDG_CONFIG_HOME", xdg)
+        root, _ = ResolveStorageRoot(config.Config{CodeChannel: "Cursor", PluginID: "p"})
+        if want := filepath.Join(xdg, "Cursor", "User", "globalStorage", "p"); root != want { t.Fatalf("XDG root = %q, want %q", root, want) }
+    }
+}
+
+func TestTailer(t *testing.T) {
+    root := t.TempDir()
+    dir := writeTask(t, root, "live", `[{"ts":1,"type":"say","say":"text","text":"do it","images":[]},{"ts":2,"type":"say","say":"api_req_started","text":"{\"request\":\"r1\"}"}]`)
+    tl := NewTailer(Task{ID: "live", Path: dir})
+    evs, err := tl.Poll()
+    if err != nil { t.Fatal(err) }
+    if len(evs) != 1 || evs[0].Kind != "user" { t.Fatalf("first poll = %+v; want the prompt only (request still unpriced)", evs) }
+
+    // Roo rewrites the whole array: request priced, a streaming text and a tool call added.
+    msgs := `[{"ts":1,"type":"say","say":"text","text":"do it","images":[]},` +
+        `{"ts":2,"type":"say","say":"api_req_started","text":"{\"request\":\"r1\",\"cost\":0.25,\"tokensIn\":10}"},` +
+        `{"ts":3,"type":"ask","ask":"tool","text":"{\"tool\":\"readFile\",\"path\":\"a.go\"}"},` +
+        `{"ts":4,"type":"say","say":"text","text":"partial","partial":true}]`
+    if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(msgs), 0o644); err != nil { t.Fatal(err) }
+    evs, _ = tl.Poll()
+    if len(evs) != 2 || evs[0].Kind != "api_req" || evs[0].TotalCost != 0.25 || evs[0].TokensIn != 10 || evs[1].Tool != "readFile" || evs[1].Text != "a.go" {
+        t.Fatalf("second poll = %+v", evs)
+    }
+
+    msgs = msgs[:len(msgs)-len(`,"partial":true}]`)] + `},{"ts":5,"type":"say","say":"api_req_started","text":"{\"request\":\"r2\",\"cost\":0.5}"},{"ts":6,"type":"say","say":"error","text":"boom"}]`
+    if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(msgs), 0o644); err != nil { t.Fatal(err) }
+    evs, _ = tl.Poll()
+    if len(evs) != 3 || evs[0].Text != "partial" || evs[1].TotalCost != 0.75 || evs[2].Kind != "error" {
+        t.Fatalf("third poll = %+v", evs)
+    }
+    if evs, _ := tl.Poll(); len(evs) != 0 { t.Fatalf("repeat poll = %+v", evs) }
+}
+
+func TestMetaCache(t *testing.T) {
+    saved := taskMeta
+    defer func() { taskMeta = saved }()
+    taskMeta = newMetaCache()
+
+    root := t.TempDir()
+    dir := writeTask(t, root, "c1", `[{"text":"one","images":[]}]`)
+    if list := BuildTasksFromDirs([]string{dir}); list[0].Title != "one" { t.Fatalf("title = %q", list[0].Title) }
+    if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(`[{"text":"second","images":[]}]`), 0o644); err != nil { t.Fatal(err) }
+    if list := BuildTasksFromDirs([]string{dir}); list[0].Title != "second" { t.Fatalf("stale title after rewrite: %q", list[0].Title) }
+    if PromptCorpus(Task{Path: dir}) != "second" { t.Fatal("corpus") }
+
+    path := filepath.Join(t.TempDir(), "meta.json")
+    if err := taskMeta.save(path); err != nil { t.Fatal(err) }
+    taskMeta = newMetaCache()
+    taskMeta.load(path, false)
+    // An unchanged directory is served from the loaded cache without re-reading it.
+    taskMeta.entries[dir].Summary = "from cache"
+    if list := BuildTasksFromDirs([]string{dir}); list[0].Title != "from cache" { t.Fatalf("cache not used: %q", list[0].Title) }
+
+    if err := os.RemoveAll(dir); err != nil { t.Fatal(err) }
+    taskMeta.dirty = true
+    if err := taskMeta.save(path); err != nil { t.Fatal(err) }
+    c := newMetaCache()
+    c.load(path, false)
+    if len(c.entries) != 0 { t.Fatalf("deleted task kept in cache: %v", c.entries) }
+}
+
+// benchTree writes n synthetic tasks with a few dozen messages each.
+func benchTree(b *testing.B, n int) []string {
+    root := b.TempDir()
+    var msgs strings.Builder
+    msgs.WriteString(`[{"ts":1700000000000,"type":"say","say":"text","text":"implement the feature","images":[]}`)
+    for i := 0; i < 40; i++ {
+        fmt.Fprintf(&msgs, `,{"ts":%d,"type":"say","say":"api_req_started","text":"{\"request\":\"%s\",\"cost\":0.01,\"tokensIn\":1000}"}`, 1700000000000+i, strings.Repeat("x", 400))
+        fmt.Fprintf(&msgs, `,{"ts":%d,"type":"say","say":"user_feedback","text":"feedback %d","images":[]}`, 1700000000500+i, i)
+    }
+    msgs.WriteString("]")
+    dirs := make([]string, n)
+    for i := range dirs {
+        dir := filepath.Join(root, "tasks", fmt.Sprintf("task-%04d", i))
+        if err := os.MkdirAll(filepath.Join(dir, "checkpoints"), 0o755); err != nil { b.Fatal(err) }
+        if err := os.WriteFile(filepath.Join(dir, "ui_messages.json"), []byte(msgs.String()), 0o644); err != nil { b.Fatal(err) }
+        if err := os.WriteFile(filepath.Join(dir, "api_conversation_history.json"), []byte(msgs.String()), 0o644); err != nil { b.Fatal(err) }
+        dirs[i] = dir
+    }
+    return dirs
+}
+
+// BenchmarkLoadTasks measures building the list plus what the TUI and `list` derive from
+// every task (stats, prompt corpus), cold and from a warm metadata cache.
+func BenchmarkLoadTasks(b *testing.B) {
+    saved := taskMeta
+    defer func() { taskMeta = saved }()
+    dirs := benchTree(b, 500)
+    load := func() {
+        for _, t := range BuildTasksFromDirs(dirs) {
+            _ = StatsFromTask(t)
+            _ = PromptCorpus(t)
+        }
+    }
+    b.Run("cold", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            taskMeta = newMetaCache()
+            load()
+        }
+    })
+    b.Run("warm", func(b *testing.B) {
+        taskMeta = newMetaCache()
+        load()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ { load() }
+    })
+    b.Run("disk", func(b *testing.B) {
+        path := filepath.Join(b.TempDir(), "meta.json")
+        taskMeta = newMetaCache()
+        load()
+        if err := taskMeta.save(path); err != nil { b.Fatal(err) }
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+            taskMeta = newMetaCache()
+            taskMeta.load(path, false)
+            load()
+        }
+    })
+}
+
+func TestMessageReader(t *testing.T) {
+    root := t.TempDir()
+    msgs := ` [ {"ts":1,"say":"text","text":"first \"quoted\" \\ end","images":["data:image/png;base64,AAAA\\\"]"]} ,
+        {"ts":2,"say":"api_req_started","text":"{\"request\":\"r\",\"costs\":1.5,\"tokenIn\":3}","images":null,"nested":{"a":[1,{"b":"}"}]}},
+        {"ts":3,"say":"user_feedback","text":"again","images":[],"partial":false},
+        {"ts":4,"say":"completion_result","text":"done"} ]`
+    dir := writeTask(t, root, "s1", msgs)
+    path := filepath.Join(dir, "ui_messages.json")
+
+    var first uiMessage
+    if err := FirstMessage(path, &first); err != nil { t.Fatal(err) }
+    if first.Text != `first "quoted" \ end` || first.Images == nil { t.Fatalf("first = %+v", first) }
+
+    last, err := LastMessages(path, 2)
+    if err != nil || len(last) != 2 || !strings.Contains(string(last[0]), `"ts":3`) || !strings.Contains(string(last[1]), `"ts":4`) {
+        t.Fatalf("last = %s, %v", last, err)
+    }
+    for _, n := range []int{0, -1} {
+        if last, err := LastMessages(path, n); err != nil || len(last) != 0 { t.Fatalf("LastMessages(%d) = %s, %v", n, last, err) }
+    }
+    if last := LastHistory(Task{Path: dir}, 2); len(last) != 2 || last[0].Role != "user" || last[0].Text != "again" || last[1].Role != "other" { t.Fatalf("LastHistory = %+v", last) }
+    if !strings.Contains(string(mustFirstRaw(t, path)), `"images":[]`) { t.Fatal("images payload not replaced") }
+
+    hist := LoadHistory(Task{Path: dir})
+    if len(hist) != 4 || hist[0].Role != "user" || hist[1].Role != "ai" || hist[2].Role != "user" || hist[3].Role != "other" {
+        t.Fatalf("history = %+v", hist)
+    }
+    if st := StatsFromTask(Task{Path: dir}); st.TotalCost != 1.5 || st.TokensIn != 3 { t.Fatalf("stats = %+v", st) }
+}
+
+func mustFirstRaw(t *testing.T, path string) []byte {
+    t.Helper()
+    m, err := OpenMessages(path)
+    if err != nil { t.Fatal(err) }
+    defer m.Close()
+    raw, err := m.NextRaw()
+    if err != nil { t.Fatal(err) }
+    return append([]byte(nil), raw...)
+}
+
+// Screenshots embedded in ui_messages.json must not be loaded when listing or opening a task.
+func TestMessagesSkipImagesWithoutLoading(t *testing.T) {
+    root := t.TempDir()
+    img := strings.Repeat("A", 16<<20)
+    dir := writeTask(t, root, "big", `[{"ts":1,"say":"text","text":"shot","images":["data:image/png;base64,`+img+`"]},{"ts":2,"say":"text","text":"ok"}]`)
+    img = ""
+    runtime.GC()
+    var before, after runtime.MemStats
+    runtime.ReadMemStats(&before)
+    if readSummary(dir) != "shot" { t.Fatal("summary") }
+    if h := LoadHistory(Task{Path: dir}); len(h) != 2 { t.Fatalf("history = %d items", len(h)) }
+    runtime.ReadMemStats(&after)
+    if n := after.TotalAlloc - before.TotalAlloc; n > 2<<20 { t.Fatalf("allocated %d bytes reading a task with a 16 MB image", n) }
+}
+
+// writeStateDB creates a state DB at path whose pluginID row holds the given taskHistory IDs.
+func writeStateDB(t *testing.T, path, pluginID string, ids ...string) {
+    t.Helper()
+    hist := make([]map[string]any, 0, len(ids))
+    for i, id := range ids { hist = append(hist, map[string]any{"id": id, "ts": i + 1, "task": id}) }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { t.Fatal(err) }
+    if err := mergeHistoryEntries(path, pluginID, hist); err != nil { t.Fatal(err) }
+}
+
+func historyIDs(t *testing.T, path, pluginID string) string {
+    t.Helper()
+    hist, err := readTaskHistoryFromDB(path, pluginID)
+    if err != nil { t.Fatal(err) }
+    var ids []string
+    for _, m := range hist { ids = append(ids, m["id"].(string)) }
+    return strings.Join(ids, ",")
+}
+
+func TestTrash(t *testing.T) {
+    user := t.TempDir()
+    root := filepath.Join(user, "User", "globalStorage", "p")
+    db := filepath.Join(user, "User", "globalStorage", "state.vscdb")
+    cfg := config.Config{CodeChannel: "Custom", PluginID: "p", DataDir: root, TrashDir: filepath.Join(user, "trash"), NoCache: true}
+    writeTask(t, root, "a", `[{"ts":1,"text":"first","images":[]}]`)
+    writeTask(t, root, "b", `[{"ts":2,"text":"second","images":[]}]`)
+    writeStateDB(t, db, "p", "a", "b", "c")
+    writeStateDB(t, db+".backup", "p", "a", "b", "c")
+
+    list, err := LoadTasks(cfg)
+    if err != nil || len(list) != 2 { t.Fatalf("load: %v %v", list, err) }
+    a, _ := ResolveRef(list, "a")
+    entries, err := TrashTasks(cfg, []Task{a})
+    if err != nil || len(entries) != 1 { t.Fatalf("trash: %v %v", entries, err) }
+    if isDir(a.Path) { t.Fatal("task folder still in place") }
+    for _, p := range []string{db, db + ".backup"} {
+        if got := historyIDs(t, p, "p"); got != "b,c" { t.Fatalf("%s history after trash: %s", p, got) }
+    }
+    if baks, _, err := ListBackups(cfg); err != nil || len(baks) != 1 || baks[0].Meta == nil || baks[0].Meta.Reason != "delete" || strings.Join(baks[0].Meta.TaskIDs, ",") != "a" {
+        t.Fatalf("expected a state DB backup with metadata, got %+v %v", baks, err)
+    }
+
+    trash, err := ListTrash(cfg)
+    if err != nil || len(trash) != 1 || trash[0].ID != "a" || trash[0].History["task"] != "a" || trash[0].OrigPath != a.Path {
+        t.Fatalf("list trash: %+v %v", trash, err)
+    }
+    if _, err := FindTrash(trash, []string{"zz"}); err == nil { t.Fatal("unknown ref should fail") }
+    got, err := FindTrash(trash, []string{"@latest"})
+    if err != nil || len(got) != 1 { t.Fatalf("find: %v %v", got, err) }
+    if err := RestoreTrash(cfg, got[0]); err != nil { t.Fatal(err) }
+    if !isDir(a.Path) { t.Fatal("task folder not restored") }
+    if got := historyIDs(t, db, "p"); got != "b,c,a" { t.Fatalf("history after restore: %s", got) } // appended, others untouched
+    if trash, _ := ListTrash(cfg); len(trash) != 0 { t.Fatalf("trash not emptied by restore: %v", trash) }
+
+    if _, err := TrashTasks(cfg, list); err != nil { t.Fatal(err) }
+    if purged, _ := EmptyTrash(cfg, time.Hour); len(purged) != 0 { t.Fatalf("fresh entries purged: %v", purged) }
+    if purged, _ := EmptyTrash(cfg, 0); len(purged) != 2 { t.Fatalf("empty: %v", purged) }
+    if got := historyIDs(t, db, "p"); got != "c" { t.Fatalf("history after trashing all: %s", got) }
+
+    writeTask(t, root, "c", `[{"ts":3,"text":"third","images":[]}]`)
+    list, _ = LoadTasks(cfg)
+    if err := PurgeTasks(cfg, list); err != nil { t.Fatal(err) }
+    if isDir(filepath.Join(root, "tasks", "c")) || historyIDs(t, db, "p") != "" { t.Fatal("purge left the task behind") }
+}
+
+func TestPlanPrune(t *testing.T) {
+    var list []Task
+    for i, id := range []string{"w1-new", "w1-mid", "w1-old", "w2-old", "fav-old"} {
+        list = append(list, Task{ID: id, Path: t.TempDir(), CreatedAt: time.Now().Add(-time.Duration(i) * 40 * 24 * time.Hour)}) // 0, 40, …, 160 days ago
+    }
+    hist := map[string]map[string]any{
+        "w1-new": {"workspace": "/w1"}, "w1-mid": {"workspace": "/w1"}, "w1-old": {"workspace": "/w1"},
+        "w2-old": {"workspace": "/w2"}, "fav-old": {"workspace": "/w2", "isFavorited": true},
+    }
+    rows := NewRows(list, hist)
+    rules := []config.PruneRule{
+        {Name: "old", Where: "age>100d"},
+        {KeepPerWorkspace: 1, Archive: true},
+    }
+    cands, err := PlanPrune(rows, rules)
+    if err != nil { t.Fatal(err) }
+    got := []string{}
+    for _, c := range cands { got = append(got, fmt.Sprintf("%s:%s:%v", c.ID, strings.Join(c.Rules, "+"), c.Archive)) }
+    want := "w1-mid:beyond 1 per workspace:true,w1-old:beyond 1 per workspace:true,w2-old:old:false"
+    if strings.Join(got, ",") != want { t.Fatalf("plan:\n got %s\nwant %s", strings.Join(got, ","), want) }
+
+    if _, err := PlanPrune(rows, []config.PruneRule{{Name: "all"}}); err == nil { t.Fatal("a rule without conditions must be rejected") }
+    if _, err := PlanPrune(rows, []config.PruneRule{{Where: "bogus>1"}}); err == nil { t.Fatal("invalid where must be rejected") }
+}
+
+func TestDiskUsageAndCompact(t *testing.T) {
+    root := t.TempDir()
+    png := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+    url := "data:image/png;base64," + png
+    dir := writeTask(t, root, "img", `[{"ts":1,"type":"say","say":"text","text":"look <here>","images":["`+url+`","`+url+`"]},{"ts":2,"type":"say","say":"text","text":"plain"}]`)
+    api := `[{"role":"user","content":[{"type":"text","text":"look"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + png + `"}}]},` +
+        `{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + png + `"}}]}]}]`
+    if err := os.WriteFile(filepath.Join(dir, "api_conversation_history.json"), []byte(api), 0o644); err != nil { t.Fatal(err) }
+    if err := os.MkdirAll(filepath.Join(dir, "checkpoints"), 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(dir, "checkpoints", "blob"), make([]byte, 100), 0o644); err != nil { t.Fatal(err) }
+
+    u := readDiskUsage(dir)
+    if u.Images != int64(4*len(url)-2*len("data:image/png;base64,")) || u.Checkpoints != 100 || u.Other != 0 || u.Total() != dirSize(dir) {
+        t.Fatalf("usage: %+v (dir %d)", u, dirSize(dir))
+    }
+    // A new checkpoint commit leaves the conversation files alone but must not be missed.
+    if got := TaskDiskUsage(Task{Path: dir}); got != u { t.Fatalf("cached usage: %+v", got) }
+    StatsFromTask(Task{Path: dir})
+    if err := os.WriteFile(filepath.Join(dir, "checkpoints", "blob2"), make([]byte, 50), 0o644); err != nil { t.Fatal(err) }
+    if got := TaskDiskUsage(Task{Path: dir}); got.Checkpoints != 150 { t.Fatalf("usage after checkpoint: %+v", got) }
+    if got := StatsFromTask(Task{Path: dir}).SizeBytes; got != dirSize(dir) || got != TaskDiskUsage(Task{Path: dir}).Total() { t.Fatalf("size %d, dir %d", got, dirSize(dir)) }
+    for _, q := range []string{"checkpoints_size>=150", "ckpt>100 and images_size>0", "images>0"} {
+        pq, err := ParseQuery(q)
+        if err != nil || !pq.Match(NewRows([]Task{{Path: dir}}, nil)[0]) { t.Fatalf("%s: %v", q, err) }
+    }
+
+    dry, err := CompactTask(Task{ID: "img", Path: dir}, CompactOptions{DryRun: true, NoGC: true})
+    if err != nil || dry.Images != 4 || dry.After != dry.Before { t.Fatalf("dry run: %+v %v", dry, err) }
+    res, err := CompactTask(Task{ID: "img", Path: dir}, CompactOptions{NoGC: true})
+    if err != nil || res.Images != 4 || res.Files != 1 || res.After >= res.Before { t.Fatalf("compact: %+v %v", res, err) }
+
+    ui, _ := os.ReadFile(filepath.Join(dir, "ui_messages.json"))
+    if strings.Contains(string(ui), "base64") || !strings.Contains(string(ui), `"images":[]`) || !strings.Contains(string(ui), "look <here>") || !strings.Contains(string(ui), `"text":"plain"`) {
+        t.Fatalf("ui_messages after compact: %s", ui)
+    }
+    hist, _ := os.ReadFile(filepath.Join(dir, "api_conversation_history.json"))
+    if strings.Contains(string(hist), "base64") || strings.Count(string(hist), "compacted-images/") != 2 || !strings.Contains(string(hist), `"tool_use_id":"t1"`) {
+        t.Fatalf("api history after compact: %s", hist)
+    }
+    files, _ := filepath.Glob(filepath.Join(dir, compactedImagesDir, "*.png"))
+    if len(files) != 1 { t.Fatalf("extracted images: %v", files) }
+    if got := LoadHistory(Task{ID: "img", Path: dir}); len(got) == 0 { t.Fatal("task no longer loads") }
+    if u := readDiskUsage(dir); u.Images != fileSize(files[0])+fileSize(filepath.Join(dir, compactedImagesDir, "index.json")) {
+        t.Fatalf("usage after compact: %+v", u)
+    }
+
+    again, err := CompactTask(Task{ID: "img", Path: dir}, CompactOptions{NoGC: true})
+    if err != nil || again.Images != 0 || again.After != again.Before { t.Fatalf("second compact: %+v %v", again, err) }
+}
+
+func TestStateDBBackup(t *testing.T) {
+    dir := t.TempDir()
+    db := filepath.Join(dir, "state.vscdb")
+    writeStateDB(t, db, "p", "a")
+    // write through a connection that stays open, so the write stays in the write-ahead log
+    conn, err := sql.Open("sqlite", db)
+    if err != nil { t.Fatal(err) }
+    defer conn.Close()
+    conn.SetMaxOpenConns(1)
+    if _, err := conn.Exec("PRAGMA wal_autocheckpoint=0"); err != nil { t.Fatal(err) }
+    if _, err := conn.Exec(`UPDATE ItemTable SET value = ? WHERE key = ?`, `{"taskHistory":[{"id":"a","ts":1},{"id":"b","ts":2}]}`, "p"); err != nil { t.Fatal(err) }
+    if fileSize(db+"-wal") <= 0 { t.Fatal("expected the write to be in the WAL") }
+
+    if err := backupStateDB(db, "x", "import", []string{"b"}); err != nil { t.Fatal(err) }
+    if got := historyIDs(t, db+".bak-x", "p"); got != "a,b" { t.Fatalf("backup misses the WAL write: %s", got) }
+    if m := readBackupMeta(db + ".bak-x"); m == nil || m.Reason != "import" || m.Integrity != "ok" || len(m.TaskIDs) != 1 { t.Fatalf("meta: %+v", m) }
+    if err := backupStateDB(db, "x", "delete", nil); err == nil { t.Fatal("an existing backup must not be replaced") }
+    if m := readBackupMeta(db + ".bak-x"); m == nil || m.Reason != "import" { t.Fatalf("meta replaced: %+v", m) }
+
+    // Writes within one second get distinct suffixes; a backup of the .backup twin counts.
+    s1 := backupSuffix(db)
+    if err := backupStateDB(db, s1, "import", nil); err != nil { t.Fatal(err) }
+    s2 := backupSuffix(db)
+    if s2 == s1 { t.Fatalf("suffix %s reused", s1) }
+    if err := os.WriteFile(db+".backup.bak-"+s2, nil, 0o600); err != nil { t.Fatal(err) }
+    if s3 := backupSuffix(db); s3 == s2 || s3 == s1 { t.Fatalf("suffix %s reused", s3) }
+    if err := backupStateDB(db, s2, "import", nil); err != nil { t.Fatal(err) }
+    if err := DeleteBackup(BackupInfo{Path: db + ".bak-" + s1, Suffix: s1}); err != nil { t.Fatal(err) }
+    if fileSize(db+".bak-"+s1) >= 0 || fileSize(db+".bak-"+s2) < 0 || fileSize(db+".backup.bak-"+s2) < 0 { t.Fatal("DeleteBackup removed the wrong backups") }
+
+    junk := filepath.Join(dir, "junk.vscdb")
+    if err := os.WriteFile(junk, []byte("not a database, just some bytes long enough to look like a header"), 0o644); err != nil { t.Fatal(err) }
+    if err := backupStateDB(junk, "x", "import", nil); err == nil { t.Fatal("backing up a non-SQLite file should fail") }
+    if fileSize(junk+".bak-x") >= 0 { t.Fatal("failed backup left a file behind") }
+
+    writeStateDB(t, db, "p", "c")
+    if err := replaceSQLite(db+".bak-x", db); err != nil { t.Fatal(err) }
+    if got := historyIDs(t, db, "p"); got != "a,b" { t.Fatalf("after replace: %s", got) }
+}
+
+func TestBackupDiff(t *testing.T) {
+    user := t.TempDir()
+    root := filepath.Join(user, "User", "globalStorage", "p")
+    db := filepath.Join(user, "User", "globalStorage", "state.vscdb")
+    cfg := config.Config{CodeChannel: "Custom", PluginID: "p", DataDir: root, NoCache: true}
+    writeTask(t, root, "a", `[{"ts":1,"text":"first","images":[]}]`)
+    writeStateDB(t, db, "p", "a", "b")
+    setKey := func(k, v string) {
+        conn, err := sql.Open("sqlite", db)
+        if err != nil { t.Fatal(err) }
+        defer conn.Close()
+        if _, err := conn.Exec("INSERT INTO ItemTable(key, value) VALUES(?, ?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", k, v); err != nil { t.Fatal(err) }
+    }
+    setKey("k1", "one")
+    if err := backupStateDB(db, "s1", "test", nil); err != nil { t.Fatal(err) }
+
+    if err := removeHistoryEntries(db, "p", []string{"a"}); err != nil { t.Fatal(err) }
+    if err := mergeHistoryEntries(db, "p", []map[string]any{{"id": "b", "ts": 2, "task": "b", "workspace": "/w"}, {"id": "c", "ts": 3, "task": "c"}}); err != nil { t.Fatal(err) }
+    setKey("k1", "two")
+    setKey("k2", "new")
+
+    baks, _, err := ListBackups(cfg)
+    if err != nil || len(baks) != 1 { t.Fatalf("backups: %v %v", baks, err) }
+    d, err := DiffBackup(cfg, baks[0])
+    if err != nil { t.Fatal(err) }
+    var got []string
+    for _, c := range d.History { got = append(got, fmt.Sprintf("%s:%s:%v:%s", c.Kind, c.ID, c.Folder, strings.Join(c.Fields, "+"))) }
+    if strings.Join(got, " ") != "removed:a:true: changed:b:false:workspace added:c:false:" { t.Fatalf("history diff: %v", got) }
+    if d.History[1].Workspace != [2]string{"", "/w"} || d.History[2].Restorable() { t.Fatalf("changes: %+v", d.History) }
+    got = nil
+    for _, k := range d.Keys { got = append(got, k.Kind+":"+k.Key) }
+    if strings.Join(got, " ") != "changed:k1 added:k2" { t.Fatalf("key diff: %v", got) }
+
+    if err := RestoreBackupEntries(cfg, "s1", []string{"a", "c"}); err == nil { t.Fatal("c is not in the backup") }
+    if err := RestoreBackupEntries(cfg, "s1", []string{"a"}); err != nil { t.Fatal(err) }
+    if got := historyIDs(t, db, "p"); got != "b,c,a" { t.Fatalf("after merging a back: %s", got) }
+
+    baks, _, _ = ListBackups(cfg)
+    if len(baks) != 2 { t.Fatalf("merging should back up first: %v", baks) }
+    dropped, err := PruneBackups(cfg, 1)
+    if err != nil || len(dropped) != 1 || dropped[0].Suffix != "s1" { t.Fatalf("prune: %v %v", dropped, err) }
+    if fileSize(db+".bak-s1.json") >= 0 { t.Fatal("metadata of a pruned backup left behind") }
+
+    // both DBs are backed up before either is written: a .backup that cannot be backed
+    // up leaves state.vscdb alone
+    if err := backupStateDB(db, "s2", "test", nil); err != nil { t.Fatal(err) }
+    if err := removeHistoryEntries(db, "p", []string{"a"}); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(db+".backup", []byte("not a database"), 0o644); err != nil { t.Fatal(err) }
+    if err := RestoreBackupEntries(cfg, "s2", []string{"a"}); err == nil || !strings.Contains(err.Error(), "nothing was changed") { t.Fatalf("expected a backup error, got %v", err) }
+    if got := historyIDs(t, db, "p"); got != "b,c" { t.Fatalf("state.vscdb written although .backup was not backed up: %s", got) }
+}
+
+func TestDetectEditor(t *testing.T) {
+    defer func(f func() ([]EditorProcess, error)) { listProcesses = f }(listProcesses)
+    listProcesses = func() ([]EditorProcess, error) {
+        return []EditorProcess{
+            {PID: 10, Path: "/Applications/Cursor.app/Contents/MacOS/Cursor"},
+            {PID: 11, Path: "/usr/share/code/code"},
+            {PID: 12, Path: "Cursor.exe"},
+            {PID: 13, Path: "/usr/bin/cursorless"},
+            {PID: 14, Path: "/home/u/.cursor-server/bin/abc/node"},
+        }, nil
+    }
+    pids := func(cfg config.Config) string {
+        st, err := DetectEditor(cfg)
+        if err != nil { t.Fatal(err) }
+        var out []string
+        for _, p := range st.Processes { out = append(out, fmt.Sprint(p.PID)) }
+        return strings.Join(out, ",")
+    }
+    if got := pids(config.Config{CodeChannel: "Cursor"}); got != "10,12" { t.Fatalf("cursor: %s", got) }
+    if got := pids(config.Config{CodeChannel: "Code"}); got != "11" { t.Fatalf("code: %s", got) }
+    if got := pids(config.Config{CodeChannel: "cursor-server"}); got != "14" { t.Fatalf("cursor-server: %s", got) }
+    if got := pids(config.Config{CodeChannel: "cursor-server", RemoteHome: t.TempDir()}); got != "" { t.Fatalf("remote server: %s", got) }
+
+    user := t.TempDir()
+    root := filepath.Join(user, "User", "globalStorage", "p")
+    db := filepath.Join(user, "User", "globalStorage", "state.vscdb")
+    cfg := config.Config{CodeChannel: "Custom", PluginID: "p", DataDir: root, TrashDir: filepath.Join(user, "trash"), NoCache: true}
+    a := writeTask(t, root, "a", `[{"ts":1,"text":"first","images":[]}]`)
+    writeStateDB(t, db, "p", "a")
+    if err := CheckEditorClosed(cfg); err != nil { t.Fatalf("idle DB reported busy: %v", err) }
+    if fileSize(db+"-wal") >= 0 { t.Fatal("the probe left a -wal file behind") }
+
+    // another process in the middle of a write
+    conn, err := sql.Open("sqlite", db)
+    if err != nil { t.Fatal(err) }
+    defer conn.Close()
+    conn.SetMaxOpenConns(1)
+    if _, err := conn.Exec("BEGIN IMMEDIATE"); err != nil { t.Fatal(err) }
+    var running *EditorRunningError
+    if err := CheckEditorClosed(cfg); !errors.As(err, &running) || !running.Status.Locked { t.Fatalf("locked DB: %v", err) }
+    list, _ := LoadTasks(cfg)
+    if _, err := TrashTasks(cfg, list); !errors.As(err, &running) || !isDir(a) { t.Fatalf("trash while locked: %v", err) }
+    forced := cfg
+    forced.Force = true
+    if err := CheckEditorClosed(forced); err != nil { t.Fatalf("--force: %v", err) }
+
+    // committed, but still open with the write in its -wal file
+    if _, err := conn.Exec("INSERT INTO ItemTable (key, value) VALUES ('other', 'x')"); err != nil { t.Fatal(err) }
+    if _, err := conn.Exec("COMMIT"); err != nil { t.Fatal(err) }
+    if err := CheckEditorClosed(cfg); !errors.As(err, &running) || running.Status.Locked || !running.Status.WAL { t.Fatalf("open DB: %v", err) }
+    conn.Close()
+    if err := CheckEditorClosed(cfg); err != nil { t.Fatalf("closed DB: %v", err) }
+}
+
+func TestBackupSnapshots(t *testing.T) {
+    user := t.TempDir()
+    root := filepath.Join(user, "User", "globalStorage", "p")
+    db := filepath.Join(user, "User", "globalStorage", "state.vscdb")
+    cfg := config.Config{CodeChannel: "Custom", PluginID: "p", DataDir: root, BackupDir: filepath.Join(user, "backups"), NoCache: true}
+    a := writeTask(t, root, "a", `[{"ts":1,"text":"first","images":[]}]`)
+    writeTask(t, root, "b", `[{"ts":2,"text":"second","images":[]}]`)
+    writeStateDB(t, db, "p", "a", "b")
+
+    first, st, err := CreateSnapshot(cfg, "")
+    if err != nil || first.TaskCount() != 2 || st.Files != 3 || st.NewFiles != 3 { t.Fatalf("first snapshot: %+v %+v %v", first, st, err) }
+    second, st, err := CreateSnapshot(cfg, "")
+    if err != nil || st.NewFiles != 0 || second.Name == first.Name { t.Fatalf("second snapshot should reuse every object: %+v %+v %v", second, st, err) }
+
+    // lose b entirely and change a
+    list, _ := LoadTasks(cfg)
+    b, _ := ResolveRef(list, "b")
+    if err := PurgeTasks(cfg, []Task{b}); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(a, "ui_messages.json"), []byte(`[{"ts":1,"text":"changed","images":[]}]`), 0o644); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(filepath.Join(a, "extra.txt"), []byte("x"), 0o644); err != nil { t.Fatal(err) }
+
+    picks, err := first.Picks([]string{"b", "a"})
+    if err != nil || len(picks) != 2 { t.Fatalf("picks: %v %v", picks, err) }
+    if _, err := first.Picks([]string{"zz"}); err == nil { t.Fatal("unknown task should fail") }
+    if p, err := first.Picks([]string{"@latest", "seco", "@2"}); err != nil || len(p) != 3 || p[0].ID != "b" || p[1].ID != "b" || p[2].ID != "a" { t.Fatalf("picks by age and title: %v %v", p, err) }
+    var amb *AmbiguousError
+    if _, err := first.Picks([]string{"s"}); !errors.As(err, &amb) || len(amb.Candidates) != 2 { t.Fatalf("ambiguous title: %v", err) }
+    if err := RestoreSnapshotTasks(cfg, first, picks); err != nil { t.Fatal(err) }
+    if got := historyIDs(t, db, "p"); got != "a,b" { t.Fatalf("history after restore: %s", got) }
+    if !isDir(filepath.Join(root, "tasks", "b")) { t.Fatal("b not restored") }
+    if got, _ := os.ReadFile(filepath.Join(a, "ui_messages.json")); !strings.Contains(string(got), "first") { t.Fatalf("a not restored: %s", got) }
+    if fileSize(filepath.Join(a, "extra.txt")) >= 0 { t.Fatal("file added after the snapshot was kept") }
+
+    snaps, err := ListSnapshots(cfg)
+    if err != nil || len(snaps) != 2 { t.Fatalf("list: %v %v", snaps, err) }
+    if s, err := FindSnapshot(snaps, "@latest"); err != nil || s.Name != second.Name { t.Fatalf("@latest: %v %v", s.Name, err) }
+    dropped, _, err := PruneSnapshots(cfg, config.BackupKeep{Last: 1})
+    if err != nil || len(dropped) != 1 || dropped[0].Name != first.Name { t.Fatalf("prune: %v %v", dropped, err) }
+    for _, src := range second.Sources {
+        for _, task := range src.Tasks {
+            for _, f := range task.Files {
+                if fileSize(objectPath(cfg.BackupDir, f.Hash)) != f.Size { t.Fatalf("object of %s/%s collected", task.ID, f.Path) }
+            }
+        }
+    }
+}
+
+func TestKeepSnapshots(t *testing.T) {
+    now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.Local)
+    var list []Snapshot
+    for h := 0; h < 24*90; h += 6 { list = append(list, Snapshot{Name: fmt.Sprint(h), CreatedAt: now.Add(-time.Duration(h) * time.Hour)}) }
+    kept, dropped := KeepSnapshots(list, config.BackupKeep{Last: 2, Daily: 7})
+    if len(kept) != 8 || len(kept)+len(dropped) != len(list) { t.Fatalf("last 2 + 7 daily: kept %d", len(kept)) }
+    kept, _ = KeepSnapshots(list, config.BackupKeep{Monthly: 12})
+    if len(kept) != 4 { t.Fatalf("monthly over 90 days: kept %d", len(kept)) } // March, February, January, December
+    kept, _ = KeepSnapshots(list, config.BackupKeep{})
+    if len(kept) != 1 || kept[0].Name != "0" { t.Fatalf("the newest snapshot is always kept: %v", kept) }
+}
+
+func TestStateKeys(t *testing.T) {
+    user := t.TempDir()
+    root := filepath.Join(user, "User", "globalStorage", "pub.ext")
+    db := filepath.Join(user, "User", "globalStorage", "state.vscdb")
+    cfg := config.Config{CodeChannel: "Custom", PluginID: "pub.ext", DataDir: root, NoCache: true}
+    writeStateDB(t, db, "pub.ext", "a")
+    values := map[string]json.RawMessage{
+        "customModes":       json.RawMessage(`[{"slug":"review","name":"Review"}]`),
+        "listApiConfigMeta": json.RawMessage(`[{"name":"default","apiProvider":"openai","openAiApiKey":"sk-abc"}]`),
+    }
+    if err := writeStateKeys(db, "pub.ext", values); err != nil { t.Fatal(err) }
+    if err := writeStateKeys(db, "pub.ext", map[string]json.RawMessage{"secret://{\"extensionId\":\"pub.ext\",\"key\":\"k\"}": json.RawMessage(`"enc"`), "other": json.RawMessage(`1`)}); err != nil { t.Fatal(err) }
+
+    keys, err := ListStateKeys(cfg)
+    if err != nil { t.Fatal(err) }
+    var got []string
+    for _, k := range keys { got = append(got, fmt.Sprintf("%s:%s:%v", k.Name, k.Kind, k.Secret)) }
+    if strings.Join(got, " ") != `customModes:array:false listApiConfigMeta:array:false other:number:false secret://{"extensionId":"pub.ext","key":"k"}:secret:true taskHistory:array:false` {
+        t.Fatalf("keys: %v", got)
+    }
+    masked, n := MaskSecrets(values["listApiConfigMeta"])
+    if n != 1 || strings.Contains(string(masked), "sk-abc") || !strings.Contains(string(masked), MaskedValue) { t.Fatalf("masked %d: %s", n, masked) }
+
+    // Exports skip taskHistory and secrets and mask credentials.
+    exp, err := ExportStateKeys(cfg, nil, false)
+    if err != nil { t.Fatal(err) }
+    if len(exp.Keys) != 3 || exp.Keys["taskHistory"] != nil || exp.Masked != 1 { t.Fatalf("export: %+v", exp) }
+    if _, err := ExportStateKeys(cfg, []string{`secret://{"extensionId":"pub.ext","key":"k"}`}, true); err == nil { t.Fatal("exported a secret") }
+    path := filepath.Join(user, "state.json")
+    if err := WriteStateExport(path, exp); err != nil { t.Fatal(err) }
+    exp, err = ReadStateExport(path)
+    if err != nil { t.Fatal(err) }
+
+    // Importing into another machine's DB: the masked key is kept from the target.
+    other := filepath.Join(user, "other", "User", "globalStorage", "state.vscdb")
+    ocfg := config.Config{CodeChannel: "Custom", PluginID: "pub.ext", DataDir: filepath.Join(filepath.Dir(other), "pub.ext"), NoCache: true}
+    writeStateDB(t, other, "pub.ext", "x")
+    if _, err := ImportStateKeys(ocfg, exp, []string{"listApiConfigMeta"}, true); err == nil || !strings.Contains(err.Error(), "--reveal") { t.Fatalf("want masked value error, got %v", err) }
+    // Another profile's key is never reused, whatever its position.
+    if err := writeStateKeys(other, "pub.ext", map[string]json.RawMessage{"listApiConfigMeta": json.RawMessage(`[{"name":"old","openAiApiKey":"sk-old"}]`)}); err != nil { t.Fatal(err) }
+    if _, err := ImportStateKeys(ocfg, exp, []string{"listApiConfigMeta"}, true); err == nil || !strings.Contains(err.Error(), "--reveal") { t.Fatalf("want masked value error, got %v", err) }
+    if err := writeStateKeys(other, "pub.ext", map[string]json.RawMessage{"listApiConfigMeta": json.RawMessage(`[{"name":"old","openAiApiKey":"sk-old"},{"name":"default","openAiApiKey":"sk-mine"}]`)}); err != nil { t.Fatal(err) }
+    plan, err := ImportStateKeys(ocfg, exp, nil, false)
+    if err != nil { t.Fatal(err) }
+    got = nil
+    for _, c := range plan { got = append(got, c.Kind+":"+c.Name) }
+    if strings.Join(got, " ") != "added:customModes changed:listApiConfigMeta added:other" { t.Fatalf("plan: %v", got) }
+    okeys, _ := ListStateKeys(ocfg)
+    k, _ := FindStateKey(okeys, "listApiConfigMeta")
+    if !jsonEqual(k.Value, json.RawMessage(`[{"name":"default","apiProvider":"openai","openAiApiKey":"sk-mine"}]`)) { t.Fatalf("imported: %s", k.Value) }
+    if historyIDs(t, other, "pub.ext") != "x" { t.Fatal("taskHistory changed") }
+    baks, _, err := ListBackups(ocfg)
+    if err != nil || len(baks) != 1 || baks[0].Meta == nil || !strings.HasPrefix(baks[0].Meta.Reason, "state import") { t.Fatalf("backups: %+v %v", baks, err) }
+    if plan, _ := ImportStateKeys(ocfg, exp, nil, true); plan[0].Kind != "same" { t.Fatalf("re-import: %v", plan) }
+}
@@ -0,0 +1,341 @@
+package tasks
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "roocode-task-man/internal/config"
+)
+
+// DefaultTrashRetention is how long trashed tasks are kept when the config does not say.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashEntry is one deleted task. Its folder is moved to <trash>/<Name>/task and the
+// rest of this struct is stored next to it in trash.json.
+type TrashEntry struct {
+    Name      string         `json:"-"` // folder name under the trash directory
+    ID        string         `json:"id"`
+    Title     string         `json:"title"`
+    Source    Source         `json:"source"`   // editor/extension the task was deleted from
+    OrigPath  string         `json:"origPath"` // where the task folder is restored to
+    DeletedAt time.Time      `json:"deletedAt"`
+    Size      int64          `json:"size"`
+    History   map[string]any `json:"history,omitempty"` // taskHistory entry removed from state.vscdb
+}
+
+// Dir is the entry's folder in the trash.
+func (e TrashEntry) Dir(cfg config.Config) string { return filepath.Join(TrashDir(cfg), e.Name) }
+
+// TrashDir is where deleted tasks are kept: cfg.TrashDir, or ~/.config/roo-code-man/trash.
+func TrashDir(cfg config.Config) string {
+    if cfg.TrashDir != "" { return cfg.TrashDir }
+    return filepath.Join(config.UserHome(), ".config", "roo-code-man", "trash")
+}
+
+// TrashRetention is how long trashed tasks are kept before PruneTrash removes them;
+// zero means forever (a negative trashRetentionDays in the config).
+func TrashRetention(cfg config.Config) time.Duration {
+    switch {
+    case cfg.TrashRetentionDays < 0:
+        return 0
+    case cfg.TrashRetentionDays == 0:
+        return DefaultTrashRetention
+    }
+    return time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+}
+
+// stateConfig narrows base to s, locating its state DB from the storage root.
+func (s Source) stateConfig(base config.Config) config.Config {
+    c := s.Config(base)
+    c.DataDir = s.Root
+    return c
+}
+
+// taskSources pairs each task with the source it was loaded from.
+func taskSources(cfg config.Config, ts []Task) (map[string]Source, error) {
+    srcs, err := selectedSources(cfg)
+    if err != nil { return nil, err }
+    if len(srcs) == 0 { return nil, errors.New("no task sources") }
+    out := map[string]Source{}
+    for _, t := range ts {
+        s := srcs[0]
+        if t.Source != "" {
+            found := false
+            for _, c := range srcs {
+                if c.Label() == t.Source { s, found = c, true; break }
+            }
+            if !found { return nil, fmt.Errorf("%s: unknown source %s", t.ID, t.Source) }
+        }
+        out[HistoryKey(t)] = s
+    }
+    return out, nil
+}
+
+// TrashTasks moves the tasks' folders to the trash and removes their taskHistory entries
+// from the state DB (and its .backup, both backed up first), recording everything
+// needed to restore them. Entries older than the retention are pruned afterwards.
+func TrashTasks(cfg config.Config, ts []Task) ([]TrashEntry, error) {
+    return removeTasks(cfg, ts, true)
+}
+
+// PurgeTasks deletes the tasks' folders for good and removes their taskHistory entries.
+func PurgeTasks(cfg config.Config, ts []Task) error {
+    _, err := removeTasks(cfg, ts, false)
+    return err
+}
+
+func removeTasks(cfg config.Config, ts []Task, trash bool) ([]TrashEntry, error) {
+    bySource, err := taskSources(cfg, ts)
+    if err != nil { return nil, err }
+    checked := map[string]bool{}
+    for _, s := range bySource {
+        if checked[s.Label()] { continue }
+        checked[s.Label()] = true
+        if err := CheckEditorClosed(s.stateConfig(cfg)); err != nil { return nil, err }
+    }
+    histories := map[string]map[string]map[string]any{} // source label -> id -> entry
+    var entries []TrashEntry
+    removed := map[string][]string{} // source label -> ids
+    sources := map[string]Source{}
+    now := time.Now()
+    var failed error
+    for _, t := range ts {
+        s := bySource[HistoryKey(t)]
+        if _, ok := histories[s.Label()]; !ok { histories[s.Label()] = sourceHistoryByID(cfg, s) }
+        if trash {
+            e := TrashEntry{ID: t.ID, Title: t.Title, Source: s, OrigPath: t.Path, DeletedAt: now, History: histories[s.Label()][t.ID]}
+            e.Size = StatsFromTask(t).SizeBytes
+            if err := moveToTrash(cfg, &e); err != nil { failed = fmt.Errorf("trash %s: %w", t.ID, err); break }
+            entries = append(entries, e)
+        } else if err := os.RemoveAll(t.Path); err != nil {
+            failed = fmt.Errorf("delete %s: %w", t.ID, err)
+            break
+        }
+        if _, ok := histories[s.Label()][t.ID]; ok {
+            removed[s.Label()] = append(removed[s.Label()], t.ID)
+            sources[s.Label()] = s
+        }
+    }
+    // unregister whatever was removed, even when a later task failed
+    for label, ids := range removed {
+        if err := dropHistoryEntries(sources[label].stateConfig(cfg), ids); err != nil && failed == nil {
+            failed = fmt.Errorf("unregister from %s: %w", label, err)
+        }
+    }
+    if trash && failed == nil {
+        if _, err := PruneTrash(cfg); err != nil && cfg.Debug { log.Printf("[trash] prune: %v", err) }
+    }
+    return entries, failed
+}
+
+// sourceHistoryByID reads s's taskHistory keyed by task ID; empty when there is no state DB.
+func sourceHistoryByID(cfg config.Config, s Source) map[string]map[string]any {
+    out := map[string]map[string]any{}
+    dbPath, err := detectStateDBPath(s.stateConfig(cfg))
+    if err != nil {
+        if cfg.Debug { log.Printf("[trash] %s: %v", s.Label(), err) }
+        return out
+    }
+    hist, err := readTaskHistoryFromDB(dbPath, s.PluginID)
+    if err != nil {
+        if cfg.Debug { log.Printf("[trash] %s: %v", s.Label(), err) }
+        return out
+    }
+    for _, m := range hist {
+        if id, _ := m["id"].(string); id != "" { out[id] = m }
+    }
+    return out
+}
+
+// moveToTrash moves e's task folder into a fresh trash folder and writes the sidecar.
+func moveToTrash(cfg config.Config, e *TrashEntry) error {
+    root := TrashDir(cfg)
+    if err := os.MkdirAll(root, 0o755); err != nil { return err }
+    base := e.DeletedAt.Format("20060102-150405") + "-" + e.ID
+    e.Name = base
+    for n := 2; ; n++ {
+        if _, err := os.Stat(filepath.Join(root, e.Name)); os.IsNotExist(err) { break }
+        e.Name = fmt.Sprintf("%s-%d", base, n)
+    }
+    dir := e.Dir(cfg)
+    if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+    if err := writeTrashSidecar(dir, *e); err != nil { os.RemoveAll(dir); return err }
+    if err := moveDir(e.OrigPath, filepath.Join(dir, "task")); err != nil { os.RemoveAll(dir); return err }
+    return nil
+}
+
+func writeTrashSidecar(dir string, e TrashEntry) error {
+    b, err := json.MarshalIndent(e, "", "  ")
+    if err != nil { return err }
+    return os.WriteFile(filepath.Join(dir, "trash.json"), b, 0o644)
+}
+
+// moveDir renames src to dst, copying across filesystems when a rename is not possible.
+func moveDir(src, dst string) error {
+    if err := os.Rename(src, dst); err == nil { return nil }
+    if err := copyDir(src, dst); err != nil { os.RemoveAll(dst); return err }
+    return os.RemoveAll(src)
+}
+
+// dropHistoryEntries removes ids from the taskHistory of cfg's state DB and its .backup,
+// backing both up first.
+func dropHistoryEntries(cfg config.Config, ids []string) error {
+    dbPath, err := detectStateDBPath(cfg)
+    if err != nil { return err }
+    dbs := existingStateDBs(dbPath)
+    if err := backupStateDBs(dbs, "delete", ids); err != nil { return err }
+    for _, p := range dbs {
+        if err := removeHistoryEntries(p, cfg.PluginID, ids); err != nil { return fmt.Errorf("%s: %w", p, err) }
+    }
+    return nil
+}
+
+// removeHistoryEntries deletes the entries with the given ids from pluginID's taskHistory.
+func removeHistoryEntries(dbPath, pluginID string, ids []string) error {
+    db, err := sql.Open("sqlite", dbPath)
+    if err != nil { return err }
+    defer db.Close()
+    _, _ = db.Exec("PRAGMA busy_timeout=5000")
+    _, _ = db.Exec("PRAGMA journal_mode=WAL")
+    if _, err := db.Exec("BEGIN IMMEDIATE"); err != nil { return err }
+    defer db.Exec("ROLLBACK")
+
+    var raw []byte
+    err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", pluginID).Scan(&raw)
+    if err == sql.ErrNoRows { return nil } else if err != nil { return err }
+    var doc map[string]any
+    if err := json.Unmarshal(raw, &doc); err != nil { return fmt.Errorf("parse json: %w", err) }
+    drop := map[string]bool{}
+    for _, id := range ids { drop[id] = true }
+    hist, _ := doc["taskHistory"].([]any)
+    kept := make([]any, 0, len(hist))
+    for _, it := range hist {
+        if m, ok := it.(map[string]any); ok {
+            if id, _ := m["id"].(string); drop[id] { continue }
+        }
+        kept = append(kept, it)
+    }
+    if len(kept) == len(hist) { return nil }
+    doc["taskHistory"] = kept
+    b, err := json.Marshal(doc)
+    if err != nil { return err }
+    if _, err := db.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", b, pluginID); err != nil { return err }
+    if _, err := db.Exec("COMMIT"); err != nil { return err }
+    _, _ = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+    return nil
+}
+
+// ListTrash returns the trashed tasks, most recently deleted first. Folders without a
+// readable trash.json are skipped.
+func ListTrash(cfg config.Config) ([]TrashEntry, error) {
+    root := TrashDir(cfg)
+    dirs, err := os.ReadDir(root)
+    if os.IsNotExist(err) { return nil, nil }
+    if err != nil { return nil, err }
+    var out []TrashEntry
+    for _, d := range dirs {
+        if !d.IsDir() { continue }
+        b, err := os.ReadFile(filepath.Join(root, d.Name(), "trash.json"))
+        if err != nil { continue }
+        var e TrashEntry
+        if err := json.Unmarshal(b, &e); err != nil {
+            if cfg.Debug { log.Printf("[trash] %s: %v", d.Name(), err) }
+            continue
+        }
+        e.Name = d.Name()
+        out = append(out, e)
+    }
+    sort.SliceStable(out, func(i, j int) bool { return out[i].DeletedAt.After(out[j].DeletedAt) })
+    return out, nil
+}
+
+// FindTrash resolves refs against the trash: an entry name, a task ID or a unique ID
+// prefix (the latest deletion wins when a task was trashed more than once), or
+// @latest for the most recent deletion.
+func FindTrash(list []TrashEntry, refs []string) ([]TrashEntry, error) {
+    var out []TrashEntry
+    seen := map[string]bool{}
+    for _, ref := range refs {
+        e, err := findTrashEntry(list, ref)
+        if err != nil { return nil, err }
+        if !seen[e.Name] { seen[e.Name] = true; out = append(out, e) }
+    }
+    return out, nil
+}
+
+func findTrashEntry(list []TrashEntry, ref string) (TrashEntry, error) {
+    if len(list) == 0 { return TrashEntry{}, errors.New("the trash is empty") }
+    if ref == "@latest" { return list[0], nil }
+    for _, e := range list {
+        if e.Name == ref || e.ID == ref { return e, nil }
+    }
+    var ids []string
+    var match TrashEntry
+    for _, e := range list {
+        if !strings.HasPrefix(e.ID, ref) { continue }
+        if len(ids) == 0 { match = e }
+        if len(ids) == 0 || ids[len(ids)-1] != e.ID { ids = append(ids, e.ID) }
+    }
+    switch len(ids) {
+    case 0:
+        return TrashEntry{}, fmt.Errorf("no trashed task matches %q", ref)
+    case 1:
+        return match, nil
+    }
+    return TrashEntry{}, fmt.Errorf("%q matches several trashed tasks: %s", ref, strings.Join(ids, ", "))
+}
+
+// RestoreTrash moves a trashed task back to where it was deleted from and re-registers
+// its taskHistory entry (state DB and .backup, both backed up first).
+func RestoreTrash(cfg config.Config, e TrashEntry) error {
+    dir := e.Dir(cfg)
+    if _, err := os.Stat(e.OrigPath); err == nil { return fmt.Errorf("%s already exists", e.OrigPath) }
+    if e.History != nil {
+        if err := CheckEditorClosed(e.Source.stateConfig(cfg)); err != nil { return err }
+    }
+    if err := os.MkdirAll(filepath.Dir(e.OrigPath), 0o755); err != nil { return err }
+    if err := moveDir(filepath.Join(dir, "task"), e.OrigPath); err != nil { return err }
+    if e.History != nil {
+        sc := e.Source.stateConfig(cfg)
+        dbPath, err := detectStateDBPath(sc)
+        if err != nil { return fmt.Errorf("restored the folder but not its history entry: %w", err) }
+        dbs := existingStateDBs(dbPath)
+        if err := backupStateDBs(dbs, "restore from trash", []string{e.ID}); err != nil { return fmt.Errorf("restored the folder but not its history entry: %w", err) }
+        for _, p := range dbs {
+            if err := mergeHistoryEntries(p, e.Source.PluginID, []map[string]any{e.History}); err != nil { return fmt.Errorf("register in %s: %w", p, err) }
+        }
+    }
+    return os.RemoveAll(dir)
+}
+
+// PurgeTrash deletes a trashed task for good.
+func PurgeTrash(cfg config.Config, e TrashEntry) error { return os.RemoveAll(e.Dir(cfg)) }
+
+// PruneTrash purges entries deleted longer ago than the retention (see TrashRetention).
+func PruneTrash(cfg config.Config) ([]TrashEntry, error) {
+    keep := TrashRetention(cfg)
+    if keep == 0 { return nil, nil }
+    return EmptyTrash(cfg, keep)
+}
+
+// EmptyTrash purges entries deleted more than olderThan ago, or all of them when
+// olderThan is zero, and returns the purged entries.
+func EmptyTrash(cfg config.Config, olderThan time.Duration) ([]TrashEntry, error) {
+    list, err := ListTrash(cfg)
+    if err != nil { return nil, err }
+    var out []TrashEntry
+    for _, e := range list {
+        if olderThan > 0 && time.Since(e.DeletedAt) < olderThan { continue }
+        if err := PurgeTrash(cfg, e); err != nil { return out, err }
+        out = append(out, e)
+    }
+    return out, nil
+}
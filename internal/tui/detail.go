@@ -4,13 +4,52 @@ import (
     "fmt"
     "strings"
     "log"
+    "time"
 
     "roocode-task-man/internal/hooks"
     "roocode-task-man/internal/tasks"
 )
 
-// renderDetailMarkdown builds a markdown string that will be rendered for the viewport.
-func renderDetailMarkdown(t tasks.Task, env *hooks.HookEnv, debug bool) string {
+// DetailOptions slices the history rendered by RenderDetailMarkdown.
+type DetailOptions struct {
+    Role  string    // "user" keeps human prompts, "ai" keeps everything else; empty keeps all
+    Since time.Time // zero means unbounded
+    Until time.Time // zero means unbounded
+    Last  int       // keep only the last N entries left by the other options; 0 keeps all
+}
+
+func (o DetailOptions) keep(it tasks.HistoryItem) bool {
+    switch o.Role {
+    case "user":
+        if it.Role != "user" { return false }
+    case "ai":
+        if it.Role == "user" { return false }
+    }
+    if !o.Since.IsZero() && it.At.Before(o.Since) { return false }
+    if !o.Until.IsZero() && it.At.After(o.Until) { return false }
+    return true
+}
+
+// detailChunk is one independently rendered piece of a task's detail: the header (with
+// hook sections and the History heading), a single history entry, or the footer.
+type detailChunk struct {
+    md   string
+    role string // the entry's role ("user", "ai", "other"); empty for header and footer
+}
+
+// detailFooter closes the TUI detail view.
+const detailFooter = "\n(h) back  (q) quit  (e) export  (x) delete\n"
+
+// RenderDetailMarkdown renders a task header, hook sections and the (optionally sliced)
+// history as Markdown.
+func RenderDetailMarkdown(t tasks.Task, env *hooks.HookEnv, opts DetailOptions, debug bool) string {
+    b := &strings.Builder{}
+    for _, c := range detailChunks(t, env, opts, debug) { b.WriteString(c.md) }
+    return b.String()
+}
+
+// detailChunks splits the detail Markdown into the header and one chunk per history entry.
+func detailChunks(t tasks.Task, env *hooks.HookEnv, opts DetailOptions, debug bool) []detailChunk {
     b := &strings.Builder{}
     title := t.Title
     if title == "" { title = t.ID }
@@ -18,6 +57,7 @@ func renderDetailMarkdown(t tasks.Task, env *hooks.HookEnv, debug bool) string {
     fmt.Fprintf(b, "- ID: `%s`\n", t.ID)
     fmt.Fprintf(b, "- Created: %s\n", humanTime(t.CreatedAt))
     if t.Path != "" { fmt.Fprintf(b, "- Path: `%s`\n", t.Path) }
+    if t.Source != "" { fmt.Fprintf(b, "- Source: %s\n", t.Source) }
 
     // Hook-provided sections
     if env != nil {
@@ -44,22 +84,29 @@ func renderDetailMarkdown(t tasks.Task, env *hooks.HookEnv, debug bool) string {
     }
 
     // History from ui_messages.json
-    items := tasks.LoadHistory(t)
-    if len(items) > 0 {
-        fmt.Fprintf(b, "\n## History\n\n")
-        for _, it := range items {
-            // Entry heading with kind and timestamp
-            label := it.Kind
-            if it.Role == "user" { label = "🧑 User" }
-            if it.Role == "ai" { label = "🤖 AI" }
-            when := humanTime(it.At)
-            if label != "" && when != "" { fmt.Fprintf(b, "### %s — %s\n\n", label, when) }
-            if label != "" && when == "" { fmt.Fprintf(b, "### %s\n\n", label) }
-            if label == "" && when != "" { fmt.Fprintf(b, "### %s\n\n", when) }
-            if it.Text != "" { fmt.Fprintf(b, "%s\n\n", it.Text) }
+    var items []tasks.HistoryItem
+    if opts.Last > 0 && opts.Role == "" && opts.Since.IsZero() && opts.Until.IsZero() {
+        items = tasks.LastHistory(t, opts.Last)
+    } else {
+        for _, it := range tasks.LoadHistory(t) {
+            if opts.keep(it) { items = append(items, it) }
         }
+        if opts.Last > 0 && len(items) > opts.Last { items = items[len(items)-opts.Last:] }
     }
-
-    fmt.Fprintf(b, "\n(h) back  (q) quit  (e) export  (x) delete\n")
-    return b.String()
+    if len(items) > 0 { fmt.Fprintf(b, "\n## History\n\n") }
+    chunks := []detailChunk{{md: b.String()}}
+    for _, it := range items {
+        b := &strings.Builder{}
+        // Entry heading with kind and timestamp
+        label := it.Kind
+        if it.Role == "user" { label = "🧑 User" }
+        if it.Role == "ai" { label = "🤖 AI" }
+        when := humanTime(it.At)
+        if label != "" && when != "" { fmt.Fprintf(b, "### %s — %s\n\n", label, when) }
+        if label != "" && when == "" { fmt.Fprintf(b, "### %s\n\n", label) }
+        if label == "" && when != "" { fmt.Fprintf(b, "### %s\n\n", when) }
+        if it.Text != "" { fmt.Fprintf(b, "%s\n\n", it.Text) }
+        chunks = append(chunks, detailChunk{md: b.String(), role: it.Role})
+    }
+    return chunks
 }
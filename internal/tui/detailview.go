@@ -0,0 +1,225 @@
+package tui
+
+import (
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/charmbracelet/glamour"
+    "github.com/charmbracelet/lipgloss"
+)
+
+// detailDoc is the virtualized detail view. Chunks are rendered through glamour only when
+// they scroll into view, and the rendered lines are cached per width and Markdown, so
+// reloading a task re-renders only new or changed entries. The scroll position is an
+// anchor (chunk, line within it): chunks above the viewport never need rendering.
+type detailDoc struct {
+    chunks        []detailChunk
+    width, height int
+    top, line     int    // first visible line: line `line` of chunk `top`
+    query         string // search text highlighted in the view
+
+    cache     map[string][]string // width + "\x00" + markdown -> rendered lines
+    renderers map[int]*glamour.TermRenderer
+}
+
+func newDetailDoc() *detailDoc {
+    return &detailDoc{cache: map[string][]string{}, renderers: map[int]*glamour.TermRenderer{}}
+}
+
+// setChunks replaces the content, keeping the anchor where it is still valid.
+func (d *detailDoc) setChunks(chunks []detailChunk) {
+    d.chunks = chunks
+    d.evict()
+    if d.top >= len(chunks) { d.top, d.line = max(0, len(chunks)-1), 0 }
+    if len(chunks) > 0 { d.line = min(d.line, max(0, len(d.lines(d.top))-1)) }
+}
+
+func (d *detailDoc) setSize(w, h int) {
+    if w != d.width && len(d.chunks) > 0 { d.line = 0 } // line offsets differ once rewrapped
+    changed := w != d.width
+    d.width, d.height = w, max(1, h)
+    if changed { d.evict() }
+}
+
+// evict drops rendered lines and renderers the current chunks and width no longer use,
+// so reloading a growing task or resizing does not accumulate old renderings.
+func (d *detailDoc) evict() {
+    live := make(map[string]bool, len(d.chunks))
+    for _, c := range d.chunks { live[d.cacheKey(c)] = true }
+    for k := range d.cache {
+        if !live[k] { delete(d.cache, k) }
+    }
+    for w := range d.renderers {
+        if w != d.width { delete(d.renderers, w) }
+    }
+}
+
+func (d *detailDoc) cacheKey(c detailChunk) string { return strconv.Itoa(d.width) + "\x00" + c.md }
+
+// lines returns chunk i rendered at the current width.
+func (d *detailDoc) lines(i int) []string {
+    c := d.chunks[i]
+    key := d.cacheKey(c)
+    if ls, ok := d.cache[key]; ok { return ls }
+    out := c.md
+    if r := d.renderer(); r != nil {
+        if s, err := r.Render(c.md); err == nil { out = s }
+    }
+    ls := strings.Split(out, "\n")
+    // glamour pads every document with blank lines; keep a single one between chunks
+    for len(ls) > 0 && blankLine(ls[0]) { ls = ls[1:] }
+    for len(ls) > 0 && blankLine(ls[len(ls)-1]) { ls = ls[:len(ls)-1] }
+    ls = append(ls, "")
+    d.cache[key] = ls
+    return ls
+}
+
+func (d *detailDoc) renderer() *glamour.TermRenderer {
+    if r, ok := d.renderers[d.width]; ok { return r }
+    r, err := glamour.NewTermRenderer(glamour.WithAutoStyle(), glamour.WithWordWrap(max(20, d.width-4)))
+    if err != nil { r = nil }
+    d.renderers[d.width] = r
+    return r
+}
+
+var ansiSeq = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]")
+
+func stripANSI(s string) string { return ansiSeq.ReplaceAllString(s, "") }
+
+func blankLine(s string) bool { return strings.TrimSpace(stripANSI(s)) == "" }
+
+// remainingAtMost reports whether at most n lines remain from the anchor to the end.
+func (d *detailDoc) remainingAtMost(n int) bool {
+    rem := -d.line
+    for i := d.top; i < len(d.chunks); i++ {
+        rem += len(d.lines(i))
+        if rem > n { return false }
+    }
+    return true
+}
+
+func (d *detailDoc) atBottom() bool { return len(d.chunks) == 0 || d.remainingAtMost(d.height) }
+
+// scroll moves the view n lines down (n < 0: up), stopping at either end.
+func (d *detailDoc) scroll(n int) {
+    if len(d.chunks) == 0 { return }
+    for ; n > 0 && !d.atBottom(); n-- {
+        if d.line+1 < len(d.lines(d.top)) {
+            d.line++
+        } else {
+            d.top, d.line = d.top+1, 0
+        }
+    }
+    for ; n < 0; n++ {
+        switch {
+        case d.line > 0:
+            d.line--
+        case d.top > 0:
+            d.top--
+            d.line = len(d.lines(d.top)) - 1
+        default:
+            return
+        }
+    }
+}
+
+func (d *detailDoc) gotoTop() { d.top, d.line = 0, 0 }
+
+func (d *detailDoc) gotoBottom() {
+    if len(d.chunks) == 0 { return }
+    d.top = len(d.chunks) - 1
+    d.line = len(d.lines(d.top)) - 1
+    d.scroll(-(d.height - 1))
+}
+
+// jumpTo anchors the view at the start of chunk i.
+func (d *detailDoc) jumpTo(i int) {
+    if i < 0 || i >= len(d.chunks) { return }
+    d.top, d.line = i, 0
+}
+
+// entries returns the indexes of history chunks with the given role ("" for any entry).
+func (d *detailDoc) entries(role string) []int {
+    var out []int
+    for i, c := range d.chunks {
+        if c.role == "" { continue }
+        if role == "" || c.role == role { out = append(out, i) }
+    }
+    return out
+}
+
+// jumpNext anchors at the first chunk in idx after the current one, wrapping around.
+func (d *detailDoc) jumpNext(idx []int) {
+    if len(idx) == 0 { return }
+    for _, i := range idx {
+        if i > d.top { d.jumpTo(i); return }
+    }
+    d.jumpTo(idx[0])
+}
+
+// jumpPrev anchors at the last chunk in idx before the current position, wrapping around.
+func (d *detailDoc) jumpPrev(idx []int) {
+    if len(idx) == 0 { return }
+    for k := len(idx) - 1; k >= 0; k-- {
+        if idx[k] < d.top || (idx[k] == d.top && d.line > 0) { d.jumpTo(idx[k]); return }
+    }
+    d.jumpTo(idx[len(idx)-1])
+}
+
+// find moves to the next line containing the query (dir 1) or the previous one
+// (dir -1), wrapping around. Only chunks whose Markdown mentions the query are rendered.
+func (d *detailDoc) find(dir int) bool {
+    q := strings.ToLower(d.query)
+    if q == "" || len(d.chunks) == 0 { return false }
+    n := len(d.chunks)
+    for step := 0; step <= n; step++ {
+        i := ((d.top+dir*step)%n + n) % n
+        if !strings.Contains(strings.ToLower(d.chunks[i].md), q) { continue }
+        ls := d.lines(i)
+        if dir > 0 {
+            for j := range ls {
+                if step == 0 && j <= d.line { continue }
+                if strings.Contains(strings.ToLower(stripANSI(ls[j])), q) { d.top, d.line = i, j; return true }
+            }
+        } else {
+            for j := len(ls) - 1; j >= 0; j-- {
+                if step == 0 && j >= d.line { continue }
+                if strings.Contains(strings.ToLower(stripANSI(ls[j])), q) { d.top, d.line = i, j; return true }
+            }
+        }
+    }
+    // the Markdown matched but the rendered text did not (e.g. styling split the word):
+    // fall back to the start of the first matching chunk
+    for step := 1; step <= n; step++ {
+        i := ((d.top+dir*step)%n + n) % n
+        if strings.Contains(strings.ToLower(d.chunks[i].md), q) { d.jumpTo(i); return true }
+    }
+    return false
+}
+
+// findFirst moves to the first line containing the query, staying put when there is none.
+func (d *detailDoc) findFirst() bool {
+    top, line := d.top, d.line
+    d.top, d.line = 0, -1 // so that line 0 of the first chunk counts as "next"
+    if d.find(1) { return true }
+    d.top, d.line = top, line
+    return false
+}
+
+// view renders the visible lines, highlighting the search query.
+func (d *detailDoc) view() string {
+    out := make([]string, 0, d.height)
+    style := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("13"))
+    for i, j := d.top, d.line; i < len(d.chunks) && len(out) < d.height; i, j = i+1, 0 {
+        ls := d.lines(i)
+        for ; j < len(ls) && len(out) < d.height; j++ {
+            ln := ls[j]
+            if d.query != "" && strings.Contains(strings.ToLower(stripANSI(ln)), strings.ToLower(d.query)) {
+                ln = highlightAll(stripANSI(ln), d.query, func(s string) string { return style.Render(s) })
+            }
+            out = append(out, ln)
+        }
+    }
+    return strings.Join(out, "\n")
+}
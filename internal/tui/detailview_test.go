@@ -0,0 +1,109 @@
+package tui
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// testDoc builds a detail view whose chunks have the given line counts, seeding the
+// render cache so the paging math runs without glamour.
+func testDoc(height int, sizes ...int) *detailDoc {
+    d := newDetailDoc()
+    d.setSize(80, height)
+    for i, n := range sizes {
+        role := ""
+        if i > 0 { role = []string{"user", "ai"}[(i-1)%2] }
+        c := detailChunk{md: fmt.Sprintf("chunk %d\n", i), role: role}
+        d.chunks = append(d.chunks, c)
+        ls := make([]string, n)
+        for j := range ls { ls[j] = fmt.Sprintf("c%d l%d", i, j) }
+        d.cache[d.cacheKey(c)] = ls
+    }
+    return d
+}
+
+func pos(d *detailDoc) string { return fmt.Sprintf("%d:%d", d.top, d.line) }
+
+func TestDetailDocPaging(t *testing.T) {
+    // 14 lines: chunk 0 holds lines 0-2, chunk 1 3-6, chunk 2 7-8, chunk 3 9-13
+    cases := []struct {
+        height, from, scroll int
+        want                 string
+    }{
+        {5, 0, 1, "0:1"},
+        {5, 0, 3, "1:0"},
+        {5, 0, 8, "2:1"},
+        {5, 0, 100, "3:0"}, // stops once the last 5 lines fill the view
+        {5, 0, -1, "0:0"},
+        {5, 9, -3, "1:3"},
+        {7, 0, 100, "2:0"},
+        {20, 0, 5, "0:0"}, // everything fits: no scrolling
+    }
+    for _, tc := range cases {
+        d := testDoc(tc.height, 3, 4, 2, 5)
+        d.scroll(tc.from)
+        d.scroll(tc.scroll)
+        if got := pos(d); got != tc.want { t.Errorf("height %d, scroll %d then %d: got %s want %s", tc.height, tc.from, tc.scroll, got, tc.want) }
+    }
+
+    for height, want := range map[int]string{5: "3:0", 7: "2:0", 20: "0:0"} {
+        d := testDoc(height, 3, 4, 2, 5)
+        d.gotoBottom()
+        if got := pos(d); got != want { t.Errorf("height %d: gotoBottom at %s, want %s", height, got, want) }
+        if !d.atBottom() { t.Errorf("height %d: not at bottom after gotoBottom", height) }
+    }
+
+    d := testDoc(5, 3, 4, 2, 5)
+    d.scroll(8)
+    if d.atBottom() { t.Fatalf("at bottom with 6 lines left in a 5-line view") }
+    if got := strings.Split(d.view(), "\n"); len(got) != 5 || got[0] != "c2 l1" || got[4] != "c3 l3" {
+        t.Fatalf("view at 2:1: %q", got)
+    }
+}
+
+func TestDetailDocJumps(t *testing.T) {
+    d := testDoc(5, 3, 4, 2, 5)
+    users := d.entries("user")
+    if fmt.Sprint(users) != "[1 3]" { t.Fatalf("user entries: %v", users) }
+    if all := d.entries(""); fmt.Sprint(all) != "[1 2 3]" { t.Fatalf("entries: %v", all) }
+
+    steps := []struct {
+        next bool
+        want string
+    }{
+        {true, "1:0"},
+        {true, "3:0"},
+        {true, "1:0"}, // wraps around
+        {false, "3:0"}, // wraps around
+        {false, "1:0"},
+    }
+    for i, s := range steps {
+        if s.next { d.jumpNext(users) } else { d.jumpPrev(users) }
+        if got := pos(d); got != s.want { t.Fatalf("step %d: got %s want %s", i, got, s.want) }
+    }
+    // inside an entry, "previous" goes back to its start
+    d.setSize(80, 2)
+    d.jumpTo(3)
+    d.scroll(2)
+    d.jumpPrev(users)
+    if got := pos(d); got != "3:0" { t.Fatalf("jumpPrev inside entry: got %s", got) }
+}
+
+func TestDetailDocEvictsCache(t *testing.T) {
+    d := testDoc(5, 3, 4, 2, 5)
+    d.renderers[80] = nil
+    d.renderers[60] = nil
+    d.cache["60\x00stale"] = []string{"x"}
+
+    d.setChunks(d.chunks[:2])
+    if len(d.cache) != 2 { t.Fatalf("cache after setChunks: %d entries, want 2", len(d.cache)) }
+    for _, c := range d.chunks {
+        if _, ok := d.cache[d.cacheKey(c)]; !ok { t.Fatalf("evicted a chunk still shown: %q", c.md) }
+    }
+    if _, ok := d.renderers[60]; ok { t.Fatalf("renderer for an old width kept") }
+
+    d.setSize(100, 5)
+    if len(d.cache) != 0 { t.Fatalf("cache after resize: %d entries, want 0", len(d.cache)) }
+    if _, ok := d.renderers[80]; ok { t.Fatalf("renderer for the previous width kept") }
+}
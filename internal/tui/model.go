@@ -1,7 +1,9 @@
 package tui
 
 import (
+    "errors"
     "fmt"
+    "os"
     "path/filepath"
     "time"
     "log"
@@ -13,11 +15,9 @@ import (
     "github.com/charmbracelet/bubbles/help"
     "github.com/charmbracelet/bubbles/key"
     "github.com/charmbracelet/bubbles/list"
-    "github.com/charmbracelet/bubbles/viewport"
     "github.com/charmbracelet/bubbles/spinner"
     "github.com/charmbracelet/bubbles/textinput"
     "github.com/charmbracelet/lipgloss"
-    "github.com/charmbracelet/glamour"
     tea "github.com/charmbracelet/bubbletea"
 
     "roocode-task-man/internal/config"
@@ -32,7 +32,7 @@ type model struct {
     prompts   list.Model
     detail    *tasks.Task
     help      help.Model
-    vp        viewport.Model
+    doc       *detailDoc // open task, rendered lazily
     spin      spinner.Model
     input     textinput.Model
     width     int
@@ -40,6 +40,8 @@ type model struct {
     statusMsg string
 
     confirmingDelete bool
+    lastTrash []tasks.TrashEntry // last deletion, restored by undo
+    trashing bool // a delete or undo is running in the background
     hooks    *hooks.HookEnv
     showHelp bool
     loading  bool
@@ -48,15 +50,10 @@ type model struct {
     // detail search
     searchMode bool
     searchQuery string
-    rawDetail string
-    renderedDetail string
     topMsg string
     // modes and sorting
     sortAsc bool
-    // history indexes
-    histAll []int
-    histAI []int
-    histUser []int
+    sortBySize bool // largest tasks first (Z), overriding the time order
     lastFilter string
     selected map[string]bool
     hookApplied map[string]bool // tracks which task IDs had hooks applied
@@ -65,6 +62,10 @@ type model struct {
 
     // right-panel cache
     promptsForID string
+
+    // live reload
+    watch      *watcher
+    reselectID string // task to select once the filtered items of a reload arrive
 }
 
 type item struct{ t tasks.Task; selected bool; desc string; title string; corpus string }
@@ -72,7 +73,7 @@ type item struct{ t tasks.Task; selected bool; desc string; title string; corpus
 func (i item) Title() string       { if i.selected { return selectedPrefix() + i.title }; return i.title }
 func (i item) Description() string { return i.desc }
 func (i item) FilterValue() string {
-    return i.t.Title + " " + i.t.ID + " " + humanTime(i.t.CreatedAt) + " uid:" + i.t.ID + " -uid=" + i.t.ID + " -d=" + humanTime(i.t.CreatedAt) + " " + i.desc + " " + i.corpus
+    return i.t.Title + " " + i.t.ID + " " + i.t.Source + " " + humanTime(i.t.CreatedAt) + " uid:" + i.t.ID + " -uid=" + i.t.ID + " -d=" + humanTime(i.t.CreatedAt) + " " + i.desc + " " + i.corpus
 }
 
 type keymap struct{
@@ -86,7 +87,9 @@ type keymap struct{
     clearSel key.Binding
     openDir key.Binding
     sort key.Binding
+    sortSize key.Binding
     del key.Binding
+    undo key.Binding
     quit key.Binding
 }
 
@@ -102,7 +105,9 @@ func newKeymap() keymap {
         clearSel: key.NewBinding(key.WithKeys("C"), key.WithHelp("C", "clear selection")),
         openDir: key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "open task dir")),
         sort: key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "sort time")),
+        sortSize: key.NewBinding(key.WithKeys("Z"), key.WithHelp("Z", "sort size")),
         del: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "delete")),
+        undo: key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "undo delete")),
         quit: key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
     }
 }
@@ -111,10 +116,10 @@ var keys = newKeymap()
 
 func New(cfg config.Config) model {
     lm := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
-    lm.Title = "RooCode Tasks — " + tasks.DisplayEditorName(cfg.CodeChannel) + "  [sort:desc]"
+    lm.Title = "RooCode Tasks — " + sourceTitle(cfg) + "  [sort:desc]"
     lm.SetShowStatusBar(false)
     lm.SetFilteringEnabled(true)
-    lm.AdditionalShortHelpKeys = func() []key.Binding { return []key.Binding{keys.open, keys.refresh, keys.sort, keys.toggleSel, keys.toggleSelAlt, keys.export, keys.exportSel, keys.clearSel, keys.del, keys.quit} }
+    lm.AdditionalShortHelpKeys = func() []key.Binding { return []key.Binding{keys.open, keys.refresh, keys.sort, keys.sortSize, keys.toggleSel, keys.toggleSelAlt, keys.export, keys.exportSel, keys.clearSel, keys.del, keys.undo, keys.quit} }
     lm.AdditionalFullHelpKeys = lm.AdditionalShortHelpKeys
     // Make help a bit more visible (but not too bright)
     hs := lm.Styles.HelpStyle
@@ -142,11 +147,18 @@ func New(cfg config.Config) model {
         hookApplied: map[string]bool{},
         selectionTracker: map[string]bool{},
     }
+    if dirs, err := tasks.WatchDirs(cfg); err == nil {
+        if w, err := newWatcher(dirs, cfg.Debug); err == nil {
+            m.watch = w
+        } else if cfg.Debug {
+            log.Printf("[watch] disabled: %v", err)
+        }
+    }
     return m
 }
 
 func (m model) Init() tea.Cmd {
-    return tea.Batch(loadHooksCmd(m.cfg), loadTasksWithHooksCmd(m.cfg), spinner.Tick)
+    return tea.Batch(loadHooksCmd(m.cfg), loadTasksWithHooksCmd(m.cfg), spinner.Tick, m.watch.next(), autoBackupCmd(m.cfg))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -159,28 +171,63 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
         h := max(5, m.height-2)
         m.list.SetSize(leftW, h)
         m.prompts.SetSize(rightW, h)
+        if m.doc != nil { m.doc.setSize(m.width, max(3, m.height-4)) }
         return m, nil
     case tasksLoadedMsg:
+        // Keep the cursor on the same task across reloads; fall back to the same row.
+        prevID, prevIdx := "", m.list.Index()
+        if it, ok := m.list.SelectedItem().(item); ok { prevID = it.t.ID }
         m.tasks = []tasks.Task(msg)
+        if m.sortAsc || m.sortBySize { m.sortTasks() }
         m.loading = false
-        m.rebuildListItemsPreserveSelection()
+        cmd := m.rebuildListItemsPreserveSelection()
+        m.promptsForID = ""
         if len(m.tasks) == 0 {
             m.statusMsg = "No tasks found"
         } else {
             m.statusMsg = fmt.Sprintf("%d tasks", len(m.tasks))
-            m.list.Select(0)
+            if m.list.FilterState() != list.Unfiltered {
+                // filtered items are recomputed asynchronously (list.FilterMatchesMsg)
+                m.reselectID = prevID
+            } else if prevID == "" || !m.selectTask(prevID) {
+                m.list.Select(min(prevIdx, len(m.list.Items())-1))
+            }
             m.refreshPromptsFromSelection()
         }
-        return m, nil
+        if m.detail != nil {
+            for _, t := range m.tasks {
+                if t.Path == m.detail.Path { t := t; m.detail = &t; break }
+            }
+        }
+        return m, cmd
+    case tasksChangedMsg:
+        return m, tea.Batch(loadTasksWithHooksCmd(m.cfg), m.watch.next())
+    case detailChangedMsg:
+        if m.detail != nil && m.detail.Path == msg.dir {
+            if _, err := os.Stat(msg.dir); err != nil {
+                m.topMsg = "Task folder was removed on disk"
+            } else {
+                m.refreshDetail()
+            }
+        }
+        return m, m.watch.next()
     case hooksLoadedMsg:
         m.hooks = msg.env
+        var cmd tea.Cmd
         if m.hooks != nil {
             m.setTitle(true)
             // Rebuild list items to apply renderTaskListItem overrides
             if len(m.tasks) > 0 {
-                m.rebuildListItemsPreserveSelection()
+                cmd = m.rebuildListItemsPreserveSelection()
             }
         }
+        return m, cmd
+    case backupDoneMsg:
+        if msg.err != nil {
+            m.statusMsg = "automatic backup failed: " + msg.err.Error()
+        } else if msg.name != "" {
+            m.statusMsg = "backup snapshot " + msg.name + " saved"
+        }
         return m, nil
     case exportProgressMsg:
         if msg.err != nil {
@@ -195,6 +242,33 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
             _ = openInExplorer(filepath.Dir(msg.zipPath))
         }
         return m, nil
+    case trashDoneMsg:
+        m.trashing = false
+        for _, e := range msg.entries {
+            delete(m.selectionTracker, e.ID)
+            delete(m.selected, e.ID)
+        }
+        if len(msg.entries) > 0 { m.lastTrash = msg.entries }
+        switch {
+        case msg.err != nil:
+            m.statusMsg = "delete failed: " + msg.err.Error()
+        case len(msg.entries) == 1:
+            m.statusMsg = "moved " + msg.entries[0].ID + " to the trash — u to undo"
+        default:
+            m.statusMsg = fmt.Sprintf("moved %d tasks to the trash — u to undo", len(msg.entries))
+        }
+        if len(msg.entries) > 0 { return m, loadTasksWithHooksCmd(m.cfg) }
+        return m, nil
+    case trashRestoredMsg:
+        m.trashing = false
+        m.lastTrash = m.lastTrash[msg.restored:]
+        if msg.err != nil {
+            m.statusMsg = "undo failed for " + m.lastTrash[0].ID + ": " + msg.err.Error()
+        } else {
+            m.statusMsg = fmt.Sprintf("restored %d task(s)", msg.restored)
+        }
+        if msg.restored > 0 { return m, loadTasksWithHooksCmd(m.cfg) }
+        return m, nil
     case spinner.TickMsg:
         var cmd tea.Cmd
         m.spin, cmd = m.spin.Update(msg)
@@ -224,26 +298,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
             switch s {
             case keys.back.Keys()[0], "q":
                 m.detail = nil
+                m.watch.watchTask("")
                 m.confirmingDelete = false
                 m.pendingG = false
                 return m, nil
             case "j", "down":
-                m.vp.LineDown(1); return m, nil
+                m.doc.scroll(1); return m, nil
             case "k", "up":
-                m.vp.LineUp(1); return m, nil
+                m.doc.scroll(-1); return m, nil
             case "pgdown", "ctrl+f":
-                m.vp.ViewDown(); return m, nil
+                m.doc.scroll(m.doc.height); return m, nil
             case "pgup", "ctrl+b":
-                m.vp.ViewUp(); return m, nil
+                m.doc.scroll(-m.doc.height); return m, nil
             case "ctrl+d":
-                m.vp.HalfViewDown(); return m, nil
+                m.doc.scroll(m.doc.height / 2); return m, nil
             case "ctrl+u":
-                m.vp.HalfViewUp(); return m, nil
+                m.doc.scroll(-m.doc.height / 2); return m, nil
             case "g":
-                if m.pendingG { m.vp.GotoTop(); m.pendingG = false } else { m.pendingG = true }
+                if m.pendingG { m.doc.gotoTop(); m.pendingG = false } else { m.pendingG = true }
                 return m, nil
             case "G":
-                m.vp.GotoBottom(); return m, nil
+                m.doc.gotoBottom(); return m, nil
             case keys.openDir.Keys()[0]:
                 if m.detail != nil {
                     _ = openInExplorer(m.detail.Path)
@@ -268,10 +343,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                 m.input.Focus()
                 return m, nil
             case "n":
-                m.findNext()
+                m.doc.find(1)
                 return m, nil
             case "N":
-                m.findPrev()
+                m.doc.find(-1)
                 return m, nil
             }
             // Detail-specific actions could go here
@@ -286,23 +361,31 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
         }
         switch msg.String() {
         case keys.quit.Keys()[0], "ctrl+c":
+            m.watch.close()
             return m, tea.Quit
         case keys.open.Keys()[0], "l":
             if it, ok := m.list.SelectedItem().(item); ok {
                 t := it.t
                 m.detail = &t
                 m.renderDetailViewport()
+                m.watch.watchTask(t.Path)
             }
             return m, nil
         case keys.refresh.Keys()[0]:
             m.loading = true
             return m, tea.Batch(loadHooksCmd(m.cfg), loadTasksWithHooksCmd(m.cfg))
         case "S":
-            m.sortAsc = !m.sortAsc
+            if m.sortBySize { m.sortBySize = false } else { m.sortAsc = !m.sortAsc }
             m.sortTasks()
-            m.rebuildListItemsPreserveSelection()
+            cmd := m.rebuildListItemsPreserveSelection()
             m.setTitle(m.hooks != nil)
-            return m, nil
+            return m, cmd
+        case keys.sortSize.Keys()[0]:
+            m.sortBySize = !m.sortBySize
+            m.sortTasks()
+            cmd := m.rebuildListItemsPreserveSelection()
+            m.setTitle(m.hooks != nil)
+            return m, cmd
         case keys.openDir.Keys()[0]:
             if it, ok := m.list.SelectedItem().(item); ok {
                 _ = openInExplorer(it.t.Path)
@@ -334,7 +417,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                     prefix := fmt.Sprintf("%s-%s", slug(tasks.DisplayEditorName(m.cfg.CodeChannel)), slug(m.cfg.PluginID))
                     zipPath := filepath.Join(base, fmt.Sprintf("%s-tasks-%s.zip", prefix, time.Now().Format("20060102-150405")))
                     if m.detail != nil { m.topMsg = fmt.Sprintf("Exporting %d tasks... 0%%", len(sel)) }
-                    return m, exportTasksCmd(sel, zipPath)
+                    return m, exportTasksCmd(m.cfg, sel, zipPath)
                 } else {
                     t := it.t
                     base := m.cfg.ExportDir
@@ -342,7 +425,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                     prefix := fmt.Sprintf("%s-%s", slug(tasks.DisplayEditorName(m.cfg.CodeChannel)), slug(m.cfg.PluginID))
                     zipPath := filepath.Join(base, fmt.Sprintf("%s-%s.zip", prefix, t.ID))
                     if m.detail != nil { m.topMsg = "Exporting task... 0%" }
-                    return m, exportTasksCmd([]tasks.Task{t}, zipPath)
+                    return m, exportTasksCmd(m.cfg, []tasks.Task{t}, zipPath)
                 }
             }
             return m, nil
@@ -354,7 +437,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
             prefix := fmt.Sprintf("%s-%s", slug(tasks.DisplayEditorName(m.cfg.CodeChannel)), slug(m.cfg.PluginID))
             zipPath := filepath.Join(base, fmt.Sprintf("%s-tasks-%s.zip", prefix, time.Now().Format("20060102-150405")))
             if m.detail != nil { m.topMsg = fmt.Sprintf("Exporting %d tasks... 0%%", len(sel)) }
-            return m, exportTasksCmd(sel, zipPath)
+            return m, exportTasksCmd(m.cfg, sel, zipPath)
         case keys.toggleSel.Keys()[0], keys.toggleSelAlt.Keys()[0]:
             // Toggle selection using persistent tracker for IME robustness
             if selItem, ok := m.list.SelectedItem().(item); ok {
@@ -391,9 +474,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
             m.list.SetShowHelp(m.showHelp)
             return m, nil
         case keys.del.Keys()[0]:
+            if m.trashing { m.statusMsg = "a delete or undo is still running"; return m, nil }
             if !m.confirmingDelete {
+                n := len(m.deleteTargets())
+                if n == 0 { return m, nil }
                 m.confirmingDelete = true
-                m.statusMsg = "Delete selected task? y/N"
+                m.statusMsg = fmt.Sprintf("Move %d task(s) to the trash? y/N", n)
                 return m, nil
             }
             // already confirming, ignore
@@ -401,16 +487,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
         case "y":
             if m.confirmingDelete {
                 m.confirmingDelete = false
-                if it, ok := m.list.SelectedItem().(item); ok {
-                    if err := tasks.DeleteTask(it.t); err != nil {
-                        m.statusMsg = "delete failed: " + err.Error()
-                    } else {
-                        m.statusMsg = "deleted: " + it.t.ID
-                        return m, loadTasksWithHooksCmd(m.cfg)
-                    }
-                }
+                targets := m.deleteTargets()
+                if len(targets) == 0 { return m, nil }
+                m.trashing = true
+                m.statusMsg = fmt.Sprintf("moving %d task(s) to the trash…", len(targets))
+                return m, trashTasksCmd(m.cfg, targets)
             }
             return m, nil
+        case keys.undo.Keys()[0]:
+            if m.trashing { m.statusMsg = "a delete or undo is still running"; return m, nil }
+            if len(m.lastTrash) == 0 { m.statusMsg = "nothing to undo"; return m, nil }
+            m.trashing = true
+            m.statusMsg = fmt.Sprintf("restoring %d task(s)…", len(m.lastTrash))
+            return m, restoreTrashCmd(m.cfg, m.lastTrash)
         case "n":
             if m.confirmingDelete {
                 m.confirmingDelete = false
@@ -423,10 +512,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
     // Delegate other events to list
     var cmd tea.Cmd
     m.list, cmd = m.list.Update(msg)
+    if _, ok := msg.(list.FilterMatchesMsg); ok && m.reselectID != "" {
+        m.selectTask(m.reselectID)
+        m.reselectID = ""
+    }
     // If filter string changed, rebuild items with special token pre-filtering
     if f := m.list.FilterValue(); f != m.lastFilter {
         m.lastFilter = f
-        m.rebuildListItemsPreserveSelection()
+        cmd = tea.Batch(cmd, m.rebuildListItemsPreserveSelection())
     }
     // Update right panel when selection changes
     m.refreshPromptsFromSelection()
@@ -442,7 +535,7 @@ func (m model) View() string {
         if m.searchMode {
             header = header + "\n/ " + m.input.View()
         }
-        return header + "\n\n" + m.vp.View()
+        return header + "\n\n" + m.doc.view()
     }
     if m.loading {
         return fmt.Sprintf("%s Loading tasks...", m.spin.View())
@@ -454,6 +547,13 @@ func (m model) View() string {
     return combined + footer(m.statusMsg)
 }
 
+// deleteTargets is what x acts on: the selected tasks, or the one under the cursor.
+func (m model) deleteTargets() []tasks.Task {
+    if sel := m.selectedTasks(); len(sel) > 0 { return sel }
+    if it, ok := m.list.SelectedItem().(item); ok { return []tasks.Task{it.t} }
+    return nil
+}
+
 func (m model) selectedTasks() []tasks.Task {
     out := []tasks.Task{}
     for _, li := range m.list.Items() {
@@ -501,8 +601,51 @@ func loadTasksWithHooksCmd(cfg config.Config) tea.Cmd {
 
 type hooksLoadedMsg struct{ env *hooks.HookEnv }
 
+// trashDoneMsg reports the tasks trashTasksCmd moved to the trash.
+type trashDoneMsg struct{ entries []tasks.TrashEntry; err error }
+
+// trashRestoredMsg reports how many of the entries restoreTrashCmd brought back, in
+// order; err is why the next one failed.
+type trashRestoredMsg struct{ restored int; err error }
+
+// trashTasksCmd moves tasks to the trash off the UI loop: it backs up and rewrites the
+// state DBs and moves whole task folders.
+func trashTasksCmd(cfg config.Config, ts []tasks.Task) tea.Cmd {
+    return func() tea.Msg {
+        entries, err := tasks.TrashTasks(cfg, ts)
+        return trashDoneMsg{entries, err}
+    }
+}
+
+func restoreTrashCmd(cfg config.Config, entries []tasks.TrashEntry) tea.Cmd {
+    return func() tea.Msg {
+        for i, e := range entries {
+            if err := tasks.RestoreTrash(cfg, e); err != nil { return trashRestoredMsg{i, err} }
+        }
+        return trashRestoredMsg{restored: len(entries)}
+    }
+}
+
 type exportProgressMsg struct{ current, total int; zipPath string; err error }
 
+// backupDoneMsg reports the snapshot autoBackupCmd took; name is empty when none was due.
+type backupDoneMsg struct{ name string; err error }
+
+// autoBackupCmd snapshots the tasks and state DB in the background when backupEvery is
+// set and the newest snapshot is older than that.
+func autoBackupCmd(cfg config.Config) tea.Cmd {
+    if cfg.BackupEvery == "" { return nil }
+    return func() tea.Msg {
+        every, err := tasks.ParseAge(cfg.BackupEvery)
+        if err != nil || every <= 0 { return backupDoneMsg{err: fmt.Errorf("invalid backupEvery %q", cfg.BackupEvery)} }
+        if due, err := tasks.BackupDue(cfg, every); err != nil || !due { return backupDoneMsg{err: err} }
+        snap, _, err := tasks.CreateSnapshot(cfg, "automatic")
+        if err != nil { return backupDoneMsg{err: err} }
+        _, _, err = tasks.PruneSnapshots(cfg, tasks.BackupKeepRules(cfg))
+        return backupDoneMsg{name: snap.Name, err: err}
+    }
+}
+
 func loadHooksCmd(cfg config.Config) tea.Cmd {
     return func() tea.Msg {
         hooks.EnableDebug(cfg.Debug)
@@ -511,8 +654,10 @@ func loadHooksCmd(cfg config.Config) tea.Cmd {
     }
 }
 
-func exportTasksCmd(sel []tasks.Task, zipPath string) tea.Cmd {
+func exportTasksCmd(cfg config.Config, sel []tasks.Task, zipPath string) tea.Cmd {
     return func() tea.Msg {
+        sel = append([]tasks.Task(nil), sel...)
+        tasks.AttachWorkspaces(cfg, sel)
         err := zipper.ExportTasksWithProgress(sel, zipPath, func(current, total int) {
             // Note: We can't send messages from callback, but we track final state
         })
@@ -523,44 +668,76 @@ func exportTasksCmd(sel []tasks.Task, zipPath string) tea.Cmd {
 func (m *model) setTitle(haveHooks bool) {
     sortStr := "desc"
     if m.sortAsc { sortStr = "asc" }
-    base := "RooCode Tasks — " + tasks.DisplayEditorName(m.cfg.CodeChannel) + "  [sort:" + sortStr + "]"
+    if m.sortBySize { sortStr = "size" }
+    base := "RooCode Tasks — " + sourceTitle(m.cfg) + "  [sort:" + sortStr + "]"
     if haveHooks { base += "  [hooks]" }
     m.list.Title = base
 }
 
+// renderDetailViewport opens m.detail in a fresh document at the top. Only the chunks
+// that scroll into view are rendered.
 func (m *model) renderDetailViewport() {
     if m.detail == nil { return }
-    // build markdown content then render via glamour
-    content := renderDetailMarkdown(*m.detail, m.hooks, m.cfg.Debug)
-    m.rawDetail = content
-    // Use glamour to render markdown to ANSI suitable for terminal
-    r, err := glamour.NewTermRenderer(glamour.WithAutoStyle())
-    if err == nil {
-        if s, err2 := r.Render(content); err2 == nil { content = s }
-    }
-    m.renderedDetail = content
-    m.vp = viewport.New(m.width, max(3, m.height-4))
-    m.vp.SetContent(content)
-    m.buildHistoryIndexes()
+    m.doc = newDetailDoc()
+    m.doc.setSize(m.width, max(3, m.height-4))
+    m.doc.setChunks(m.detailContent())
+    m.doc.query = m.searchQuery
+}
+
+// detailContent is the open task as chunks: header, one per history entry, and the footer.
+func (m *model) detailContent() []detailChunk {
+    return append(detailChunks(*m.detail, m.hooks, DetailOptions{}, m.cfg.Debug), detailChunk{md: detailFooter})
+}
+
+// refreshDetail reloads the open task after its files changed, keeping the scroll
+// position, or following new messages when the view was already at the bottom.
+// Unchanged entries come from the render cache.
+func (m *model) refreshDetail() {
+    if m.doc == nil { m.renderDetailViewport(); return }
+    atBottom := m.doc.atBottom()
+    m.doc.setChunks(m.detailContent())
+    if atBottom { m.doc.gotoBottom() }
 }
 
 func max(a, b int) int { if a>b { return a }; return b }
+func min(a, b int) int { if a<b { return a }; return b }
+
+// sourceTitle names what the list shows: the editor, or all sources (optionally filtered).
+func sourceTitle(cfg config.Config) string {
+    if !tasks.MultiSource(cfg) { return tasks.DisplayEditorName(cfg.CodeChannel) }
+    if cfg.Source != "" { return "sources ~ " + cfg.Source }
+    return "All sources"
+}
 
 func humanTime(t time.Time) string {
     if t.IsZero() { return "" }
     return t.Local().Format("2006-01-02 15:04")
 }
 
-func (m *model) rebuildListItemsPreserveSelection() {
+// selectTask moves the cursor to the visible item for task id and reports whether it
+// was found.
+func (m *model) selectTask(id string) bool {
+    for i, li := range m.list.VisibleItems() {
+        if it, ok := li.(item); ok && it.t.ID == id { m.list.Select(i); return true }
+    }
+    return false
+}
+
+// rebuildListItemsPreserveSelection rebuilds the list items from m.tasks, keeping the
+// multi-selection and special filter tokens. The returned command re-applies an active
+// list filter to the new items.
+func (m *model) rebuildListItemsPreserveSelection() tea.Cmd {
     base := m.tasks
     // Special token pre-filtering
     q := strings.TrimSpace(m.list.FilterValue())
     if strings.Contains(q, "-uid=") || strings.Contains(q, "-d") {
         uidTok, dateOp, dateTok := parseSpecialFilter(q)
+        var uidSet map[string]bool
+        if uidTok != "" { uidSet = resolveUIDFilter(base, uidTok) }
         filtered := make([]tasks.Task, 0, len(base))
         for _, t := range base {
             ok := true
-            if uidTok != "" && !strings.Contains(strings.ToLower(t.ID), strings.ToLower(uidTok)) { ok = false }
+            if uidTok != "" && !uidSet[t.ID] { ok = false }
             if dateTok != "" && !matchesDateFilter(t.CreatedAt, dateOp, dateTok) { ok = false }
             if ok { filtered = append(filtered, t) }
         }
@@ -589,14 +766,14 @@ func (m *model) rebuildListItemsPreserveSelection() {
                         if m.cfg.Debug { log.Printf("[hooks] renderTaskListItem override for %s", t.ID) }
                         m.hookApplied[t.ID] = true
                         hookBadge := lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Render("[H] ")
-                        items = append(items, item{t: t, selected: isSelected, desc: sanitizeInline(s), title: hookBadge + shownTitle, corpus: buildPromptCorpus(t)})
+                        items = append(items, item{t: t, selected: isSelected, desc: sanitizeInline(s), title: hookBadge + shownTitle, corpus: tasks.PromptCorpus(t)})
                         continue
                     }
                     if s, ok3 := om["description"].(string); ok3 && s != "" {
                         if m.cfg.Debug { log.Printf("[hooks] renderTaskListItem override(desc) for %s", t.ID) }
                         m.hookApplied[t.ID] = true
                         hookBadge := lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Render("[H] ")
-                        items = append(items, item{t: t, selected: isSelected, desc: sanitizeInline(s), title: hookBadge + shownTitle, corpus: buildPromptCorpus(t)})
+                        items = append(items, item{t: t, selected: isSelected, desc: sanitizeInline(s), title: hookBadge + shownTitle, corpus: tasks.PromptCorpus(t)})
                         continue
                     }
                 }
@@ -608,10 +785,12 @@ func (m *model) rebuildListItemsPreserveSelection() {
         title := shownTitle
         // always show second line: created and UID
         desc := fmt.Sprintf("%s • %s", humanTime(t.CreatedAt), t.ID)
-        corpus := buildPromptCorpus(t)
+        if m.sortBySize { desc = usageLine(tasks.TaskDiskUsage(t)) + " • " + desc }
+        if t.Source != "" { desc += " • " + t.Source }
+        corpus := tasks.PromptCorpus(t)
         items = append(items, item{t: t, selected: isSelected, desc: desc, title: title, corpus: corpus})
     }
-    m.list.SetItems(items)
+    return m.list.SetItems(items)
 }
 
 // refreshPromptsFromSelection populates the right panel with user prompts
@@ -652,21 +831,6 @@ func selectedPrefix() string {
     return lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Render("[x] ")
 }
 
-func buildPromptCorpus(t tasks.Task) string {
-    hist := tasks.LoadHistory(t)
-    const maxCorpusLen = 4000
-    b := strings.Builder{}
-    for _, h := range hist {
-        if h.Role != "user" { continue }
-        line, _, _ := tasks.CleanOneLine(h.Text, 200)
-        if line == "" { continue }
-        if b.Len() > 0 { b.WriteByte(' ') }
-        b.WriteString(line)
-        if b.Len() >= maxCorpusLen { break }
-    }
-    return b.String()
-}
-
 func parseSpecialFilter(q string) (uid, dateOp, dateVal string) {
     // parse -uid= and -d[op]= tokens (case-insensitive)
     // Operators: -d=   (contains), -d>=  (>=), -d<=  (<=), -d: (month match)
@@ -696,6 +860,22 @@ func parseSpecialFilter(q string) (uid, dateOp, dateVal string) {
     return
 }
 
+// resolveUIDFilter returns the IDs a -uid= token refers to: the resolved task, or every
+// candidate when the reference is ambiguous (so the list narrows as you type).
+func resolveUIDFilter(list []tasks.Task, ref string) map[string]bool {
+    out := map[string]bool{}
+    t, err := tasks.ResolveRef(list, ref)
+    if err == nil {
+        out[t.ID] = true
+        return out
+    }
+    var amb *tasks.AmbiguousError
+    if errors.As(err, &amb) {
+        for _, c := range amb.Candidates { out[c.ID] = true }
+    }
+    return out
+}
+
 func matchesDateFilter(createdAt time.Time, op string, filterVal string) bool {
     if op == "" || filterVal == "" {
         return true
@@ -749,7 +929,18 @@ func slug(s string) string {
     return out
 }
 
+// usageLine summarizes a task's disk usage for the list in size order.
+func usageLine(u tasks.DiskUsage) string {
+    return fmt.Sprintf("%s (img %s, ckpt %s)", tasks.FormatSize(u.Total()), tasks.FormatSize(u.Images), tasks.FormatSize(u.Checkpoints))
+}
+
 func (m *model) sortTasks() {
+    if m.sortBySize {
+        size := make(map[string]int64, len(m.tasks))
+        for _, t := range m.tasks { size[t.Path] = tasks.TaskDiskUsage(t).Total() }
+        sort.SliceStable(m.tasks, func(i, j int) bool { return size[m.tasks[i].Path] > size[m.tasks[j].Path] })
+        return
+    }
     if m.sortAsc {
         sort.Slice(m.tasks, func(i, j int) bool { return m.tasks[i].CreatedAt.Before(m.tasks[j].CreatedAt) })
     } else {
@@ -757,41 +948,10 @@ func (m *model) sortTasks() {
     }
 }
 
-func (m *model) buildHistoryIndexes() {
-    m.histAll, m.histAI, m.histUser = nil, nil, nil
-    lines := strings.Split(m.renderedDetail, "\n")
-    for i, ln := range lines {
-        if strings.HasPrefix(ln, "### ") {
-            m.histAll = append(m.histAll, i)
-            if strings.Contains(ln, "🤖") { m.histAI = append(m.histAI, i) }
-            if strings.Contains(ln, "🧑") { m.histUser = append(m.histUser, i) }
-        }
-    }
-}
-
-func (m *model) jumpNextEntry() { jumpToNext(&m.vp, m.histAll) }
-func (m *model) jumpPrevEntry() { jumpToPrev(&m.vp, m.histAll) }
-func (m *model) jumpNextRole(role string) {
-    if role == "ai" { jumpToNext(&m.vp, m.histAI); return }
-    if role == "user" { jumpToNext(&m.vp, m.histUser); return }
-}
-func (m *model) jumpPrevRole(role string) {
-    if role == "ai" { jumpToPrev(&m.vp, m.histAI); return }
-    if role == "user" { jumpToPrev(&m.vp, m.histUser); return }
-}
-
-func jumpToNext(vp *viewport.Model, lines []int) {
-    if len(lines) == 0 { return }
-    cur := vp.YOffset
-    for _, ln := range lines { if ln > cur { vp.SetYOffset(ln); return } }
-    vp.SetYOffset(lines[0])
-}
-func jumpToPrev(vp *viewport.Model, lines []int) {
-    if len(lines) == 0 { return }
-    cur := vp.YOffset
-    for i := len(lines)-1; i >= 0; i-- { if lines[i] < cur { vp.SetYOffset(lines[i]); return } }
-    vp.SetYOffset(lines[len(lines)-1])
-}
+func (m *model) jumpNextEntry() { m.doc.jumpNext(m.doc.entries("")) }
+func (m *model) jumpPrevEntry() { m.doc.jumpPrev(m.doc.entries("")) }
+func (m *model) jumpNextRole(role string) { m.doc.jumpNext(m.doc.entries(role)) }
+func (m *model) jumpPrevRole(role string) { m.doc.jumpPrev(m.doc.entries(role)) }
 
 func openInExplorer(dir string) error {
     if dir == "" { return nil }
@@ -807,16 +967,11 @@ func openInExplorer(dir string) error {
     }
 }
 
+// applyDetailSearch highlights the query and moves to its first match from the top.
 func (m *model) applyDetailSearch() {
-    if m.searchQuery == "" { m.vp.SetContent(m.renderedDetail); return }
-    // simple case-insensitive highlight using lipgloss
-    style := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("13"))
-    wrap := func(s string) string { return style.Render(s) }
-    rendered := highlightAll(m.renderedDetail, m.searchQuery, wrap)
-    m.vp.SetContent(rendered)
-    // jump to first match line
-    line := findFirstLine(rendered, m.searchQuery)
-    if line > 0 { m.vp.SetYOffset(line) }
+    m.doc.query = m.searchQuery
+    if m.searchQuery == "" { return }
+    m.doc.findFirst()
 }
 
 func highlightAll(s, q string, wrap func(string) string) string {
@@ -836,45 +991,3 @@ func highlightAll(s, q string, wrap func(string) string) string {
     return out.String()
 }
 
-func findFirstLine(s, q string) int {
-    if q == "" { return 0 }
-    lowerQ := strings.ToLower(q)
-    lines := strings.Split(s, "\n")
-    for i, ln := range lines {
-        if strings.Contains(strings.ToLower(ln), lowerQ) { return i }
-    }
-    return 0
-}
-
-func (m *model) findAllMatchLines() []int {
-    if m.searchQuery == "" { return nil }
-    lowerQ := strings.ToLower(m.searchQuery)
-    lines := strings.Split(m.vp.View(), "\n")
-    out := []int{}
-    for i, ln := range lines {
-        if strings.Contains(strings.ToLower(ln), lowerQ) { out = append(out, i) }
-    }
-    return out
-}
-
-func (m *model) findNext() {
-    lines := m.findAllMatchLines()
-    if len(lines) == 0 { return }
-    cur := m.vp.YOffset
-    for _, ln := range lines {
-        if ln > cur { m.vp.SetYOffset(ln); return }
-    }
-    // wrap to first
-    m.vp.SetYOffset(lines[0])
-}
-
-func (m *model) findPrev() {
-    lines := m.findAllMatchLines()
-    if len(lines) == 0 { return }
-    cur := m.vp.YOffset
-    for i := len(lines)-1; i >= 0; i-- {
-        if lines[i] < cur { m.vp.SetYOffset(lines[i]); return }
-    }
-    // wrap to last
-    m.vp.SetYOffset(lines[len(lines)-1])
-}
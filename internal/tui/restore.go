@@ -4,46 +4,146 @@ import (
     "fmt"
     "os/exec"
     "runtime"
+    "sort"
+    "strings"
+    "time"
 
     tea "github.com/charmbracelet/bubbletea"
     "github.com/charmbracelet/lipgloss"
 
+    "roocode-task-man/internal/config"
     "roocode-task-man/internal/tasks"
 )
 
+// restoreEntry is one row of the restore list: a state.vscdb.bak-* file or a snapshot.
+type restoreEntry struct {
+    bak  *tasks.BackupInfo
+    snap *tasks.Snapshot
+}
+
+func (e restoreEntry) at() time.Time {
+    if e.snap != nil { return e.snap.CreatedAt }
+    return e.bak.ModTime
+}
+
+// snapTask is one task of the snapshot being picked from.
+type snapTask struct {
+    pick  tasks.SnapshotPick
+    title string
+    size  int64
+}
+
+// restoreDiffMsg carries the comparison of a backup with the current state DB.
+type restoreDiffMsg struct {
+    suffix string
+    diff   tasks.BackupDiff
+    err    error
+}
+
 type RestoreModel struct {
-    entries []tasks.BackupInfo
+    cfg     config.Config
+    entries []restoreEntry
     dir     string
     editor  string
     idx     int
     quitting bool
     selectedSuffix string
     msg string
+    confirm string // "delete" or "prune" while waiting for y/n
+
+    // comparisons of backups with the current DB, by suffix
+    diffs map[string]restoreDiffMsg
+    asked map[string]bool
+
+    // picking history entries of a backup to merge back
+    changes    *tasks.BackupInfo
+    changeIdx  int
+    changeMark map[string]bool
+    entryIDs   []string
+
+    // picking tasks of a snapshot
+    snap      *tasks.Snapshot
+    snapTasks []snapTask
+    taskIdx   int
+    marked    map[int]bool
+    whole     bool
+    picks     []tasks.SnapshotPick
 }
 
-func NewRestore(infos []tasks.BackupInfo, dir string, editor string) RestoreModel {
-    return RestoreModel{entries: infos, dir: dir, editor: editor, idx: 0}
+// NewRestore lists the state DB backups in dir and the snapshots, newest first.
+func NewRestore(cfg config.Config, infos []tasks.BackupInfo, snaps []tasks.Snapshot, dir string) RestoreModel {
+    m := RestoreModel{cfg: cfg, dir: dir, editor: tasks.DisplayEditorName(cfg.CodeChannel), diffs: map[string]restoreDiffMsg{}, asked: map[string]bool{}}
+    m.setEntries(infos, snaps)
+    return m
 }
 
-func (m RestoreModel) Init() tea.Cmd { return nil }
+func (m *RestoreModel) setEntries(infos []tasks.BackupInfo, snaps []tasks.Snapshot) {
+    m.entries = nil
+    for i := range infos { m.entries = append(m.entries, restoreEntry{bak: &infos[i]}) }
+    for i := range snaps { m.entries = append(m.entries, restoreEntry{snap: &snaps[i]}) }
+    sort.SliceStable(m.entries, func(i, j int) bool { return m.entries[i].at().After(m.entries[j].at()) })
+    if m.idx >= len(m.entries) { m.idx = max(len(m.entries)-1, 0) }
+}
+
+func (m RestoreModel) Init() tea.Cmd { return m.diffCmd() }
+
+// diffCmd compares the selected backup with the current DB, unless that is done already.
+func (m RestoreModel) diffCmd() tea.Cmd {
+    if len(m.entries) == 0 || m.entries[m.idx].bak == nil { return nil }
+    b := *m.entries[m.idx].bak
+    if m.asked[b.Suffix] { return nil }
+    m.asked[b.Suffix] = true
+    cfg := m.cfg
+    return func() tea.Msg {
+        d, err := tasks.DiffBackup(cfg, b)
+        return restoreDiffMsg{suffix: b.Suffix, diff: d, err: err}
+    }
+}
 
 func (m RestoreModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+    if dm, ok := msg.(restoreDiffMsg); ok {
+        m.diffs[dm.suffix] = dm
+        return m, nil
+    }
+    if m.snap != nil { return m.updateTasks(msg) }
+    if m.changes != nil { return m.updateChanges(msg) }
     switch msg := msg.(type) {
     case tea.KeyMsg:
+        if m.confirm != "" { return m.updateConfirm(msg) }
         switch msg.String() {
         case "q", "esc", "ctrl+c":
             m.quitting = true
             return m, tea.Quit
         case "up", "k":
             if m.idx > 0 { m.idx-- }
-            return m, nil
+            return m, m.diffCmd()
         case "down", "j":
             if m.idx < len(m.entries)-1 { m.idx++ }
+            return m, m.diffCmd()
+        case "right", "l", "c":
+            if len(m.entries) == 0 || m.entries[m.idx].bak == nil { return m, nil }
+            b := m.entries[m.idx].bak
+            if d, ok := m.diffs[b.Suffix]; !ok || d.err != nil {
+                m.msg = "the comparison with the current DB is not ready"
+                return m, nil
+            }
+            m.changes, m.changeIdx, m.changeMark, m.msg = b, 0, map[string]bool{}, ""
+            return m, nil
+        case "D":
+            if len(m.entries) == 0 || m.entries[m.idx].bak == nil { m.msg = "only state.vscdb backups can be deleted here"; return m, nil }
+            m.confirm = "delete"
+            return m, nil
+        case "P":
+            m.confirm = "prune"
             return m, nil
         case "enter":
-            if len(m.entries) > 0 {
-                m.selectedSuffix = m.entries[m.idx].Suffix
+            if len(m.entries) == 0 { return m, nil }
+            e := m.entries[m.idx]
+            if e.snap != nil {
+                m.openSnapshot(e.snap)
+                return m, nil
             }
+            m.selectedSuffix = e.bak.Suffix
             return m, tea.Quit
         case "o":
             openDir(m.dir)
@@ -54,30 +154,282 @@ func (m RestoreModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
     return m, nil
 }
 
+// updateConfirm handles the y/n answer to deleting or pruning backups.
+func (m RestoreModel) updateConfirm(km tea.KeyMsg) (tea.Model, tea.Cmd) {
+    what := m.confirm
+    m.confirm = ""
+    if km.String() != "y" { m.msg = "canceled"; return m, nil }
+    switch what {
+    case "delete":
+        b := *m.entries[m.idx].bak
+        if err := tasks.DeleteBackup(b); err != nil { m.msg = "delete failed: " + err.Error(); return m, nil }
+        m.msg = "deleted backup " + b.Suffix
+    case "prune":
+        dropped, err := tasks.PruneBackups(m.cfg, tasks.StateBackupKeep(m.cfg))
+        if err != nil { m.msg = "prune failed: " + err.Error(); return m, nil }
+        m.msg = fmt.Sprintf("deleted %d old backup(s)", len(dropped))
+    }
+    infos, _, err := tasks.ListBackups(m.cfg)
+    if err != nil { m.msg += "; " + err.Error() }
+    var snaps []tasks.Snapshot
+    for _, e := range m.entries {
+        if e.snap != nil { snaps = append(snaps, *e.snap) }
+    }
+    m.setEntries(infos, snaps)
+    return m, m.diffCmd()
+}
+
+// updateChanges handles picking history entries of a backup to merge back.
+func (m RestoreModel) updateChanges(msg tea.Msg) (tea.Model, tea.Cmd) {
+    km, ok := msg.(tea.KeyMsg)
+    if !ok { return m, nil }
+    changes := m.diffs[m.changes.Suffix].diff.History
+    switch km.String() {
+    case "ctrl+c":
+        m.quitting = true
+        return m, tea.Quit
+    case "esc", "h", "left", "q":
+        m.changes = nil
+        return m, nil
+    case "up", "k":
+        if m.changeIdx > 0 { m.changeIdx-- }
+    case "down", "j":
+        if m.changeIdx < len(changes)-1 { m.changeIdx++ }
+    case " ", "tab":
+        if len(changes) == 0 { return m, nil }
+        c := changes[m.changeIdx]
+        if !c.Restorable() { m.msg = c.ID + " is only in the current DB; nothing to restore"; return m, nil }
+        m.changeMark[c.ID] = !m.changeMark[c.ID]
+    case "a":
+        all := true
+        for _, c := range changes {
+            if c.Restorable() { all = all && m.changeMark[c.ID] }
+        }
+        m.changeMark = map[string]bool{}
+        if !all {
+            for _, c := range changes {
+                if c.Restorable() { m.changeMark[c.ID] = true }
+            }
+        }
+    case "enter":
+        for _, c := range changes {
+            if m.changeMark[c.ID] { m.entryIDs = append(m.entryIDs, c.ID) }
+        }
+        if len(m.entryIDs) == 0 && len(changes) > 0 && changes[m.changeIdx].Restorable() {
+            m.entryIDs = []string{changes[m.changeIdx].ID}
+        }
+        if len(m.entryIDs) == 0 { m.msg = "nothing selected to restore"; return m, nil }
+        return m, tea.Quit
+    }
+    return m, nil
+}
+
+// openSnapshot switches to picking tasks of s.
+func (m *RestoreModel) openSnapshot(s *tasks.Snapshot) {
+    m.snap, m.snapTasks, m.taskIdx, m.marked, m.msg = s, nil, 0, map[int]bool{}, ""
+    for _, src := range s.Sources {
+        for _, t := range src.Tasks {
+            m.snapTasks = append(m.snapTasks, snapTask{pick: tasks.SnapshotPick{Source: src.Label(), ID: t.ID}, title: t.Title, size: t.Size()})
+        }
+    }
+}
+
+func (m RestoreModel) updateTasks(msg tea.Msg) (tea.Model, tea.Cmd) {
+    km, ok := msg.(tea.KeyMsg)
+    if !ok { return m, nil }
+    switch km.String() {
+    case "ctrl+c":
+        m.quitting = true
+        return m, tea.Quit
+    case "esc", "h", "q":
+        m.snap = nil
+        return m, nil
+    case "up", "k":
+        if m.taskIdx > 0 { m.taskIdx-- }
+    case "down", "j":
+        if m.taskIdx < len(m.snapTasks)-1 { m.taskIdx++ }
+    case " ", "tab":
+        if len(m.snapTasks) > 0 { m.marked[m.taskIdx] = !m.marked[m.taskIdx] }
+    case "a":
+        all := len(m.marked) > 0
+        for i := range m.snapTasks { all = all && m.marked[i] }
+        m.marked = map[int]bool{}
+        if !all {
+            for i := range m.snapTasks { m.marked[i] = true }
+        }
+    case "W":
+        m.whole = true
+        return m, tea.Quit
+    case "enter":
+        if len(m.snapTasks) == 0 { return m, nil }
+        for i, t := range m.snapTasks {
+            if m.marked[i] { m.picks = append(m.picks, t.pick) }
+        }
+        if len(m.picks) == 0 { m.picks = []tasks.SnapshotPick{m.snapTasks[m.taskIdx].pick} }
+        return m, tea.Quit
+    }
+    return m, nil
+}
+
 func (m RestoreModel) View() string {
     if m.quitting {
         return ""
     }
+    if m.snap != nil { return m.viewTasks() }
+    if m.changes != nil { return m.viewChanges() }
     styleSel := lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
-    header := "Restore state.vscdb from backup\n"
+    header := "Restore state.vscdb from backup, or tasks from a snapshot\n"
     header += fmt.Sprintf("Editor: %s\nDirectory: %s\n", m.editor, m.dir)
     header += "Close the editor before restoring!\n"
-    header += "Use ↑/↓ or j/k to navigate, Enter to restore, o to open folder, q to quit.\n\n"
+    header += "Use ↑/↓ or j/k to navigate, Enter to restore (or pick tasks of a snapshot), → to pick history entries of a backup to merge back,\n"
+    header += fmt.Sprintf("D to delete a backup, P to delete all but the newest %d, o to open folder, q to quit.\n\n", tasks.StateBackupKeep(m.cfg))
     body := ""
     for i, e := range m.entries {
-        line := fmt.Sprintf("%s  %s  (%d bytes)", e.ModTime.Format("2006-01-02 15:04:05"), e.Suffix, e.Size)
+        var line string
+        if e.snap != nil {
+            line = fmt.Sprintf("%s  snapshot %s  (%d tasks)", e.snap.CreatedAt.Local().Format("2006-01-02 15:04:05"), e.snap.Name, e.snap.TaskCount())
+            if e.snap.Reason != "" { line += "  " + e.snap.Reason }
+        } else {
+            line = fmt.Sprintf("%s  %s  (%d bytes)", e.bak.ModTime.Format("2006-01-02 15:04:05"), e.bak.Suffix, e.bak.Size)
+            if md := e.bak.Meta; md != nil {
+                line += "  " + md.Reason
+                if len(md.TaskIDs) > 0 { line += fmt.Sprintf(" (%s)", taskIDList(md.TaskIDs, 3)) }
+                if md.Integrity != "ok" { line += "  integrity: " + md.Integrity }
+            }
+        }
         if i == m.idx {
             body += styleSel.Render("> " + line) + "\n"
         } else {
             body += "  " + line + "\n"
         }
     }
+    body += m.viewPreview()
+    switch m.confirm {
+    case "delete":
+        body += fmt.Sprintf("\nDelete backup %s? y/n\n", m.entries[m.idx].bak.Suffix)
+    case "prune":
+        body += fmt.Sprintf("\nDelete all but the newest %d state.vscdb backups? y/n\n", tasks.StateBackupKeep(m.cfg))
+    }
+    if m.msg != "" { body += "\n" + m.msg + "\n" }
+    return header + body
+}
+
+// previewLines is how many history changes the preview under the list shows.
+const previewLines = 8
+
+// viewPreview summarizes how the selected backup differs from the current DB.
+func (m RestoreModel) viewPreview() string {
+    if len(m.entries) == 0 || m.entries[m.idx].bak == nil { return "" }
+    d, ok := m.diffs[m.entries[m.idx].bak.Suffix]
+    if !ok { return "\nComparing with the current state.vscdb…\n" }
+    if d.err != nil { return "\nCannot compare with the current state.vscdb: " + d.err.Error() + "\n" }
+    removed, changed, added := d.diff.Counts()
+    out := fmt.Sprintf("\nSince this backup: %d history entries removed, %d changed, %d added; %d other keys differ\n", removed, changed, added, len(d.diff.Keys))
+    for i, c := range d.diff.History {
+        if i == previewLines { out += fmt.Sprintf("  … %d more (→ to see all)\n", len(d.diff.History)-i); break }
+        out += "  " + changeLine(c) + "\n"
+    }
+    if len(d.diff.Keys) > 0 {
+        keys := make([]string, 0, len(d.diff.Keys))
+        for _, k := range d.diff.Keys { keys = append(keys, k.Key) }
+        out += "  keys: " + taskIDList(keys, 4) + "\n"
+    }
+    return out
+}
+
+// changeLine describes one history change on one line.
+func changeLine(c tasks.HistoryChange) string {
+    sign := map[string]string{"removed": "-", "changed": "~", "added": "+"}[c.Kind]
+    title, _, _ := tasks.CleanOneLine(c.Task, 50)
+    line := fmt.Sprintf("%s %-7s %s  %s", sign, c.Kind, c.ID, title)
+    if c.Workspace != [2]string{} {
+        line += fmt.Sprintf("  workspace %s → %s", orNone(c.Workspace[0]), orNone(c.Workspace[1]))
+    } else if len(c.Fields) > 0 {
+        line += "  (" + strings.Join(c.Fields, ", ") + ")"
+    }
+    if !c.Folder { line += "  [no task folder]" }
+    return line
+}
+
+func orNone(s string) string {
+    if s == "" { return "(none)" }
+    return s
+}
+
+func (m RestoreModel) viewChanges() string {
+    styleSel := lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
+    d := m.diffs[m.changes.Suffix].diff
+    header := fmt.Sprintf("Backup %s compared with the current state.vscdb\n", m.changes.Suffix)
+    header += "Space select, a select all, Enter merge the selected (or current) entries back into the current DB, Esc back.\n"
+    header += "Only the chosen entries change; the current DB is backed up first.\n\n"
+    body := ""
+    for i, c := range d.History {
+        mark := "   "
+        if c.Restorable() {
+            mark = "[ ]"
+            if m.changeMark[c.ID] { mark = "[x]" }
+        }
+        line := mark + " " + changeLine(c)
+        if i == m.changeIdx {
+            body += styleSel.Render("> " + line) + "\n"
+        } else {
+            body += "  " + line + "\n"
+        }
+    }
+    if len(d.History) == 0 { body = "  (taskHistory is the same)\n" }
+    if len(d.Keys) > 0 {
+        body += "\nOther keys (restored only with the whole backup):\n"
+        for _, k := range d.Keys {
+            body += fmt.Sprintf("  %-7s %s  (%s → %s)\n", k.Kind, k.Key, tasks.FormatSize(int64(k.Backup)), tasks.FormatSize(int64(k.Current)))
+        }
+    }
     if m.msg != "" { body += "\n" + m.msg + "\n" }
     return header + body
 }
 
+func (m RestoreModel) viewTasks() string {
+    styleSel := lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
+    header := fmt.Sprintf("Snapshot %s (%s)\n", m.snap.Name, m.snap.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+    header += "Space select, a select all, Enter restore the selected (or current) tasks, W restore the whole snapshot including the state DB, Esc back.\n"
+    header += "The current state is snapshotted before anything is restored.\n\n"
+    body := ""
+    for i, t := range m.snapTasks {
+        mark := "[ ]"
+        if m.marked[i] { mark = "[x]" }
+        title, _, _ := tasks.CleanOneLine(t.title, 60)
+        line := fmt.Sprintf("%s %s  %s  %s", mark, t.pick.ID, tasks.FormatSize(t.size), title)
+        if i == m.taskIdx {
+            body += styleSel.Render("> " + line) + "\n"
+        } else {
+            body += "  " + line + "\n"
+        }
+    }
+    if len(m.snapTasks) == 0 { body = "  (no tasks)\n" }
+    return header + body
+}
+
+// taskIDList shows the first max ids and how many more there are.
+func taskIDList(ids []string, max int) string {
+    if len(ids) <= max { return strings.Join(ids, ", ") }
+    return fmt.Sprintf("%s and %d more", strings.Join(ids[:max], ", "), len(ids)-max)
+}
+
 func (m RestoreModel) Selected() string { return m.selectedSuffix }
 
+// SelectedEntries is the backup and the history entries chosen to merge back from it;
+// ids is empty when none were.
+func (m RestoreModel) SelectedEntries() (suffix string, ids []string) {
+    if len(m.entryIDs) == 0 { return "", nil }
+    return m.changes.Suffix, m.entryIDs
+}
+
+// SelectedSnapshot is the snapshot to restore from and the chosen tasks; picks is empty
+// when the whole snapshot was chosen, and snap nil when no snapshot was.
+func (m RestoreModel) SelectedSnapshot() (snap *tasks.Snapshot, picks []tasks.SnapshotPick) {
+    if !m.whole && len(m.picks) == 0 { return nil, nil }
+    return m.snap, m.picks
+}
+
 func openDir(dir string) {
     switch runtime.GOOS {
     case "darwin":
@@ -0,0 +1,79 @@
+package tui
+
+import (
+    "fmt"
+
+    tea "github.com/charmbracelet/bubbletea"
+    "github.com/charmbracelet/lipgloss"
+
+    "roocode-task-man/internal/tasks"
+)
+
+// SourcePickerModel lets the user choose another editor/plugin when the configured
+// one has no tasks. The first entry stands for all sources.
+type SourcePickerModel struct {
+    current  string
+    entries  []tasks.SourceInfo
+    idx      int
+    chosen   bool
+    quitting bool
+}
+
+func NewSourcePicker(current string, entries []tasks.SourceInfo) SourcePickerModel {
+    return SourcePickerModel{current: current, entries: entries}
+}
+
+func (m SourcePickerModel) Init() tea.Cmd { return nil }
+
+func (m SourcePickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+    switch msg := msg.(type) {
+    case tea.KeyMsg:
+        switch msg.String() {
+        case "q", "esc", "ctrl+c":
+            m.quitting = true
+            return m, tea.Quit
+        case "up", "k":
+            if m.idx > 0 { m.idx-- }
+            return m, nil
+        case "down", "j":
+            if m.idx < len(m.entries) { m.idx++ }
+            return m, nil
+        case "enter":
+            m.chosen = true
+            return m, tea.Quit
+        }
+    }
+    return m, nil
+}
+
+func (m SourcePickerModel) View() string {
+    if m.quitting || m.chosen {
+        return ""
+    }
+    styleSel := lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
+    header := fmt.Sprintf("No tasks found for %s.\n", m.current)
+    header += "Pick a source to browse. Use ↑/↓ or j/k to navigate, Enter to open, q to keep the default.\n\n"
+    total := 0
+    for _, e := range m.entries { total += e.TaskDirs }
+    lines := []string{fmt.Sprintf("All sources  (%d tasks)", total)}
+    for _, e := range m.entries {
+        lines = append(lines, fmt.Sprintf("%s  (%d tasks)", e.Label(), e.TaskDirs))
+    }
+    body := ""
+    for i, line := range lines {
+        if i == m.idx {
+            body += styleSel.Render("> " + line) + "\n"
+        } else {
+            body += "  " + line + "\n"
+        }
+    }
+    return header + body
+}
+
+// Selected returns the chosen source; all is true for the "All sources" entry and
+// ok is false when the picker was dismissed.
+func (m SourcePickerModel) Selected() (src tasks.Source, all bool, ok bool) {
+    if !m.chosen { return tasks.Source{}, false, false }
+    if m.idx == 0 { return tasks.Source{}, true, true }
+    return m.entries[m.idx-1].Source, false, true
+}
@@ -0,0 +1,274 @@
+package tui
+
+import (
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/charmbracelet/bubbles/textinput"
+    tea "github.com/charmbracelet/bubbletea"
+    "github.com/charmbracelet/lipgloss"
+
+    "roocode-task-man/internal/config"
+    "roocode-task-man/internal/tasks"
+)
+
+// StateModel browses the extension's keys in state.vscdb with their values pretty-printed,
+// and exports or imports chosen keys. Secret-looking values stay masked unless revealed.
+type StateModel struct {
+    cfg      config.Config
+    keys     []tasks.StateKey
+    idx      int
+    marked   map[string]bool
+    scroll   int // first line of the value shown
+    reveal   bool
+    width    int
+    height   int
+    input    textinput.Model
+    prompt   bool // asking for the file to import
+    imp      *tasks.StateExport
+    impPath  string
+    plan     []tasks.StateChange
+    msg      string
+    quitting bool
+}
+
+func NewState(cfg config.Config, keys []tasks.StateKey) StateModel {
+    ti := textinput.New()
+    ti.Placeholder = "path of a state export (.json)"
+    ti.CharLimit = 500
+    return StateModel{cfg: cfg, keys: keys, marked: map[string]bool{}, input: ti, width: 100, height: 30}
+}
+
+func (m StateModel) Init() tea.Cmd { return nil }
+
+func (m StateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+    switch msg := msg.(type) {
+    case tea.WindowSizeMsg:
+        m.width, m.height = msg.Width, msg.Height
+        return m, nil
+    case tea.KeyMsg:
+        if m.prompt { return m.updatePrompt(msg) }
+        if m.imp != nil { return m.updateConfirm(msg) }
+        switch msg.String() {
+        case "q", "esc", "ctrl+c":
+            m.quitting = true
+            return m, tea.Quit
+        case "up", "k":
+            if m.idx > 0 { m.idx--; m.scroll = 0 }
+        case "down", "j":
+            if m.idx < len(m.keys)-1 { m.idx++; m.scroll = 0 }
+        case "pgdown", "ctrl+d", "J":
+            m.scroll += m.valueHeight() / 2
+            if last := len(m.valueLines()) - m.valueHeight(); m.scroll > last { m.scroll = max(last, 0) }
+        case "pgup", "ctrl+u", "K":
+            m.scroll -= m.valueHeight() / 2
+            if m.scroll < 0 { m.scroll = 0 }
+        case " ", "tab":
+            if len(m.keys) > 0 {
+                name := m.keys[m.idx].Name
+                m.marked[name] = !m.marked[name]
+                if m.idx < len(m.keys)-1 { m.idx++; m.scroll = 0 }
+            }
+        case "r":
+            m.reveal = !m.reveal
+        case "e":
+            m.msg = m.export()
+        case "i":
+            m.prompt = true
+            m.msg = ""
+            m.input.SetValue("")
+            return m, m.input.Focus()
+        }
+    }
+    return m, nil
+}
+
+// updatePrompt reads the path of the file to import and computes what it would change.
+func (m StateModel) updatePrompt(km tea.KeyMsg) (tea.Model, tea.Cmd) {
+    switch km.String() {
+    case "ctrl+c":
+        m.quitting = true
+        return m, tea.Quit
+    case "esc":
+        m.prompt = false
+        m.input.Blur()
+        return m, nil
+    case "enter":
+        m.prompt = false
+        m.input.Blur()
+        path := strings.TrimSpace(m.input.Value())
+        if path == "" { return m, nil }
+        exp, err := tasks.ReadStateExport(path)
+        if err != nil { m.msg = "import failed: " + err.Error(); return m, nil }
+        plan, err := tasks.ImportStateKeys(m.cfg, exp, nil, true)
+        if err != nil { m.msg = "import failed: " + err.Error(); return m, nil }
+        m.imp, m.impPath, m.plan = &exp, path, plan
+        return m, nil
+    }
+    var cmd tea.Cmd
+    m.input, cmd = m.input.Update(km)
+    return m, cmd
+}
+
+// updateConfirm applies the import on y.
+func (m StateModel) updateConfirm(km tea.KeyMsg) (tea.Model, tea.Cmd) {
+    exp := *m.imp
+    n := 0
+    for _, c := range m.plan {
+        if c.Kind != "same" { n++ }
+    }
+    m.imp, m.plan = nil, nil
+    if n == 0 { m.msg = ""; return m, nil }
+    if km.String() != "y" { m.msg = "import canceled"; return m, nil }
+    if _, err := tasks.ImportStateKeys(m.cfg, exp, nil, false); err != nil { m.msg = "import failed: " + err.Error(); return m, nil }
+    m.msg = fmt.Sprintf("imported %d keys from %s (the previous state DB was backed up)", n, m.impPath)
+    if keys, err := tasks.ListStateKeys(m.cfg); err == nil {
+        m.keys = keys
+        if m.idx >= len(keys) { m.idx = max(len(keys)-1, 0) }
+    }
+    return m, nil
+}
+
+// export writes the marked keys, or the current one, next to the task exports.
+func (m StateModel) export() string {
+    var names []string
+    for name, ok := range m.marked {
+        if ok { names = append(names, name) }
+    }
+    sort.Strings(names)
+    if len(names) == 0 && len(m.keys) > 0 { names = []string{m.keys[m.idx].Name} }
+    exp, err := tasks.ExportStateKeys(m.cfg, names, m.reveal)
+    if err != nil { return "export failed: " + err.Error() }
+    path := StateExportPath(m.cfg)
+    if err := tasks.WriteStateExport(path, exp); err != nil { return "export failed: " + err.Error() }
+    s := fmt.Sprintf("exported %d keys to %s", len(exp.Keys), path)
+    if exp.Masked > 0 { s += fmt.Sprintf(" (%d secret values masked)", exp.Masked) }
+    return s
+}
+
+// StateExportPath is where state exports go by default:
+// <editor>-<plugin>-state-<time>.json in the export directory.
+func StateExportPath(cfg config.Config) string {
+    base := cfg.ExportDir
+    if base == "" { base = "." }
+    prefix := fmt.Sprintf("%s-%s", slug(tasks.DisplayEditorName(cfg.CodeChannel)), slug(cfg.PluginID))
+    return filepath.Join(base, fmt.Sprintf("%s-state-%s.json", prefix, time.Now().Format("20060102-150405")))
+}
+
+// StateSummary describes a state value in a few words: item counts, the names of the
+// first entries of lists such as customModes, or the start of a string.
+func StateSummary(k tasks.StateKey) string {
+    if k.Secret { return "encrypted by the editor" }
+    v, _ := tasks.MaskSecrets(k.Value)
+    switch k.Kind {
+    case "object":
+        var o map[string]json.RawMessage
+        _ = json.Unmarshal(v, &o)
+        names := make([]string, 0, len(o))
+        for n := range o { names = append(names, n) }
+        sort.Strings(names)
+        return fmt.Sprintf("%d fields: %s", len(o), shortList(names, 4))
+    case "array":
+        var a []json.RawMessage
+        _ = json.Unmarshal(v, &a)
+        var names []string
+        for _, e := range a {
+            var o map[string]any
+            if json.Unmarshal(e, &o) != nil { break }
+            for _, f := range []string{"slug", "name", "id"} {
+                if s, ok := o[f].(string); ok && s != "" { names = append(names, s); break }
+            }
+        }
+        if len(names) == 0 { return fmt.Sprintf("%d items", len(a)) }
+        return fmt.Sprintf("%d items: %s", len(a), shortList(names, 4))
+    }
+    s, _, _ := tasks.CleanOneLine(string(v), 60)
+    return s
+}
+
+func shortList(names []string, n int) string {
+    if len(names) <= n { return strings.Join(names, ", ") }
+    return fmt.Sprintf("%s, … (+%d)", strings.Join(names[:n], ", "), len(names)-n)
+}
+
+func (m StateModel) valueLines() []string {
+    if len(m.keys) == 0 { return nil }
+    k := m.keys[m.idx]
+    if k.Secret { return []string{"(encrypted by the editor's secret storage; not shown or exported)"} }
+    v := k.Value
+    if !m.reveal { v, _ = tasks.MaskSecrets(v) }
+    return strings.Split(tasks.PrettyJSON(v), "\n")
+}
+
+// valueHeight is the number of rows for the key list and value pane.
+func (m StateModel) valueHeight() int { return max(m.height-8, 5) }
+
+func (m StateModel) View() string {
+    if m.quitting {
+        return ""
+    }
+    styleSel := lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
+    styleDim := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+    header := fmt.Sprintf("State of %s in %s\n", m.cfg.PluginID, tasks.DisplayEditorName(m.cfg.CodeChannel))
+    header += "Use ↑/↓ or j/k to navigate, PgUp/PgDn to scroll the value, Space to mark, e to export marked keys (or the current one),\n"
+    reveal := "r to reveal secrets"
+    if m.reveal { reveal = "r to mask secrets" }
+    header += fmt.Sprintf("i to import keys from an export, %s, q to quit.\n\n", reveal)
+
+    h := m.valueHeight()
+    listW := 28
+    for _, k := range m.keys { listW = max(listW, min(len(k.Name)+4, 44)) }
+    start := 0
+    if m.idx >= h { start = m.idx - h + 1 }
+    var left []string
+    for i := start; i < len(m.keys) && i < start+h; i++ {
+        k := m.keys[i]
+        mark := "  "
+        if m.marked[k.Name] { mark = "* " }
+        name := k.Name
+        if len(name) > listW-4 { name = name[:listW-5] + "…" }
+        line := mark + name
+        if i == m.idx {
+            left = append(left, styleSel.Render("> "+line))
+        } else {
+            left = append(left, "  "+line)
+        }
+    }
+    var right []string
+    if len(m.keys) > 0 {
+        k := m.keys[m.idx]
+        right = append(right, styleDim.Render(fmt.Sprintf("%s  %s, %s", k.Row, k.Kind, tasks.FormatSize(int64(k.Size)))))
+        lines := m.valueLines()
+        end := min(m.scroll+h-1, len(lines))
+        valW := max(m.width-listW-4, 20)
+        for _, l := range lines[min(m.scroll, len(lines)):end] {
+            if len(l) > valW { l = l[:valW-1] + "…" }
+            right = append(right, l)
+        }
+        if end < len(lines) { right = append(right, styleDim.Render(fmt.Sprintf("… %d more lines", len(lines)-end))) }
+    }
+    body := lipgloss.JoinHorizontal(lipgloss.Top,
+        lipgloss.NewStyle().Width(listW+2).Render(strings.Join(left, "\n")),
+        strings.Join(right, "\n")) + "\n"
+
+    if m.prompt { body += "\nImport from: " + m.input.View() + "\n" }
+    if m.imp != nil {
+        n := 0
+        body += fmt.Sprintf("\n%s (%s, %s):\n", m.impPath, m.imp.PluginID, m.imp.ExportedAt.Local().Format("2006-01-02 15:04"))
+        for _, c := range m.plan {
+            body += fmt.Sprintf("  %-8s %s\n", c.Kind, c.Name)
+            if c.Kind != "same" { n++ }
+        }
+        if n == 0 {
+            body += "Nothing to import. Press any key.\n"
+        } else {
+            body += fmt.Sprintf("Write %d keys to the state DB (backed up first; close the editor)? y/n\n", n)
+        }
+    }
+    if m.msg != "" { body += "\n" + m.msg + "\n" }
+    return header + body
+}
@@ -0,0 +1,156 @@
+package tui
+
+import (
+    "log"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+
+    tea "github.com/charmbracelet/bubbletea"
+    "github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the bursts of events Roo produces while it writes a message.
+const watchDebounce = 300 * time.Millisecond
+
+// tasksChangedMsg asks the list to reload: task folders appeared or vanished.
+type tasksChangedMsg struct{}
+
+// detailChangedMsg reports that files in the open task directory changed.
+type detailChangedMsg struct{ dir string }
+
+// watcher turns filesystem events under the task roots and the open task directory
+// into debounced Bubble Tea messages, delivered one at a time through next().
+type watcher struct {
+    fs    *fsnotify.Watcher
+    out   chan tea.Msg
+    done  chan struct{}
+    debug bool
+
+    mu      sync.Mutex
+    roots   map[string]bool // directories task folders live in
+    pending map[string]bool // new task folders, watched until their first file lands
+    task    string          // open task directory, "" when none
+}
+
+// newWatcher watches roots (see tasks.WatchDirs). Roots that cannot be watched are skipped.
+func newWatcher(roots []string, debug bool) (*watcher, error) {
+    fw, err := fsnotify.NewWatcher()
+    if err != nil { return nil, err }
+    w := &watcher{fs: fw, out: make(chan tea.Msg), done: make(chan struct{}), debug: debug, roots: map[string]bool{}, pending: map[string]bool{}}
+    for _, r := range roots {
+        if err := fw.Add(r); err != nil {
+            if debug { log.Printf("[watch] skip %s: %v", r, err) }
+            continue
+        }
+        w.roots[r] = true
+    }
+    go w.run()
+    return w, nil
+}
+
+// next waits for the following change message. The model re-issues it after each one.
+func (w *watcher) next() tea.Cmd {
+    if w == nil { return nil }
+    return func() tea.Msg {
+        select {
+        case msg := <-w.out:
+            return msg
+        case <-w.done:
+            return nil
+        }
+    }
+}
+
+// watchTask switches the per-task watch to dir; an empty dir stops watching the task.
+func (w *watcher) watchTask(dir string) {
+    if w == nil { return }
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if dir == w.task { return }
+    if w.task != "" && !w.pending[w.task] { _ = w.fs.Remove(w.task) }
+    w.task = ""
+    if dir == "" { return }
+    if err := w.fs.Add(dir); err != nil {
+        if w.debug { log.Printf("[watch] task %s: %v", dir, err) }
+        return
+    }
+    w.task = dir
+}
+
+func (w *watcher) close() {
+    if w == nil { return }
+    select {
+    case <-w.done:
+    default:
+        close(w.done)
+        _ = w.fs.Close()
+    }
+}
+
+func (w *watcher) run() {
+    timer := time.NewTimer(watchDebounce)
+    timer.Stop()
+    listDue, detailDir := false, ""
+    for {
+        select {
+        case ev, ok := <-w.fs.Events:
+            if !ok { return }
+            list, detail := w.classify(ev)
+            if !list && detail == "" { continue }
+            listDue = listDue || list
+            if detail != "" { detailDir = detail }
+            timer.Reset(watchDebounce)
+        case err, ok := <-w.fs.Errors:
+            if !ok { return }
+            if w.debug { log.Printf("[watch] %v", err) }
+        case <-timer.C:
+            if listDue && !w.send(tasksChangedMsg{}) { return }
+            if detailDir != "" && !w.send(detailChangedMsg{dir: detailDir}) { return }
+            listDue, detailDir = false, ""
+        }
+    }
+}
+
+func (w *watcher) send(msg tea.Msg) bool {
+    select {
+    case w.out <- msg:
+        return true
+    case <-w.done:
+        return false
+    }
+}
+
+// classify reports whether ev changes the task list and, if it touches the open task,
+// that task's directory. New folders in a root are watched until a file shows up in
+// them, because a task only counts once it holds a file.
+func (w *watcher) classify(ev fsnotify.Event) (list bool, detail string) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    dir := filepath.Dir(ev.Name)
+    if w.task != "" && (dir == w.task || ev.Name == w.task) { detail = w.task }
+    switch {
+    case w.roots[dir]:
+        if ev.Has(fsnotify.Create) {
+            fi, err := os.Stat(ev.Name)
+            if err != nil || !fi.IsDir() { return }
+            if filepath.Base(ev.Name) == "tasks" && !w.roots[ev.Name] {
+                // storage root that only now got its tasks/ folder
+                if w.fs.Add(ev.Name) == nil { w.roots[ev.Name] = true }
+                return true, detail
+            }
+            if w.fs.Add(ev.Name) == nil { w.pending[ev.Name] = true }
+            return true, detail
+        }
+        if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+            delete(w.pending, ev.Name)
+            return true, detail
+        }
+    case w.pending[dir]:
+        delete(w.pending, dir)
+        if dir != w.task { _ = w.fs.Remove(dir) }
+        return true, detail
+    }
+    return false, detail
+}
@@ -22,6 +22,7 @@ type Manifest struct {
     Title     string    `json:"title"`
     CreatedAt time.Time `json:"createdAt"`
     PluginID  string    `json:"pluginId"`
+    Workspace string    `json:"workspace,omitempty"` // workspace on the exporting machine, if known
 }
 
 type ManifestMulti struct {
@@ -52,7 +53,7 @@ func ExportTask(t tasks.Task, zipPath string) error {
     defer zw.Close()
 
     // Write manifest
-    manifest := Manifest{ID: t.ID, Title: t.Title, CreatedAt: t.CreatedAt}
+    manifest := Manifest{ID: t.ID, Title: t.Title, CreatedAt: t.CreatedAt, Workspace: t.Workspace}
     if err := writeJSON(zw, "roo-task-manifest.json", manifest); err != nil {
         return err
     }
@@ -84,7 +85,7 @@ func ExportTasksWithProgress(ts []tasks.Task, zipPath string, progress ProgressC
 
     mm := ManifestMulti{Version: 2}
     for _, t := range ts {
-        mm.Tasks = append(mm.Tasks, Manifest{ID: t.ID, Title: t.Title, CreatedAt: t.CreatedAt})
+        mm.Tasks = append(mm.Tasks, Manifest{ID: t.ID, Title: t.Title, CreatedAt: t.CreatedAt, Workspace: t.Workspace})
     }
     if err := writeJSON(zw, "roo-task-manifest.json", mm); err != nil { return err }
 
@@ -189,6 +190,15 @@ func ImportAny(zipPath, destRoot string) error {
 
 // InspectIDs returns the task IDs present in the archive manifest (single or multi).
 func InspectIDs(zipPath string) ([]string, error) {
+    ms, err := ReadManifest(zipPath)
+    if err != nil { return nil, err }
+    ids := make([]string, 0, len(ms))
+    for _, m := range ms { ids = append(ids, m.ID) }
+    return ids, nil
+}
+
+// ReadManifest returns the manifest entries of an archive (single or multi).
+func ReadManifest(zipPath string) ([]Manifest, error) {
     r, err := zip.OpenReader(zipPath)
     if err != nil { return nil, err }
     defer r.Close()
@@ -199,12 +209,10 @@ func InspectIDs(zipPath string) ([]string, error) {
             rc, err := f.Open(); if err != nil { return nil, err }
             b, err := io.ReadAll(rc); rc.Close(); if err != nil { return nil, err }
             if err := json.Unmarshal(b, &multi); err == nil && multi.Version >= 2 && len(multi.Tasks) > 0 {
-                ids := make([]string, 0, len(multi.Tasks))
-                for _, t := range multi.Tasks { ids = append(ids, t.ID) }
-                return ids, nil
+                return multi.Tasks, nil
             }
             if err := json.Unmarshal(b, &single); err == nil && single.ID != "" {
-                return []string{single.ID}, nil
+                return []Manifest{single}, nil
             }
             return nil, fmt.Errorf("invalid manifest in %s", zipPath)
         }
@@ -56,8 +56,12 @@ func TestExportImportMulti(t *testing.T) {
     }
     t1 := mk("t1")
     t2 := mk("t2")
+    t1.Workspace = "/Users/alice/src/api"
     zipPath := filepath.Join(root, "out-multi.zip")
     if err := ExportTasks([]tasks.Task{t1, t2}, zipPath); err != nil { t.Fatalf("export multi: %v", err) }
+    ms, err := ReadManifest(zipPath)
+    if err != nil { t.Fatal(err) }
+    if len(ms) != 2 || ms[0].Workspace != t1.Workspace || ms[1].Workspace != "" { t.Fatalf("manifest: %+v", ms) }
     dest := filepath.Join(root, "dest")
     if err := os.MkdirAll(dest, 0o755); err != nil { t.Fatal(err) }
     if err := ImportAny(zipPath, dest); err != nil { t.Fatalf("import any: %v", err) }